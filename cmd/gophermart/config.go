@@ -4,6 +4,7 @@ import (
 	"flag"
 	"os"
 	"reflect"
+	"strconv"
 )
 
 type Config struct {
@@ -16,6 +17,42 @@ type Config struct {
 	AccrualRetries       int    `env:"ACCRUAL_RETRIES"`
 	AccrualDelay         int    `env:"ACCRUAL_DELAY"`
 	AccrualTimeout       int    `env:"ACCRUAL_TIMEOUT"`
+	MaxWithdraw          int    `env:"MAX_WITHDRAW"`
+	MaxBodySize          int    `env:"MAX_BODY_SIZE"`
+	MaxBatchOrders       int    `env:"MAX_BATCH_ORDERS"`
+	Programs             string `env:"LOYALTY_PROGRAMS"`
+	AccrualProgram       string `env:"ACCRUAL_PROGRAM"`
+	ExpiryInterval       int    `env:"EXPIRY_INTERVAL"`
+	ExpiringSoonDays     int    `env:"EXPIRING_SOON_DAYS"`
+	AdminToken           string `env:"ADMIN_TOKEN"`
+	DBMaxConns           int    `env:"DB_MAX_CONNS"`
+	DBMinConns           int    `env:"DB_MIN_CONNS"`
+	DBMaxConnLifetime    int    `env:"DB_MAX_CONN_LIFETIME"`
+	DBIsolation          string `env:"DB_ISOLATION"`
+	TxRetries            int    `env:"TX_RETRIES"`
+	OutboxSink           string `env:"OUTBOX_SINK"`
+	OutboxInterval       int    `env:"OUTBOX_INTERVAL"`
+	OutboxBatch          int    `env:"OUTBOX_BATCH"`
+	OutboxLease          int    `env:"OUTBOX_LEASE"`
+	WebhookTimeout       int    `env:"WEBHOOK_TIMEOUT"`
+	WebhookMaxAttempts   int    `env:"WEBHOOK_MAX_ATTEMPTS"`
+	WebhookBackoff       int    `env:"WEBHOOK_BACKOFF"`
+	WebhookDisableAfter  int    `env:"WEBHOOK_DISABLE_AFTER"`
+	EventsHeartbeat      int    `env:"EVENTS_HEARTBEAT"`
+	GRPCAddress          string `env:"GRPC_ADDRESS"`
+	RateLimits           string `env:"RATE_LIMITS"`
+	RateLimitStore       string `env:"RATE_LIMIT_STORE"`
+	LoginFreeFailures    int    `env:"LOGIN_FREE_FAILURES"`
+	LoginDelay           int    `env:"LOGIN_DELAY"`
+	LoginLockAfter       int    `env:"LOGIN_LOCK_AFTER"`
+	LoginLockFor         int    `env:"LOGIN_LOCK_FOR"`
+	TwoFactorIssuer      string `env:"TWO_FACTOR_ISSUER"`
+	TwoFactorFresh       int    `env:"TWO_FACTOR_FRESH"`
+	ConfirmWithdrawAbove int    `env:"CONFIRM_WITHDRAW_ABOVE"`
+	ResetNotifier        string `env:"RESET_NOTIFIER"`
+	ResetExpiration      int    `env:"RESET_EXPIRATION"`
+	AccountRetention     int    `env:"ACCOUNT_RETENTION"`
+	AccountPurgeInterval int    `env:"ACCOUNT_PURGE_INTERVAL"`
 }
 
 func parseFlags(config *Config) {
@@ -28,6 +65,43 @@ func parseFlags(config *Config) {
 	flag.IntVar(&config.AccrualRetries, "x", 3, "number of retries to accrual service")
 	flag.IntVar(&config.AccrualDelay, "y", 500, "delay in ms between retries to accrual service")
 	flag.IntVar(&config.AccrualTimeout, "z", 1000, "timeout in ms to accrual service")
+	flag.IntVar(&config.MaxWithdraw, "w", 1000000, "max sum of single withdraw")
+	flag.IntVar(&config.MaxBodySize, "b", 1<<20, "max request body size in bytes")
+	flag.IntVar(&config.MaxBatchOrders, "mb", 100, "max order numbers in single batch upload")
+	flag.StringVar(&config.Programs, "p", "points:Gophermart points:2", "loyalty programs as code:name:precision[:expiry months] separated by ';', first is default")
+	flag.StringVar(&config.AccrualProgram, "ap", "", "loyalty program credited by accrual service, default program if empty")
+	flag.IntVar(&config.ExpiryInterval, "ei", 60, "interval in minutes between points expiry runs")
+	flag.IntVar(&config.ExpiringSoonDays, "es", 30, "days ahead to report expiring points in balance")
+	flag.StringVar(&config.AdminToken, "at", "", "bearer token with admin role for bootstrapping roles, disabled if empty")
+	flag.IntVar(&config.DBMaxConns, "dmax", 10, "max open database connections")
+	flag.IntVar(&config.DBMinConns, "dmin", 0, "min idle database connections")
+	flag.IntVar(&config.DBMaxConnLifetime, "dlife", 60, "max database connection lifetime in minutes")
+	flag.StringVar(&config.DBIsolation, "di", "read committed", "isolation level of multi-storage transactions")
+	flag.IntVar(&config.TxRetries, "tr", 3, "retries of transactions failed on serialization or deadlock")
+	flag.StringVar(&config.OutboxSink, "os", "", "outbox events sink: stdout, file:<path>, webhook:<url> or pgq:<topic>, in addition to webhooks")
+	flag.IntVar(&config.OutboxInterval, "oi", 1000, "interval in ms between outbox relay runs")
+	flag.IntVar(&config.OutboxBatch, "ob", 100, "max events published by single outbox relay run")
+	flag.IntVar(&config.OutboxLease, "ol", 60, "time in seconds other relays skip events claimed by outbox relay run")
+	flag.IntVar(&config.WebhookTimeout, "wt", 5000, "timeout in ms of single webhook delivery")
+	flag.IntVar(&config.WebhookMaxAttempts, "wa", 8, "max delivery attempts of single webhook event")
+	flag.IntVar(&config.WebhookBackoff, "wb", 10, "delay in seconds before webhook retry, doubled on every next one")
+	flag.IntVar(&config.WebhookDisableAfter, "wd", 20, "consecutive failed deliveries disabling webhook, never disabled if 0")
+	flag.IntVar(&config.EventsHeartbeat, "eh", 15, "interval in seconds between heartbeats of idle event streams")
+	flag.StringVar(&config.GRPCAddress, "g", "", "address and port to run gRPC server, gRPC api is disabled if empty")
+	flag.StringVar(&config.RateLimits, "rl", "POST /api/user/login=10/1m;POST /api/user/register=5/1m;POST /api/user/orders=60/1m;POST /api/v2/user/orders=60/1m;POST /api/user/password/reset=5/1m;GET /api/user/export=5/1h",
+		"rate limits as '<METHOD> <route>=<requests>/<period>' separated by ';', '*' route applies to routes without own limit, rate limiting is disabled if empty")
+	flag.StringVar(&config.RateLimitStore, "rs", "memory", "rate limit counters store: memory or database to share them between replicas")
+	flag.IntVar(&config.LoginFreeFailures, "lf", 3, "failed logins not delaying the next attempt")
+	flag.IntVar(&config.LoginDelay, "ld", 1, "delay in seconds after the first delayed failed login, doubled on every next one")
+	flag.IntVar(&config.LoginLockAfter, "la", 10, "failed logins locking the login, never locked if 0")
+	flag.IntVar(&config.LoginLockFor, "lm", 15, "minutes login stays locked, failed logins are forgotten after them too")
+	flag.StringVar(&config.TwoFactorIssuer, "ti", "Gophermart", "issuer shown by authenticator apps for two-factor secrets")
+	flag.IntVar(&config.TwoFactorFresh, "tf", 5, "minutes confirmation of the second factor allows large withdrawals")
+	flag.IntVar(&config.ConfirmWithdrawAbove, "cw", 1000, "withdrawals above this sum need fresh confirmation of users with two-factor authentication, never if 0")
+	flag.StringVar(&config.ResetNotifier, "pn", "", "notifier sending password reset tokens: log or file:<path>, password reset is disabled if empty")
+	flag.IntVar(&config.ResetExpiration, "pe", 30, "minutes password reset token is valid")
+	flag.IntVar(&config.AccountRetention, "ar", 1825, "days financial records of deleted accounts are kept")
+	flag.IntVar(&config.AccountPurgeInterval, "ai", 60, "minutes between purges of deleted accounts past retention")
 	flag.Parse()
 }
 
@@ -40,7 +114,16 @@ func (config *Config) updateFromEnv() {
 		if envName = field.Tag.Get("env"); envName == "" {
 			continue
 		}
-		if envVal := os.Getenv(envName); envVal != "" {
+		envVal := os.Getenv(envName)
+		if envVal == "" {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Int:
+			if intVal, err := strconv.Atoi(envVal); err == nil {
+				v.Field(i).SetInt(int64(intVal))
+			}
+		default:
 			v.Field(i).SetString(envVal)
 		}
 	}
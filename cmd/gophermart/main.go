@@ -1,19 +1,44 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"time"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/valinurovdenis/gomart/internal/app/account"
 	"github.com/valinurovdenis/gomart/internal/app/accrualorder"
 	"github.com/valinurovdenis/gomart/internal/app/auth"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/events"
+	"github.com/valinurovdenis/gomart/internal/app/expiry"
+	"github.com/valinurovdenis/gomart/internal/app/grpcapi"
 	"github.com/valinurovdenis/gomart/internal/app/handlers"
+	"github.com/valinurovdenis/gomart/internal/app/lockout"
 	"github.com/valinurovdenis/gomart/internal/app/logger"
+	"github.com/valinurovdenis/gomart/internal/app/lotstorage"
+	"github.com/valinurovdenis/gomart/internal/app/memstorage"
+	"github.com/valinurovdenis/gomart/internal/app/notify"
 	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"github.com/valinurovdenis/gomart/internal/app/passwordreset"
+	"github.com/valinurovdenis/gomart/internal/app/pgdb"
+	"github.com/valinurovdenis/gomart/internal/app/programs"
+	"github.com/valinurovdenis/gomart/internal/app/ratelimit"
+	"github.com/valinurovdenis/gomart/internal/app/rbac"
 	"github.com/valinurovdenis/gomart/internal/app/service"
+	"github.com/valinurovdenis/gomart/internal/app/statement"
+	"github.com/valinurovdenis/gomart/internal/app/twofactor"
+	"github.com/valinurovdenis/gomart/internal/app/txmanager"
 	"github.com/valinurovdenis/gomart/internal/app/userstorage"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+	"github.com/valinurovdenis/gomart/internal/app/webhooks"
 	"github.com/valinurovdenis/gomart/internal/app/withdrawstorage"
+	"go.uber.org/zap"
 )
 
 func main() {
@@ -31,24 +56,200 @@ func run() error {
 		return err
 	}
 
+	registry, err := programs.ParseRegistry(config.Programs)
+	if err != nil {
+		return err
+	}
+
+	var userStorage interface {
+		userstorage.UserStorage
+		userstorage.BalanceStorage
+	}
+	var withdrawStorage withdrawstorage.WithdrawRepository
+	var orderStorage orderstorage.OrderStorage
+	var lotStorage lotstorage.LotStorage
+	var orderQueue accrualorder.OrderQueue
+	var txManager txmanager.TxManager
+	var outboxStorage outbox.OutboxStorage
+	var webhookStorage webhooks.WebhookStorage
+	var deliveryQueue webhooks.DeliveryQueue
+	var eventLog outbox.EventLog
+	var statementStorage interface {
+		statement.StatementStorage
+		statement.HistoryStorage
+	}
+	var lockoutStorage lockout.LockoutStorage
+	var twoFactorStorage twofactor.TwoFactorStorage
+	var resetTokenStorage passwordreset.ResetTokenStorage
+	var accountStorage account.AccountStorage
+	var serviceAccountStorage rbac.ServiceAccountStorage
+	var queueDB *sql.DB
+	var rateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if config.RateLimitStore != "memory" && config.RateLimitStore != "database" {
+		return fmt.Errorf("unknown rate limit store %q", config.RateLimitStore)
+	}
+	broker := events.NewBroker()
 	if config.DatabaseURI == "" {
-		return errors.New("empty database config")
+		logger.Log.Warn("empty database config, using in-memory storage")
+		if config.RateLimitStore == "database" {
+			return errors.New("database rate limit store requires database")
+		}
+		memStorage := memstorage.NewMemoryStorage(clock.RealClock{})
+		userStorage, withdrawStorage, orderStorage, lotStorage = memStorage, memStorage, memStorage, memStorage
+		orderQueue = accrualorder.NewMemoryOrderQueue()
+		txManager = memStorage
+		outboxStorage = memStorage
+		eventLog = memStorage
+		statementStorage = memStorage
+		memStorage.OnEvent = broker.Notify
+		webhookStorage = memStorage
+		deliveryQueue = webhooks.NewMemoryDeliveryQueue()
+		lockoutStorage = memStorage
+		twoFactorStorage = memStorage
+		resetTokenStorage = memStorage
+		accountStorage = memStorage
+		serviceAccountStorage = memStorage
+	} else {
+		isolation, err := pgdb.ParseIsolation(config.DBIsolation)
+		if err != nil {
+			return err
+		}
+		poolSettings := pgdb.PoolSettings{URI: config.DatabaseURI, MaxConns: config.DBMaxConns, MinConns: config.DBMinConns, MaxConnLifetime: time.Duration(config.DBMaxConnLifetime) * time.Minute}
+		pool, err := pgdb.NewPool(context.Background(), poolSettings)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+
+		dbUserStorage := &userstorage.DatabaseUserStorage{Pool: pool}
+		dbOrderStorage := &orderstorage.DatabaseOrderStorage{Pool: pool}
+		dbWithdrawStorage := &withdrawstorage.DatabaseWithdrawStorage{Pool: pool}
+		dbLotStorage := &lotstorage.DatabaseLotStorage{Pool: pool}
+		dbOutboxStorage := &outbox.DatabaseOutboxStorage{Pool: pool}
+		dbWebhookStorage := &webhooks.DatabaseWebhookStorage{Pool: pool}
+		dbLockoutStorage := &lockout.DatabaseLockoutStorage{Pool: pool}
+		dbTwoFactorStorage := &twofactor.DatabaseTwoFactorStorage{Pool: pool}
+		dbResetTokenStorage := &passwordreset.DatabaseResetTokenStorage{Pool: pool}
+		dbAccountStorage := &account.DatabaseAccountStorage{Pool: pool}
+		dbServiceAccountStorage := &rbac.DatabaseServiceAccountStorage{Pool: pool}
+		migrations := []interface{ Init() error }{dbUserStorage, dbOrderStorage, dbWithdrawStorage, dbLotStorage, dbOutboxStorage,
+			dbWebhookStorage, dbLockoutStorage, dbTwoFactorStorage, dbResetTokenStorage, dbAccountStorage, dbServiceAccountStorage}
+		if config.RateLimitStore == "database" {
+			dbRateLimitStore := &ratelimit.DatabaseStore{Pool: pool}
+			migrations = append(migrations, dbRateLimitStore)
+			rateLimitStore = dbRateLimitStore
+		}
+		// unlike constructors of storages, fail start if schema can not be migrated
+		for _, migration := range migrations {
+			if err = migration.Init(); err != nil {
+				return fmt.Errorf("migrate database: %w", err)
+			}
+		}
+		if err = dbUserStorage.MigrateLegacyBalances(context.Background(), registry.Default().Code); err != nil {
+			return err
+		}
+		if err = dbLotStorage.AddMissingLots(context.Background()); err != nil {
+			return err
+		}
+		userStorage = dbUserStorage
+		withdrawStorage = dbWithdrawStorage
+		orderStorage = dbOrderStorage
+		lotStorage = dbLotStorage
+		// pgq works over database/sql, share the pool with it
+		queueDB = stdlib.OpenDBFromPool(pool)
+		defer queueDB.Close()
+		orderQueue = accrualorder.NewPgqOrderQueue(queueDB)
+		txManager = pgdb.NewTxManager(pool, isolation, config.TxRetries)
+		outboxStorage, eventLog = dbOutboxStorage, dbOutboxStorage
+		statementStorage = statement.NewDatabaseStatementStorage(pool)
+		listener := events.NewPgListener(pool, broker)
+		defer listener.Stop()
+		webhookStorage = dbWebhookStorage
+		deliveryQueue = webhooks.NewPgqDeliveryQueue(queueDB)
+		lockoutStorage = dbLockoutStorage
+		twoFactorStorage = dbTwoFactorStorage
+		resetTokenStorage = dbResetTokenStorage
+		accountStorage = dbAccountStorage
+		serviceAccountStorage = dbServiceAccountStorage
 	}
-	db, err := sql.Open("pgx", config.DatabaseURI)
-	if err != nil {
-		panic(err)
+	dispatcherSettings := webhooks.DispatcherSettings{
+		Timeout:      time.Duration(config.WebhookTimeout) * time.Millisecond,
+		MaxAttempts:  config.WebhookMaxAttempts,
+		Backoff:      time.Duration(config.WebhookBackoff) * time.Second,
+		DisableAfter: config.WebhookDisableAfter,
+	}
+	dispatcher := webhooks.NewDispatcher(webhookStorage, deliveryQueue, clock.RealClock{}, dispatcherSettings, 4)
+	defer dispatcher.Stop()
+	sinks := outbox.MultiSink{dispatcher}
+	if config.OutboxSink != "" {
+		sink, err := outbox.ParseSink(config.OutboxSink, queueDB)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	relay := outbox.NewRelay(outboxStorage, txManager, sinks, config.OutboxBatch,
+		time.Duration(config.OutboxInterval)*time.Millisecond, time.Duration(config.OutboxLease)*time.Second)
+	defer relay.Stop()
+	expirer := expiry.NewExpirer(lotStorage, userStorage, txManager, outboxStorage, registry, clock.RealClock{}, time.Duration(config.ExpiryInterval)*time.Minute)
+	defer expirer.Stop()
+	serviceStorage := service.NewServiceStorage(userStorage, withdrawStorage, orderStorage, lotStorage, txManager, outboxStorage)
+	accrualSettings := accrualorder.AccrualServiceSettings{URL: config.AccrualSystemAddress, Timeout: config.AccrualTimeout, Delay: config.AccrualDelay, Retries: config.AccrualRetries, Program: config.AccrualProgram}
+	accrualOrderService := accrualorder.NewAccrualOrderQueue(orderQueue, 10, accrualSettings, serviceStorage, registry)
+	twoFactor := twofactor.NewTwoFactorService(twoFactorStorage, clock.RealClock{}, config.TwoFactorIssuer, time.Duration(config.TwoFactorFresh)*time.Minute)
+	auth := auth.NewAuthenticator(config.SecretKey, config.AdminToken, userStorage)
+	lockoutSettings := lockout.Settings{
+		FreeFailures: config.LoginFreeFailures,
+		Delay:        time.Duration(config.LoginDelay) * time.Second,
+		LockAfter:    config.LoginLockAfter,
+		LockFor:      time.Duration(config.LoginLockFor) * time.Minute,
+	}
+	auth.Guard = lockout.NewGuard(lockoutStorage, outboxStorage, txManager, clock.RealClock{}, lockoutSettings)
+	auth.TwoFactor = twoFactor
+	auth.ServiceAccounts = rbac.NewServiceAccountService(serviceAccountStorage, clock.RealClock{})
+	if config.ResetNotifier != "" {
+		notifier, err := notify.ParseNotifier(config.ResetNotifier, logger.Log)
+		if err != nil {
+			return err
+		}
+		auth.Reset = passwordreset.NewResetService(resetTokenStorage, userStorage, notifier, txManager, clock.RealClock{},
+			time.Duration(config.ResetExpiration)*time.Minute)
+	}
+	serviceSettings := service.Settings{Programs: registry, Clock: clock.RealClock{}, ExpiringSoon: time.Duration(config.ExpiringSoonDays) * 24 * time.Hour, History: statementStorage,
+		TwoFactor: twoFactor, ConfirmWithdrawAbove: int64(config.ConfirmWithdrawAbove) * 100}
+	service := service.NewOrderService(serviceStorage, accrualOrderService, serviceSettings)
+	limits := validators.Limits{MaxWithdraw: int64(config.MaxWithdraw) * 100, MaxBodySize: int64(config.MaxBodySize), MaxBatchOrders: config.MaxBatchOrders}
+	handler := handlers.NewApiHandler(*service, limits)
+	handler.Webhooks = webhooks.NewWebhookService(webhookStorage)
+	handler.Statements = statementStorage
+	handler.Events = events.NewEventStream(eventLog, broker, time.Duration(config.EventsHeartbeat)*time.Second)
+	handler.Accounts = account.NewAccountService(accountStorage, userStorage, orderStorage, withdrawStorage, eventLog, txManager, clock.RealClock{})
+	handler.Accounts.Sessions = lockoutStorage
+	handler.Accounts.TwoFactor = twoFactor
+	purger := account.NewPurger(accountStorage, clock.RealClock{}, time.Duration(config.AccountRetention)*24*time.Hour,
+		time.Duration(config.AccountPurgeInterval)*time.Minute)
+	defer purger.Stop()
+	if config.RateLimits != "" {
+		rules, err := ratelimit.ParseRules(config.RateLimits)
+		if err != nil {
+			return err
+		}
+		handler.Limiter = ratelimit.NewLimiter(rateLimitStore, rules, clock.RealClock{})
+	}
+
+	if config.GRPCAddress != "" {
+		listener, err := net.Listen("tcp", config.GRPCAddress)
+		if err != nil {
+			return err
+		}
+		grpcServer := grpcapi.NewGrpcServer(grpcapi.NewServer(*service, *auth, limits))
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				logger.Log.Error("gRPC server stopped", zap.Error(err))
+			}
+		}()
+		defer grpcServer.GracefulStop()
 	}
-	defer db.Close()
-
-	userStorage := userstorage.NewDatabaseUserStorage(db)
-	withdrawStorage := withdrawstorage.NewDatabaseWithdrawStorage(db)
-	orderStorage := orderstorage.NewDatabaseOrderStorage(db)
-	accrualSettings := accrualorder.AccrualServiceSettings{URL: config.AccrualSystemAddress, Timeout: config.AccrualTimeout, Delay: config.AccrualDelay, Retries: config.AccrualRetries}
-	accrualOrderService := accrualorder.NewAccrualOrderQueue(db, 10, accrualSettings, orderStorage)
-	auth := auth.NewAuthenticator(config.SecretKey, userStorage)
-	serviceStorage := service.NewServiceStorage(userStorage, withdrawStorage, orderStorage)
-	service := service.NewOrderService(serviceStorage, accrualOrderService)
-	handler := handlers.NewApiHandler(*service)
 
 	return http.ListenAndServe(config.RunAddress, handlers.MartRouter(*handler, *auth))
 }
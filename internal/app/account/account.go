@@ -0,0 +1,93 @@
+// Package account serves data requests of users: export of their data and deletion of accounts
+// keeping financial records under anonymous login for the retention period.
+package account
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valinurovdenis/gomart/internal/app/pgdb"
+	"github.com/valinurovdenis/gomart/internal/app/userstorage"
+)
+
+//go:generate mockery --name AccountStorage
+type AccountStorage interface {
+	// AnonymizeUser deletes user with the personal data and moves the financial records of the user to anonymous login,
+	// it returns userstorage.ErrUserNotFound if there is no such user.
+	AnonymizeUser(ctx context.Context, login string, anonymous string, deleted time.Time) error
+
+	// GetDeletedAccounts returns anonymous logins of accounts deleted before time.
+	GetDeletedAccounts(ctx context.Context, before time.Time, limit int) ([]string, error)
+
+	// PurgeAccount deletes records retained after deletion of account.
+	PurgeAccount(ctx context.Context, anonymous string) error
+}
+
+// personalTables are deleted with account, financialTables are kept under anonymous login.
+var (
+	personalTables  = []string{"two_factor", "login_attempts", "login_sessions", "password_resets", "outbox", "outbox_logins"}
+	financialTables = []string{"balances", "orders", "adjustments", "withdraw", "accrual_lots", "expirations"}
+)
+
+type DatabaseAccountStorage struct {
+	Pool *pgxpool.Pool
+}
+
+func (s *DatabaseAccountStorage) Init() error {
+	return pgdb.ExecBatch(context.Background(), s.Pool,
+		`CREATE TABLE IF NOT EXISTS deleted_accounts("login" TEXT PRIMARY KEY, "deleted" TIMESTAMPTZ)`,
+		`CREATE INDEX IF NOT EXISTS deleted_accounts_index ON deleted_accounts USING btree(deleted)`,
+	)
+}
+
+func (s *DatabaseAccountStorage) AnonymizeUser(ctx context.Context, login string, anonymous string, deleted time.Time) error {
+	return pgdb.WithTx(ctx, s.Pool, func(ctx context.Context) error {
+		tx := pgdb.Conn(ctx, s.Pool)
+		tag, err := tx.Exec(ctx, "DELETE FROM users WHERE login=$1", login)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return userstorage.ErrUserNotFound
+		}
+		batch := &pgx.Batch{}
+		batch.Queue("DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE login=$1)", login)
+		batch.Queue("DELETE FROM webhooks WHERE login=$1", login)
+		for _, table := range personalTables {
+			batch.Queue("DELETE FROM "+table+" WHERE login=$1", login)
+		}
+		for _, table := range financialTables {
+			batch.Queue("UPDATE "+table+" SET login=$2 WHERE login=$1", login, anonymous)
+		}
+		batch.Queue("INSERT INTO deleted_accounts (login, deleted) VALUES ($1, $2)", anonymous, deleted)
+		return tx.SendBatch(ctx, batch).Close()
+	})
+}
+
+func (s *DatabaseAccountStorage) GetDeletedAccounts(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx,
+		"SELECT login FROM deleted_accounts WHERE deleted < $1 ORDER BY deleted LIMIT $2", before, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (s *DatabaseAccountStorage) PurgeAccount(ctx context.Context, anonymous string) error {
+	return pgdb.WithTx(ctx, s.Pool, func(ctx context.Context) error {
+		batch := &pgx.Batch{}
+		for _, table := range financialTables {
+			batch.Queue("DELETE FROM "+table+" WHERE login=$1", anonymous)
+		}
+		batch.Queue("DELETE FROM deleted_accounts WHERE login=$1", anonymous)
+		return pgdb.Conn(ctx, s.Pool).SendBatch(ctx, batch).Close()
+	})
+}
+
+func NewDatabaseAccountStorage(pool *pgxpool.Pool) *DatabaseAccountStorage {
+	ret := &DatabaseAccountStorage{Pool: pool}
+	ret.Init()
+	return ret
+}
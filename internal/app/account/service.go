@@ -0,0 +1,203 @@
+package account
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/lockout"
+	"github.com/valinurovdenis/gomart/internal/app/logger"
+	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"github.com/valinurovdenis/gomart/internal/app/twofactor"
+	"github.com/valinurovdenis/gomart/internal/app/txmanager"
+	"github.com/valinurovdenis/gomart/internal/app/userstorage"
+	"github.com/valinurovdenis/gomart/internal/app/withdrawstorage"
+	"go.uber.org/zap"
+)
+
+const (
+	exportPage     = 1000
+	exportSessions = 10000
+	purgeBatch     = 100
+)
+
+type Profile struct {
+	Login      string                    `json:"login"`
+	ExportedAt time.Time                 `json:"exported_at"`
+	Balances   []userstorage.UserBalance `json:"balances"`
+}
+
+// AccountService exports data of users and deletes their accounts, Sessions is optional.
+type AccountService struct {
+	Storage     AccountStorage
+	Balances    userstorage.BalanceStorage
+	Orders      orderstorage.OrderStorage
+	Withdrawals withdrawstorage.WithdrawRepository
+	Events      outbox.EventLog
+	Sessions    lockout.LockoutStorage
+	TwoFactor   *twofactor.TwoFactorService
+	TxManager   txmanager.TxManager
+	Clock       clock.Clock
+}
+
+func writeFile(archive *zip.Writer, name string, value any) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func (s *AccountService) getEvents(ctx context.Context, login string) ([]outbox.Event, error) {
+	res := []outbox.Event{}
+	for {
+		var afterID int64
+		if len(res) > 0 {
+			afterID = res[len(res)-1].ID
+		}
+		events, err := s.Events.GetUserEvents(ctx, login, afterID, exportPage)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, events...)
+		if len(events) < exportPage {
+			return res, nil
+		}
+	}
+}
+
+// Export writes zip archive of json files with profile, orders, withdrawals, adjustments,
+// events and sessions of user.
+func (s *AccountService) Export(ctx context.Context, login string, w io.Writer) error {
+	balances, err := s.Balances.GetBalances(ctx, login)
+	if err != nil {
+		return err
+	}
+	orders, err := s.Orders.GetUserOrders(ctx, login)
+	if err != nil {
+		return err
+	}
+	adjustments, err := s.Orders.GetUserAdjustments(ctx, login)
+	if err != nil {
+		return err
+	}
+	withdrawals, err := s.Withdrawals.GetUserWithdrawals(ctx, login)
+	if err != nil {
+		return err
+	}
+	events, err := s.getEvents(ctx, login)
+	if err != nil {
+		return err
+	}
+	var sessions []lockout.Session
+	if s.Sessions != nil {
+		if sessions, err = s.Sessions.GetSessions(ctx, login, exportSessions); err != nil {
+			return err
+		}
+	}
+
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name  string
+		value any
+	}{
+		{"profile.json", Profile{Login: login, ExportedAt: s.Clock.Now(), Balances: balances}},
+		{"orders.json", orders},
+		{"adjustments.json", adjustments},
+		{"withdrawals.json", withdrawals},
+		{"events.json", events},
+		{"sessions.json", sessions},
+	}
+	for _, file := range files {
+		if err = writeFile(archive, file.name, file.value); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// Delete anonymizes account of user, tokens of the user are no longer accepted as the user does not exist.
+// Users with enabled second factor confirm it first.
+func (s *AccountService) Delete(ctx context.Context, login string) error {
+	if s.TwoFactor != nil {
+		if err := s.TwoFactor.RequireConfirmation(ctx, login); err != nil {
+			return err
+		}
+	}
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	anonymous := "deleted-" + hex.EncodeToString(random)
+	return s.TxManager.Do(ctx, func(ctx context.Context) error {
+		return s.Storage.AnonymizeUser(ctx, login, anonymous, s.Clock.Now())
+	})
+}
+
+func NewAccountService(storage AccountStorage, balances userstorage.BalanceStorage, orders orderstorage.OrderStorage,
+	withdrawals withdrawstorage.WithdrawRepository, events outbox.EventLog, txManager txmanager.TxManager, clock clock.Clock) *AccountService {
+	return &AccountService{Storage: storage, Balances: balances, Orders: orders, Withdrawals: withdrawals, Events: events,
+		TxManager: txManager, Clock: clock}
+}
+
+// Purger deletes records of accounts deleted longer than Retention ago.
+type Purger struct {
+	Storage   AccountStorage
+	Clock     clock.Clock
+	Retention time.Duration
+	Interval  time.Duration
+	Stop      func()
+}
+
+// PurgeDue deletes retained records of accounts whose retention period is over and returns their number.
+func (p *Purger) PurgeDue(ctx context.Context) (int, error) {
+	purged := 0
+	for {
+		accounts, err := p.Storage.GetDeletedAccounts(ctx, p.Clock.Now().Add(-p.Retention), purgeBatch)
+		if err != nil {
+			return purged, err
+		}
+		for _, anonymous := range accounts {
+			if err = p.Storage.PurgeAccount(ctx, anonymous); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+		if len(accounts) < purgeBatch {
+			return purged, nil
+		}
+	}
+}
+
+func (p *Purger) runBackgroundPurge(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		purged, err := p.PurgeDue(ctx)
+		if err != nil {
+			logger.Log.Error("failed to purge deleted accounts", zap.Error(err))
+		} else if purged > 0 {
+			logger.Log.Info("purged deleted accounts", zap.Int("accounts", purged))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func NewPurger(storage AccountStorage, clock clock.Clock, retention time.Duration, interval time.Duration) *Purger {
+	ctx, stop := context.WithCancel(context.Background())
+	ret := &Purger{Storage: storage, Clock: clock, Retention: retention, Interval: interval, Stop: stop}
+	go ret.runBackgroundPurge(ctx)
+	return ret
+}
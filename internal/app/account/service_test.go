@@ -0,0 +1,123 @@
+package account_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/valinurovdenis/gomart/internal/app/account"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/lockout"
+	"github.com/valinurovdenis/gomart/internal/app/memstorage"
+	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"github.com/valinurovdenis/gomart/internal/app/userstorage"
+	"github.com/valinurovdenis/gomart/internal/app/withdrawstorage"
+)
+
+func setup(t *testing.T) (*memstorage.MemoryStorage, *clock.FixedClock) {
+	ctx := context.Background()
+	testClock := &clock.FixedClock{Time: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	storage := memstorage.NewMemoryStorage(testClock)
+	require.NoError(t, storage.AddUser(ctx, userstorage.LoginPassword{Login: "user", Password: "Passw0rd!"}))
+	require.NoError(t, storage.AddUserOrder(ctx, orderstorage.UserOrder{Login: "user", Number: "79927398713",
+		Program: "points", Status: orderstorage.Processed, Balance: currencybalance.CurrencyBalance{Balance: 500}}))
+	require.NoError(t, storage.AddBalance(ctx, "user", "points", currencybalance.CurrencyBalance{Balance: 500}))
+	require.NoError(t, storage.AddUserWithdraw(ctx, withdrawstorage.UserWithdraw{Login: "user", Number: "2377225624",
+		Program: "points", Withdraw: currencybalance.CurrencyBalance{Balance: 100}}))
+	event, err := outbox.NewEvent(outbox.OrderProcessed, "user", outbox.OrderProcessedData{Number: "79927398713", Program: "points"})
+	require.NoError(t, err)
+	require.NoError(t, storage.AddEvent(ctx, event))
+	require.NoError(t, storage.AddSession(ctx, lockout.Session{Login: "user", IP: "10.0.0.1", Created: testClock.Now()}))
+	return storage, testClock
+}
+
+func TestAccountService_Export(t *testing.T) {
+	storage, testClock := setup(t)
+	service := account.NewAccountService(storage, storage, storage, storage, storage, storage, testClock)
+	service.Sessions = storage
+
+	var buf bytes.Buffer
+	require.NoError(t, service.Export(context.Background(), "user", &buf))
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		require.NoError(t, err)
+		files[file.Name], err = io.ReadAll(reader)
+		require.NoError(t, err)
+	}
+
+	var profile account.Profile
+	require.NoError(t, json.Unmarshal(files["profile.json"], &profile))
+	require.Equal(t, "user", profile.Login)
+	require.Equal(t, testClock.Now(), profile.ExportedAt)
+	require.Len(t, profile.Balances, 1)
+	for name, count := range map[string]int{"orders.json": 1, "adjustments.json": 0, "withdrawals.json": 1, "events.json": 1, "sessions.json": 1} {
+		var items []json.RawMessage
+		require.NoError(t, json.Unmarshal(files[name], &items), name)
+		require.Len(t, items, count, name)
+	}
+}
+
+func TestAccountService_Delete(t *testing.T) {
+	ctx := context.Background()
+	storage, testClock := setup(t)
+	service := account.NewAccountService(storage, storage, storage, storage, storage, storage, testClock)
+	version, err := storage.GetTokenVersion(ctx, "user")
+	require.NoError(t, err)
+
+	require.NoError(t, service.Delete(ctx, "user"))
+	require.ErrorIs(t, service.Delete(ctx, "user"), userstorage.ErrUserNotFound)
+	_, err = storage.GetUserPassword(ctx, "user")
+	require.ErrorIs(t, err, userstorage.ErrUserNotFound)
+	events, err := storage.GetUserEvents(ctx, "user", 0, 10)
+	require.NoError(t, err)
+	require.Empty(t, events)
+	sessions, err := storage.GetSessions(ctx, "user", 10)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+
+	// financial records are kept under anonymous login
+	order, err := storage.GetOrder(ctx, "79927398713")
+	require.NoError(t, err)
+	require.Regexp(t, "^deleted-[0-9a-f]{16}$", order.Login)
+	withdrawals, err := storage.GetUserWithdrawals(ctx, order.Login)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	balance, err := storage.GetBalance(ctx, order.Login, "points")
+	require.NoError(t, err)
+	require.Equal(t, int64(500), balance.Current.Balance)
+
+	// new user of the login does not accept tokens of deleted one
+	require.NoError(t, storage.AddUser(ctx, userstorage.LoginPassword{Login: "user", Password: "Passw0rd!"}))
+	reused, err := storage.GetTokenVersion(ctx, "user")
+	require.NoError(t, err)
+	require.NotEqual(t, version, reused)
+	orders, err := storage.GetUserOrders(ctx, "user")
+	require.NoError(t, err)
+	require.Empty(t, orders)
+
+	// records are purged after retention
+	purger := &account.Purger{Storage: storage, Clock: testClock, Retention: 24 * time.Hour}
+	purged, err := purger.PurgeDue(ctx)
+	require.NoError(t, err)
+	require.Zero(t, purged)
+	testClock.Advance(24*time.Hour + time.Second)
+	purged, err = purger.PurgeDue(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+	_, err = storage.GetOrder(ctx, "79927398713")
+	require.ErrorIs(t, err, orderstorage.ErrOrderNotFound)
+	withdrawals, err = storage.GetUserWithdrawals(ctx, order.Login)
+	require.NoError(t, err)
+	require.Empty(t, withdrawals)
+}
@@ -2,25 +2,39 @@ package accrualorder
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/logger"
 	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
-	"go.dataddo.com/pgq"
-	"go.dataddo.com/pgq/x/schema"
+	"github.com/valinurovdenis/gomart/internal/app/programs"
+	"go.uber.org/zap"
 )
 
-const queueName = "orders_updater"
-
 type AccrualOrder struct {
 	Order   string                   `json:"order"`
 	Status  orderstorage.OrderStatus `json:"status"`
-	Accrual float64                  `json:"accrual"`
+	Accrual json.Number              `json:"accrual"`
+	Program string                   `json:"program,omitempty"`
+}
+
+// accrualRounding is applied when accrual service returns more precise values than balance stores.
+const accrualRounding = currencybalance.RoundHalfEven
+
+func (o AccrualOrder) AccrualBalance() (currencybalance.CurrencyBalance, error) {
+	if o.Accrual == "" {
+		return currencybalance.CurrencyBalance{}, nil
+	}
+	balance, err := currencybalance.Parse(o.Accrual.String(), accrualRounding)
+	if err != nil {
+		return currencybalance.CurrencyBalance{}, fmt.Errorf("%w: %w", ErrInvalidAccrual, err)
+	}
+	return balance, nil
 }
 
 //go:generate mockery --name AccrualOrderService
@@ -28,6 +42,9 @@ type AccrualOrderService interface {
 	GetOrder(context context.Context, number string) (AccrualOrder, error)
 
 	EnqueueOrderUpdate(context context.Context, login string, number string) error
+
+	// EnqueueNewOrders schedules immediate accrual check of orders not yet checked.
+	EnqueueNewOrders(ctx context.Context, login string, numbers []string) error
 }
 
 type AccrualServiceSettings struct {
@@ -35,35 +52,35 @@ type AccrualServiceSettings struct {
 	Timeout int
 	Delay   int
 	Retries int
+	// Program credited by accruals which do not specify one, empty means default program.
+	Program string
+}
+
+const updateDelay = 5 * time.Minute
+
+// OrderUpdater applies accrual to order and user balance.
+type OrderUpdater interface {
+	UpdateOrderAccrual(ctx context.Context, order orderstorage.UserOrder) error
 }
 
 type AccrualOrderQueue struct {
-	DB              *sql.DB
+	Queue           OrderQueue
 	UpdateThreads   int
 	AccrualSettings AccrualServiceSettings
-	OrderStorage    orderstorage.OrderStorage
+	OrderUpdater    OrderUpdater
+	Programs        *programs.Registry
 	Stop            func()
 }
 
-func (s *AccrualOrderQueue) Init() {
-	tx, _ := s.DB.BeginTx(context.Background(), nil)
-	create := schema.GenerateCreateTableQuery(queueName)
-	tx.Exec(create)
-	tx.Commit()
-}
-
 var ErrNoSuchOrder = errors.New("no such order in accrual service")
 var ErrNoAnswer = errors.New("no answer from accrual service")
-
-type QueueOrder struct {
-	Login  string `json:"login"`
-	Number string `json:"number"`
-}
+var ErrInvalidAccrual = errors.New("accrual service returned invalid accrual")
 
 func (s *AccrualOrderQueue) getAccrualResponse(ctx context.Context, number string) (*http.Response, error) {
 	ctx, cncl := context.WithTimeout(ctx, time.Duration(s.AccrualSettings.Timeout)*time.Millisecond)
 	defer cncl()
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("/api/orders/%s", number), nil)
+	url := fmt.Sprintf("%s/api/orders/%s", strings.TrimRight(s.AccrualSettings.URL, "/"), number)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	return http.DefaultClient.Do(req)
 }
 
@@ -89,6 +106,9 @@ func (s *AccrualOrderQueue) getAccrualOrder(ctx context.Context, number string)
 			}
 			return order, nil
 		} else {
+			if err == nil {
+				response.Body.Close()
+			}
 			retries--
 		}
 		time.Sleep(retryDelay)
@@ -98,15 +118,15 @@ func (s *AccrualOrderQueue) getAccrualOrder(ctx context.Context, number string)
 }
 
 func (s *AccrualOrderQueue) EnqueueOrderUpdate(ctx context.Context, login string, number string) error {
-	publisher := pgq.NewPublisher(s.DB)
-	payload, _ := json.Marshal(QueueOrder{Login: login, Number: number})
-	timeInFiveMinute := time.Now().Add(5 * time.Minute)
-	msg := &pgq.MessageOutgoing{Payload: payload, ScheduledFor: &timeInFiveMinute, Metadata: map[string]string{"login": login, "number": number}}
-	_, err := publisher.Publish(ctx, queueName, msg)
-	if err != nil {
-		return err
+	return s.Queue.Publish(ctx, QueueOrder{Login: login, Number: number}, time.Now().Add(updateDelay))
+}
+
+func (s *AccrualOrderQueue) EnqueueNewOrders(ctx context.Context, login string, numbers []string) error {
+	orders := make([]QueueOrder, 0, len(numbers))
+	for _, number := range numbers {
+		orders = append(orders, QueueOrder{Login: login, Number: number})
 	}
-	return nil
+	return s.Queue.PublishBatch(ctx, orders, time.Now())
 }
 
 func (s *AccrualOrderQueue) GetOrder(ctx context.Context, number string) (AccrualOrder, error) {
@@ -117,43 +137,74 @@ func (s *AccrualOrderQueue) GetOrder(ctx context.Context, number string) (Accrua
 	if order.Status == orderstorage.Registered {
 		order.Status = orderstorage.New
 	}
+	if err = s.mapProgram(&order); err != nil {
+		return AccrualOrder{}, err
+	}
 	return order, nil
 }
 
-func (s AccrualOrderQueue) HandleMessage(ctx context.Context, msg *pgq.MessageIncoming) (bool, error) {
-	var queueOrder QueueOrder
-	json.Unmarshal(msg.Payload, &queueOrder)
-	order, err := s.getAccrualOrder(ctx, queueOrder.Number)
+// mapProgram assigns accrual to a registered program and rounds it to program precision.
+func (s *AccrualOrderQueue) mapProgram(order *AccrualOrder) error {
+	if order.Program == "" {
+		order.Program = s.AccrualSettings.Program
+	}
+	program, err := s.Programs.Resolve(order.Program)
 	if err != nil {
+		return err
+	}
+	balance, err := order.AccrualBalance()
+	if err != nil {
+		return err
+	}
+	order.Program = program.Code
+	order.Accrual = json.Number(program.Round(balance).String())
+	return nil
+}
+
+// skipInvalidAccrual acknowledges order whose accrual cannot be parsed as redelivery gets the same answer,
+// the order is left as is until it is rechecked.
+func skipInvalidAccrual(number string, err error) (bool, error) {
+	logger.Log.Error("invalid accrual of order", zap.String("order", number), zap.Error(err))
+	return true, nil
+}
+
+func (s *AccrualOrderQueue) HandleOrder(ctx context.Context, queueOrder QueueOrder) (bool, error) {
+	order, err := s.GetOrder(ctx, queueOrder.Number)
+	if errors.Is(err, ErrNoSuchOrder) {
+		// orders uploaded in batches are queued unchecked, unknown ones are rejected here
+		order = AccrualOrder{Order: queueOrder.Number, Status: orderstorage.Invalid}
+	} else if errors.Is(err, ErrInvalidAccrual) {
+		return skipInvalidAccrual(queueOrder.Number, err)
+	} else if err != nil {
 		return false, err
 	}
 	if !orderstorage.IsFinal(order.Status) {
 		s.EnqueueOrderUpdate(ctx, queueOrder.Login, order.Order)
 		return true, nil
 	}
-	var balance currencybalance.CurrencyBalance
-	balance.SetFloat(order.Accrual)
-	s.OrderStorage.UpdateProcessedOrder(ctx,
+	balance, err := order.AccrualBalance()
+	if err != nil {
+		return skipInvalidAccrual(queueOrder.Number, err)
+	}
+	err = s.OrderUpdater.UpdateOrderAccrual(ctx,
 		orderstorage.UserOrder{
 			Login:   queueOrder.Login,
+			Program: order.Program,
 			Balance: balance,
 			Number:  order.Order,
 			Status:  order.Status,
 		})
+	if errors.Is(err, orderstorage.ErrOrderNotFound) {
+		// upload failed to commit after its checks were queued
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
 	return true, nil
 }
 
-func (s AccrualOrderQueue) runUpdateThread(ctx context.Context) error {
-	consumer, err := pgq.NewConsumer(s.DB, queueName, s)
-	if err != nil {
-		return err
-	}
-
-	err = consumer.Run(ctx)
-	if err != nil {
-		return err
-	}
-	return nil
+func (s *AccrualOrderQueue) runUpdateThread(ctx context.Context) error {
+	return s.Queue.Consume(ctx, s.HandleOrder)
 }
 
 func (s *AccrualOrderQueue) runBackgroundUpdate(ctx context.Context) {
@@ -162,10 +213,9 @@ func (s *AccrualOrderQueue) runBackgroundUpdate(ctx context.Context) {
 	}
 }
 
-func NewAccrualOrderQueue(db *sql.DB, updateThreads int, accrualSettings AccrualServiceSettings, orderStorage orderstorage.OrderStorage) *AccrualOrderQueue {
+func NewAccrualOrderQueue(queue OrderQueue, updateThreads int, accrualSettings AccrualServiceSettings, orderUpdater OrderUpdater, registry *programs.Registry) *AccrualOrderQueue {
 	ctx, stop := context.WithCancel(context.Background())
-	ret := &AccrualOrderQueue{DB: db, UpdateThreads: updateThreads, AccrualSettings: accrualSettings, OrderStorage: orderStorage, Stop: stop}
-	ret.Init()
+	ret := &AccrualOrderQueue{Queue: queue, UpdateThreads: updateThreads, AccrualSettings: accrualSettings, OrderUpdater: orderUpdater, Programs: registry, Stop: stop}
 	ret.runBackgroundUpdate(ctx)
 	return ret
 }
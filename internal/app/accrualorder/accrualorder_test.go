@@ -0,0 +1,32 @@
+package accrualorder_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valinurovdenis/gomart/internal/app/accrualorder"
+	"github.com/valinurovdenis/gomart/internal/app/programs"
+	"github.com/valinurovdenis/gomart/mocks"
+)
+
+func TestHandleOrderInvalidAccrual(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"order":"79927398713","status":"PROCESSED","accrual":1e400}`))
+	}))
+	defer server.Close()
+	registry, err := programs.ParseRegistry("points:Gophermart points:2")
+	require.NoError(t, err)
+	queue := &accrualorder.AccrualOrderQueue{
+		AccrualSettings: accrualorder.AccrualServiceSettings{URL: server.URL, Timeout: 1000, Retries: 1},
+		OrderUpdater:    mocks.NewServiceStorage(t),
+		Programs:        registry,
+	}
+
+	// the answer does not change on redelivery, so the job is acknowledged without update
+	ack, err := queue.HandleOrder(context.Background(), accrualorder.QueueOrder{Login: "a", Number: "79927398713"})
+	require.NoError(t, err)
+	require.True(t, ack)
+}
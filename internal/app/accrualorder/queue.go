@@ -0,0 +1,28 @@
+package accrualorder
+
+import (
+	"database/sql"
+
+	"github.com/valinurovdenis/gomart/internal/app/jobqueue"
+)
+
+const queueName = "orders_updater"
+
+type QueueOrder struct {
+	Login  string `json:"login"`
+	Number string `json:"number"`
+}
+
+func (o QueueOrder) Metadata() map[string]string {
+	return map[string]string{"login": o.Login, "number": o.Number}
+}
+
+type OrderQueue = jobqueue.Queue[QueueOrder]
+
+func NewPgqOrderQueue(db *sql.DB) *jobqueue.PgqQueue[QueueOrder] {
+	return jobqueue.NewPgqQueue[QueueOrder](db, queueName)
+}
+
+func NewMemoryOrderQueue() *jobqueue.MemoryQueue[QueueOrder] {
+	return jobqueue.NewMemoryQueue[QueueOrder]()
+}
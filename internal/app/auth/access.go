@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/valinurovdenis/gomart/internal/app/rbac"
+	"github.com/valinurovdenis/gomart/internal/app/userstorage"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+)
+
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+type serviceAccountRequest struct {
+	Name string `json:"name"`
+}
+
+type createdServiceAccount struct {
+	rbac.ServiceAccount
+	APIKey string `json:"api_key"`
+}
+
+// SetUserRole assigns role to user, tokens of the user issued with the previous role are revoked.
+func (a *JwtAuthenticator) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	var request roleRequest
+	if err := validators.DecodeJSON(r.Body, &request); err != nil {
+		validators.WriteError(w, err, validators.ErrorStatus(err))
+		return
+	}
+	role, err := rbac.ParseUserRole(request.Role)
+	if err != nil {
+		validators.WriteError(w, validators.NewFieldError("role", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	err = a.UserStorage.SetRole(r.Context(), chi.URLParam(r, "login"), role)
+
+	if errors.Is(err, userstorage.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateServiceAccount responds with API key of new service account, the key is not stored.
+func (a *JwtAuthenticator) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	var request serviceAccountRequest
+	if err := validators.DecodeJSON(r.Body, &request); err != nil {
+		validators.WriteError(w, err, validators.ErrorStatus(err))
+		return
+	}
+
+	account, key, err := a.ServiceAccounts.Create(r.Context(), request.Name)
+
+	var validationErr *validators.ValidationError
+	if errors.As(err, &validationErr) {
+		validators.WriteError(w, err, http.StatusBadRequest)
+		return
+	} else if errors.Is(err, rbac.ErrServiceAccountExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, createdServiceAccount{ServiceAccount: account, APIKey: key})
+}
+
+func (a *JwtAuthenticator) GetServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	accounts, err := a.ServiceAccounts.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(accounts) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, accounts)
+}
+
+// DeleteServiceAccount revokes API key of service account.
+func (a *JwtAuthenticator) DeleteServiceAccount(w http.ResponseWriter, r *http.Request) {
+	err := a.ServiceAccounts.Delete(r.Context(), chi.URLParam(r, "name"))
+
+	if errors.Is(err, rbac.ErrServiceAccountNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,42 +1,70 @@
 package auth
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-chi/chi"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/valinurovdenis/gomart/internal/app/lockout"
+	"github.com/valinurovdenis/gomart/internal/app/passwordreset"
+	"github.com/valinurovdenis/gomart/internal/app/rbac"
+	"github.com/valinurovdenis/gomart/internal/app/twofactor"
 	"github.com/valinurovdenis/gomart/internal/app/userstorage"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
 )
 
 type Claims struct {
 	jwt.RegisteredClaims
 	Login string
+	// Challenge token only lets user pass the second factor of login.
+	Challenge bool `json:",omitempty"`
+	// TwoFactorAt is time user last confirmed the second factor.
+	TwoFactorAt *jwt.NumericDate `json:",omitempty"`
+	// Version is token version of user when token was issued, changing password revokes older tokens.
+	Version int `json:",omitempty"`
+	// Role of user, tokens issued before roles have none and get User role.
+	Role rbac.Role `json:",omitempty"`
 }
 
 const tokenExpiration = time.Hour * 3
+const challengeExpiration = time.Minute * 5
+
+var ErrInvalidCredentials = errors.New("invalid login or password")
+var ErrTokenRevoked = errors.New("token is revoked")
 
 type JwtAuthenticator struct {
 	SecretKey   string
+	AdminToken  string
 	UserStorage userstorage.UserStorage
+	// Guard limits failed logins and records sessions, optional
+	Guard *lockout.Guard
+	// TwoFactor adds second step to logins of users enabled it, optional
+	TwoFactor *twofactor.TwoFactorService
+	// Reset lets users set password forgotten, optional
+	Reset *passwordreset.ResetService
+	// ServiceAccounts authenticate machine clients of admin api by API keys, optional
+	ServiceAccounts *rbac.ServiceAccountService
 }
 
-func NewAuthenticator(secretKey string, userStorage userstorage.UserStorage) *JwtAuthenticator {
+func NewAuthenticator(secretKey string, adminToken string, userStorage userstorage.UserStorage) *JwtAuthenticator {
 	return &JwtAuthenticator{
 		SecretKey:   secretKey,
+		AdminToken:  adminToken,
 		UserStorage: userStorage,
 	}
 }
 
-func (a *JwtAuthenticator) buildJWTString(login string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExpiration)),
-		},
-		Login: login,
-	})
+func (a *JwtAuthenticator) signClaims(claims Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString([]byte(a.SecretKey))
 	if err != nil {
@@ -46,7 +74,41 @@ func (a *JwtAuthenticator) buildJWTString(login string) (string, error) {
 	return tokenString, nil
 }
 
-func (a *JwtAuthenticator) getLogin(tokenString string) (string, error) {
+// buildJWTString returns session token, twoFactorAt is zero if user did not pass the second factor.
+func (a *JwtAuthenticator) buildJWTString(ctx context.Context, login string, twoFactorAt time.Time) (string, error) {
+	version, err := a.UserStorage.GetTokenVersion(ctx, login)
+	if err != nil {
+		return "", err
+	}
+	role, err := a.UserStorage.GetRole(ctx, login)
+	if err != nil {
+		return "", err
+	}
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExpiration)),
+		},
+		Login:   login,
+		Version: version,
+		Role:    role,
+	}
+	if !twoFactorAt.IsZero() {
+		claims.TwoFactorAt = jwt.NewNumericDate(twoFactorAt)
+	}
+	return a.signClaims(claims)
+}
+
+func (a *JwtAuthenticator) buildChallenge(login string) (string, error) {
+	return a.signClaims(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(challengeExpiration)),
+		},
+		Login:     login,
+		Challenge: true,
+	})
+}
+
+func (a *JwtAuthenticator) parseClaims(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims,
 		func(t *jwt.Token) (interface{}, error) {
@@ -57,18 +119,185 @@ func (a *JwtAuthenticator) getLogin(tokenString string) (string, error) {
 		})
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if !token.Valid {
-		return "", fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	return claims, nil
+}
+
+func (a *JwtAuthenticator) parseSession(tokenString string) (*Claims, error) {
+	claims, err := a.parseClaims(tokenString)
+	if err == nil && claims.Challenge {
+		return nil, fmt.Errorf("challenge token is not a session token")
 	}
+	return claims, err
+}
 
+// ParseToken returns login of the user the session token was issued to.
+func (a *JwtAuthenticator) ParseToken(tokenString string) (string, error) {
+	claims, err := a.parseSession(tokenString)
+	if err != nil {
+		return "", err
+	}
 	return claims.Login, nil
 }
 
-func (a *JwtAuthenticator) setCookie(w http.ResponseWriter, login string) {
-	token, _ := a.buildJWTString(login)
+// ContextWithToken authenticates context with session token not revoked by password change.
+func (a *JwtAuthenticator) ContextWithToken(ctx context.Context, tokenString string) (context.Context, error) {
+	claims, err := a.parseSession(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	version, err := a.UserStorage.GetTokenVersion(ctx, claims.Login)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Version != version {
+		return nil, ErrTokenRevoked
+	}
+	if claims.TwoFactorAt != nil {
+		ctx = twofactor.ContextWithConfirmation(ctx, claims.TwoFactorAt.Time)
+	}
+	role := claims.Role
+	if role == "" {
+		role = rbac.User
+	}
+	return ContextWithRole(ContextWithLogin(ctx, claims.Login), role), nil
+}
+
+// SignUp creates user and returns the user's token.
+func (a *JwtAuthenticator) SignUp(ctx context.Context, loginPassword userstorage.LoginPassword) (string, error) {
+	if err := validators.CredentialsAreValid(loginPassword.Login, loginPassword.Password); err != nil {
+		return "", err
+	}
+	if err := a.UserStorage.AddUser(ctx, loginPassword); err != nil {
+		return "", err
+	}
+	return a.buildJWTString(ctx, loginPassword.Login, time.Time{})
+}
+
+// SignInResult has session token, or challenge token to be exchanged by VerifyLogin
+// if user has enabled the second factor.
+type SignInResult struct {
+	Token     string
+	Challenge string
+}
+
+// SignIn checks user password and returns the user's token, attempts from client are limited by guard.
+func (a *JwtAuthenticator) SignIn(ctx context.Context, loginPassword userstorage.LoginPassword, client lockout.Client) (SignInResult, error) {
+	if loginPassword.Login == "" || loginPassword.Password == "" {
+		return SignInResult{}, validators.NewFieldError("login", "login and password are required")
+	}
+	if a.Guard != nil {
+		if err := a.Guard.Reserve(ctx, loginPassword.Login); err != nil {
+			return SignInResult{}, err
+		}
+	}
+	password, err := a.UserStorage.GetUserPassword(ctx, loginPassword.Login)
+	if errors.Is(err, userstorage.ErrUserNotFound) {
+		return SignInResult{}, a.failed(ctx, loginPassword.Login, client, false)
+	} else if err != nil {
+		return SignInResult{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(password), []byte(loginPassword.Password)) != 1 {
+		return SignInResult{}, a.failed(ctx, loginPassword.Login, client, true)
+	}
+	if a.TwoFactor != nil {
+		enabled, err := a.TwoFactor.IsEnabled(ctx, loginPassword.Login)
+		if err != nil {
+			return SignInResult{}, err
+		}
+		if enabled {
+			if err = a.passed(ctx, loginPassword.Login); err != nil {
+				return SignInResult{}, err
+			}
+			challenge, err := a.buildChallenge(loginPassword.Login)
+			return SignInResult{Challenge: challenge}, err
+		}
+	}
+	token, err := a.signedIn(ctx, loginPassword.Login, client, time.Time{})
+	return SignInResult{Token: token}, err
+}
+
+// VerifyLogin exchanges challenge token and code of the second factor for session token.
+func (a *JwtAuthenticator) VerifyLogin(ctx context.Context, challenge string, code string, client lockout.Client) (string, error) {
+	claims, err := a.parseClaims(challenge)
+	if err != nil || !claims.Challenge || a.TwoFactor == nil {
+		return "", ErrInvalidCredentials
+	}
+	if err = a.verifyCode(ctx, claims.Login, code, client); err != nil {
+		return "", err
+	}
+	return a.signedIn(ctx, claims.Login, client, a.TwoFactor.Clock.Now())
+}
+
+// verifyCode checks code of the second factor, failed codes are limited by guard as failed passwords.
+func (a *JwtAuthenticator) verifyCode(ctx context.Context, login string, code string, client lockout.Client) error {
+	if a.Guard != nil {
+		if err := a.Guard.Reserve(ctx, login); err != nil {
+			return err
+		}
+	}
+	err := a.TwoFactor.Verify(ctx, login, code)
+	if errors.Is(err, twofactor.ErrInvalidCode) && a.Guard != nil {
+		if err := a.Guard.Failed(ctx, login, client, true); err != nil {
+			return err
+		}
+	} else if err == nil || errors.Is(err, twofactor.ErrNotEnrolled) {
+		if err := a.passed(ctx, login); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (a *JwtAuthenticator) signedIn(ctx context.Context, login string, client lockout.Client, twoFactorAt time.Time) (string, error) {
+	if a.Guard != nil {
+		if err := a.Guard.Succeeded(ctx, login, client); err != nil {
+			return "", err
+		}
+	}
+	return a.buildJWTString(ctx, login, twoFactorAt)
+}
+
+// passed takes back attempt which did not fail on credentials and does not log in.
+func (a *JwtAuthenticator) passed(ctx context.Context, login string) error {
+	if a.Guard != nil {
+		return a.Guard.Passed(ctx, login)
+	}
+	return nil
+}
+
+// failed settles failed attempt of existing user or unknown login alike, so that they are not told apart.
+func (a *JwtAuthenticator) failed(ctx context.Context, login string, client lockout.Client, userExists bool) error {
+	if a.Guard != nil {
+		if err := a.Guard.Failed(ctx, login, client, userExists); err != nil {
+			return err
+		}
+	}
+	return ErrInvalidCredentials
+}
+
+// ClientFromRequest returns address of the connection and user agent of request.
+func ClientFromRequest(r *http.Request) lockout.Client {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return lockout.Client{IP: host, UserAgent: r.UserAgent()}
+}
+
+// writeTooManyRequests tells client when guard lets it try again.
+func writeTooManyRequests(w http.ResponseWriter, retryErr *lockout.RetryError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryErr.RetryAfter.Seconds()))))
+	http.Error(w, retryErr.Error(), http.StatusTooManyRequests)
+}
+
+func setCookie(w http.ResponseWriter, token string) {
 	newCookie := http.Cookie{Name: "Authorization", Value: token}
 	http.SetCookie(w, &newCookie)
 	w.WriteHeader(http.StatusOK)
@@ -76,53 +305,183 @@ func (a *JwtAuthenticator) setCookie(w http.ResponseWriter, login string) {
 
 func (a *JwtAuthenticator) Register(w http.ResponseWriter, r *http.Request) {
 	var loginPassword userstorage.LoginPassword
-	if err := json.NewDecoder(r.Body).Decode(&loginPassword); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := validators.DecodeJSON(r.Body, &loginPassword); err != nil {
+		validators.WriteError(w, err, validators.ErrorStatus(err))
 		return
 	}
 
-	if err := a.UserStorage.AddUser(r.Context(), loginPassword); err != nil {
-		if errors.Is(err, userstorage.ErrLoginExists) {
-			http.Error(w, err.Error(), http.StatusConflict)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+	token, err := a.SignUp(r.Context(), loginPassword)
+
+	var validationErr *validators.ValidationError
+	if errors.As(err, &validationErr) {
+		validators.WriteError(w, err, http.StatusBadRequest)
+		return
+	} else if errors.Is(err, userstorage.ErrLoginExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	a.setCookie(w, loginPassword.Login)
+	setCookie(w, token)
 }
 
 func (a *JwtAuthenticator) Login(w http.ResponseWriter, r *http.Request) {
 	var loginPassword userstorage.LoginPassword
-	if err := json.NewDecoder(r.Body).Decode(&loginPassword); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := validators.DecodeJSON(r.Body, &loginPassword); err != nil {
+		validators.WriteError(w, err, validators.ErrorStatus(err))
 		return
 	}
 
-	password, err := a.UserStorage.GetUserPassword(r.Context(), loginPassword.Login)
-	if err != nil || password != loginPassword.Password {
+	result, err := a.SignIn(r.Context(), loginPassword, ClientFromRequest(r))
+
+	var validationErr *validators.ValidationError
+	var retryErr *lockout.RetryError
+	if errors.As(err, &validationErr) {
+		validators.WriteError(w, err, http.StatusBadRequest)
+		return
+	} else if errors.As(err, &retryErr) {
+		writeTooManyRequests(w, retryErr)
+		return
+	} else if errors.Is(err, ErrInvalidCredentials) {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if result.Challenge != "" {
+		writeJSON(w, http.StatusAccepted, challengeResponse{Challenge: result.Challenge, ExpiresIn: int(challengeExpiration.Seconds())})
+		return
+	}
+	setCookie(w, result.Token)
+}
+
+func (a *JwtAuthenticator) GetSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := a.Guard.GetSessions(r.Context(), r.Header.Get("Login"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(sessions) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// UnlockUser clears failed attempts and lock of user.
+func (a *JwtAuthenticator) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	login := chi.URLParam(r, "login")
+	_, err := a.UserStorage.GetUserPassword(r.Context(), login)
+	if err == nil {
+		err = a.Guard.Unlock(r.Context(), login)
+	}
+
+	if errors.Is(err, userstorage.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	a.setCookie(w, loginPassword.Login)
+	w.WriteHeader(http.StatusNoContent)
 }
 
+type loginKey struct{}
+type roleKey struct{}
+
+// ContextWithLogin stores authenticated login for handlers not using http headers.
+func ContextWithLogin(ctx context.Context, login string) context.Context {
+	return context.WithValue(ctx, loginKey{}, login)
+}
+
+func LoginFromContext(ctx context.Context) (string, bool) {
+	login, ok := ctx.Value(loginKey{}).(string)
+	return login, ok && login != ""
+}
+
+// ContextWithRole stores role of authenticated identity checked by Require.
+func ContextWithRole(ctx context.Context, role rbac.Role) context.Context {
+	return context.WithValue(ctx, roleKey{}, role)
+}
+
+func RoleFromContext(ctx context.Context) rbac.Role {
+	role, _ := ctx.Value(roleKey{}).(rbac.Role)
+	return role
+}
+
+func (a *JwtAuthenticator) contextWithCookie(r *http.Request) (context.Context, error) {
+	cookie, err := r.Cookie("Authorization")
+	if err != nil {
+		return nil, err
+	}
+	return a.ContextWithToken(r.Context(), cookie.Value)
+}
+
+// contextWithBearer authenticates configured admin token with Admin role or API key of service account.
+func (a *JwtAuthenticator) contextWithBearer(ctx context.Context, token string) (context.Context, error) {
+	if a.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.AdminToken)) == 1 {
+		return ContextWithRole(ctx, rbac.Admin), nil
+	}
+	if a.ServiceAccounts == nil {
+		return nil, ErrInvalidCredentials
+	}
+	account, err := a.ServiceAccounts.Authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return ContextWithRole(ContextWithLogin(ctx, "service:"+account.Name), rbac.Service), nil
+}
+
+func serveAuthenticated(ctx context.Context, err error, h http.Handler, w http.ResponseWriter, r *http.Request) {
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	login, _ := LoginFromContext(ctx)
+	r.Header.Set("Login", login)
+
+	h.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// Authenticate allows requests with session token of user in Authorization cookie.
 func (a *JwtAuthenticator) Authenticate(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("Authorization")
-		var login string
-		if err == nil {
-			login, err = a.getLogin(cookie.Value)
-		}
+		ctx, err := a.contextWithCookie(r)
+		serveAuthenticated(ctx, err, h, w, r)
+	})
+}
 
-		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
+// AuthenticateAdmin allows requests bearing configured admin token or API key of service account,
+// or session token of user, routes check permissions of their role by Require.
+func (a *JwtAuthenticator) AuthenticateAdmin(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ctx context.Context
+		var err error
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			ctx, err = a.contextWithBearer(r.Context(), token)
+		} else {
+			ctx, err = a.contextWithCookie(r)
 		}
-		r.Header.Set("Login", login)
-
-		h.ServeHTTP(w, r)
+		serveAuthenticated(ctx, err, h, w, r)
 	})
 }
+
+// Require allows authenticated requests whose role has permission.
+func (a *JwtAuthenticator) Require(permission rbac.Permission) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !RoleFromContext(r.Context()).Can(permission) {
+				http.Error(w, "role has no permission "+string(permission), http.StatusForbidden)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
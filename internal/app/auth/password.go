@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/valinurovdenis/gomart/internal/app/lockout"
+	"github.com/valinurovdenis/gomart/internal/app/passwordreset"
+	"github.com/valinurovdenis/gomart/internal/app/twofactor"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+)
+
+type changePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type resetRequest struct {
+	Login string `json:"login"`
+}
+
+type resetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// ChangePassword sets new password of user after checking the old one, failed checks are limited
+// by guard as failed logins. It returns new token of the current session, other sessions are revoked.
+func (a *JwtAuthenticator) ChangePassword(ctx context.Context, login string, oldPassword string, newPassword string, client lockout.Client) (string, error) {
+	if err := validators.PasswordIsValid("new_password", newPassword); err != nil {
+		return "", err
+	}
+	if a.Guard != nil {
+		if err := a.Guard.Reserve(ctx, login); err != nil {
+			return "", err
+		}
+	}
+	password, err := a.UserStorage.GetUserPassword(ctx, login)
+	if err != nil {
+		return "", err
+	}
+	if subtle.ConstantTimeCompare([]byte(password), []byte(oldPassword)) != 1 {
+		return "", a.failed(ctx, login, client, true)
+	}
+	if err = a.passed(ctx, login); err != nil {
+		return "", err
+	}
+	if newPassword == oldPassword {
+		return "", validators.NewFieldError("new_password", "must differ from the old password")
+	}
+	if err = a.UserStorage.SetPassword(ctx, login, newPassword); err != nil {
+		return "", err
+	}
+	return a.buildJWTString(ctx, login, twofactor.ConfirmedAt(ctx))
+}
+
+// ResetPassword sets new password by reset token, sessions of user are revoked and the login is unlocked.
+func (a *JwtAuthenticator) ResetPassword(ctx context.Context, token string, password string) error {
+	login, err := a.Reset.Reset(ctx, token, password)
+	if err == nil && a.Guard != nil {
+		err = a.Guard.Unlock(ctx, login)
+	}
+	return err
+}
+
+func (a *JwtAuthenticator) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var request changePasswordRequest
+	if err := validators.DecodeJSON(r.Body, &request); err != nil {
+		validators.WriteError(w, err, validators.ErrorStatus(err))
+		return
+	}
+
+	token, err := a.ChangePassword(r.Context(), r.Header.Get("Login"), request.OldPassword, request.NewPassword, ClientFromRequest(r))
+
+	var validationErr *validators.ValidationError
+	var retryErr *lockout.RetryError
+	if errors.As(err, &validationErr) {
+		validators.WriteError(w, err, http.StatusBadRequest)
+		return
+	} else if errors.As(err, &retryErr) {
+		writeTooManyRequests(w, retryErr)
+		return
+	} else if errors.Is(err, ErrInvalidCredentials) {
+		http.Error(w, "invalid old password", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, token)
+}
+
+// RequestPasswordReset always accepts request so that existing logins are not told apart.
+func (a *JwtAuthenticator) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var request resetRequest
+	if err := validators.DecodeJSON(r.Body, &request); err != nil {
+		validators.WriteError(w, err, validators.ErrorStatus(err))
+		return
+	}
+	if request.Login == "" {
+		validators.WriteError(w, validators.NewFieldError("login", "must not be empty"), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.Reset.Request(r.Context(), request.Login); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *JwtAuthenticator) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var request resetPasswordRequest
+	if err := validators.DecodeJSON(r.Body, &request); err != nil {
+		validators.WriteError(w, err, validators.ErrorStatus(err))
+		return
+	}
+	if request.Token == "" {
+		validators.WriteError(w, validators.NewFieldError("token", "must not be empty"), http.StatusBadRequest)
+		return
+	}
+
+	err := a.ResetPassword(r.Context(), request.Token, request.NewPassword)
+
+	var validationErr *validators.ValidationError
+	if errors.As(err, &validationErr) {
+		validators.WriteError(w, err, http.StatusBadRequest)
+		return
+	} else if errors.Is(err, passwordreset.ErrInvalidToken) {
+		validators.WriteError(w, validators.NewFieldError("token", err.Error()), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
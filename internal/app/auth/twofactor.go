@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/valinurovdenis/gomart/internal/app/lockout"
+	"github.com/valinurovdenis/gomart/internal/app/twofactor"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+)
+
+type challengeResponse struct {
+	Challenge string `json:"challenge_token"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+type verifyLoginRequest struct {
+	Challenge string `json:"challenge_token"`
+	Code      string `json:"code"`
+}
+
+type codeRequest struct {
+	Code string `json:"code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeCodeError maps errors of checking code of the second factor.
+func writeCodeError(w http.ResponseWriter, err error) {
+	var retryErr *lockout.RetryError
+	if errors.As(err, &retryErr) {
+		writeTooManyRequests(w, retryErr)
+	} else if errors.Is(err, twofactor.ErrInvalidCode) {
+		validators.WriteError(w, validators.NewFieldError("code", err.Error()), http.StatusBadRequest)
+	} else if errors.Is(err, twofactor.ErrNotEnrolled) || errors.Is(err, twofactor.ErrAlreadyEnabled) {
+		http.Error(w, err.Error(), http.StatusConflict)
+	} else {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func decodeCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var request codeRequest
+	if err := validators.DecodeJSON(r.Body, &request); err != nil {
+		validators.WriteError(w, err, validators.ErrorStatus(err))
+		return "", false
+	}
+	if request.Code == "" {
+		validators.WriteError(w, validators.NewFieldError("code", "must not be empty"), http.StatusBadRequest)
+		return "", false
+	}
+	return request.Code, true
+}
+
+// VerifyLoginHandler is the second step of login of users with enabled second factor.
+func (a *JwtAuthenticator) VerifyLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var request verifyLoginRequest
+	if err := validators.DecodeJSON(r.Body, &request); err != nil {
+		validators.WriteError(w, err, validators.ErrorStatus(err))
+		return
+	}
+	if request.Challenge == "" || request.Code == "" {
+		validators.WriteError(w, validators.NewFieldError("code", "challenge_token and code are required"), http.StatusBadRequest)
+		return
+	}
+
+	token, err := a.VerifyLogin(r.Context(), request.Challenge, request.Code, ClientFromRequest(r))
+
+	if errors.Is(err, ErrInvalidCredentials) || errors.Is(err, twofactor.ErrInvalidCode) || errors.Is(err, twofactor.ErrNotEnrolled) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		writeCodeError(w, err)
+		return
+	}
+
+	setCookie(w, token)
+}
+
+// EnrollTwoFactor returns new secret, second factor is enabled after its first code is verified.
+func (a *JwtAuthenticator) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	enrollment, err := a.TwoFactor.Enroll(r.Context(), r.Header.Get("Login"))
+	if err != nil {
+		writeCodeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, enrollment)
+}
+
+func (a *JwtAuthenticator) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := a.TwoFactor.Enable(r.Context(), r.Header.Get("Login"), code)
+	if err != nil {
+		writeCodeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// ConfirmTwoFactor sets token of fresh confirmation of the second factor required by sensitive operations.
+func (a *JwtAuthenticator) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+	login := r.Header.Get("Login")
+
+	err := a.verifyCode(r.Context(), login, code, ClientFromRequest(r))
+	var token string
+	if err == nil {
+		token, err = a.buildJWTString(r.Context(), login, a.TwoFactor.Clock.Now())
+	}
+	if err != nil {
+		writeCodeError(w, err)
+		return
+	}
+
+	setCookie(w, token)
+}
+
+func (a *JwtAuthenticator) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+	login := r.Header.Get("Login")
+
+	err := a.verifyCode(r.Context(), login, code, ClientFromRequest(r))
+	if err == nil {
+		err = a.TwoFactor.Disable(r.Context(), login)
+	}
+	if err != nil {
+		writeCodeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,26 @@
+package clock
+
+import "time"
+
+type Clock interface {
+	Now() time.Time
+}
+
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// FixedClock always returns the stored time, useful in tests.
+type FixedClock struct {
+	Time time.Time
+}
+
+func (c *FixedClock) Now() time.Time {
+	return c.Time
+}
+
+func (c *FixedClock) Advance(d time.Duration) {
+	c.Time = c.Time.Add(d)
+}
@@ -1,19 +1,53 @@
 package currencybalance
 
 import (
-	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
 )
 
+// Precision is the number of decimal places stored in minor units.
+const Precision = 2
+
+const minorUnits = 100
+
+type RoundingMode int
+
+const (
+	// RoundExact rejects values which can not be stored without rounding.
+	RoundExact RoundingMode = iota
+	// RoundDown truncates extra digits towards zero.
+	RoundDown
+	// RoundHalfUp rounds half away from zero.
+	RoundHalfUp
+	// RoundHalfEven rounds half to the nearest even minor unit.
+	RoundHalfEven
+)
+
+var ErrInvalidNumber = errors.New("invalid decimal number")
+var ErrTooPrecise = errors.New("amount has more than 2 decimal places")
+var ErrOverflow = errors.New("amount overflows balance")
+
 type CurrencyBalance struct {
 	Balance int64
 }
 
 func (s *CurrencyBalance) GetFloat() float64 {
-	return float64(s.Balance) / 100
+	return float64(s.Balance) / minorUnits
 }
 
-func (s *CurrencyBalance) SetFloat(value float64) {
-	s.Balance = int64(value * 100)
+// SetFloat stores the shortest decimal representation of value rounding half to even.
+func (s *CurrencyBalance) SetFloat(value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return ErrInvalidNumber
+	}
+	parsed, err := Parse(strconv.FormatFloat(value, 'f', -1, 64), RoundHalfEven)
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
 }
 
 func (s *CurrencyBalance) IsNegative() bool {
@@ -24,23 +58,168 @@ func (s *CurrencyBalance) Less(other CurrencyBalance) bool {
 	return s.Balance < other.Balance
 }
 
-func (s *CurrencyBalance) Withdraw(other CurrencyBalance) {
-	s.Balance -= other.Balance
+func (s *CurrencyBalance) Withdraw(other CurrencyBalance) error {
+	diff := s.Balance - other.Balance
+	if (other.Balance > 0 && diff > s.Balance) || (other.Balance < 0 && diff < s.Balance) {
+		return ErrOverflow
+	}
+	s.Balance = diff
+	return nil
+}
+
+func (s *CurrencyBalance) Add(other CurrencyBalance) error {
+	sum := s.Balance + other.Balance
+	if (other.Balance > 0 && sum < s.Balance) || (other.Balance < 0 && sum > s.Balance) {
+		return ErrOverflow
+	}
+	s.Balance = sum
+	return nil
+}
+
+// Parse converts a decimal json number into minor units without going through float.
+func Parse(value string, mode RoundingMode) (CurrencyBalance, error) {
+	negative, digits, exponent, err := splitNumber(value)
+	if err != nil {
+		return CurrencyBalance{}, err
+	}
+
+	limit := uint64(math.MaxInt64)
+	if negative {
+		limit++
+	}
+
+	shift := exponent + Precision
+	var kept, dropped string
+	switch {
+	case shift >= 0 && digits == "":
+		kept = ""
+	case shift >= 0:
+		if shift > 19 {
+			return CurrencyBalance{}, ErrOverflow
+		}
+		kept = digits + strings.Repeat("0", shift)
+	case -shift == len(digits):
+		dropped = digits
+	case -shift > len(digits):
+		dropped = "0" + digits
+	default:
+		kept, dropped = digits[:len(digits)+shift], digits[len(digits)+shift:]
+	}
+
+	magnitude, err := parseMagnitude(kept, limit)
+	if err != nil {
+		return CurrencyBalance{}, err
+	}
+	if roundsUp, err := mode.roundsUp(magnitude, dropped); err != nil {
+		return CurrencyBalance{}, err
+	} else if roundsUp {
+		if magnitude == limit {
+			return CurrencyBalance{}, ErrOverflow
+		}
+		magnitude++
+	}
+
+	if negative {
+		return CurrencyBalance{Balance: int64(-magnitude)}, nil
+	}
+	return CurrencyBalance{Balance: int64(magnitude)}, nil
+}
+
+// splitNumber returns sign, significant digits without leading zeros and
+// decimal exponent of the number so that value = digits * 10^exponent.
+func splitNumber(value string) (bool, string, int, error) {
+	negative := strings.HasPrefix(value, "-")
+	mantissa, exponentPart, hasExponent := strings.Cut(strings.ToLower(strings.TrimPrefix(value, "-")), "e")
+
+	exponent := int64(0)
+	if hasExponent {
+		var err error
+		// out of range exponents are clamped, which is enough to detect overflow or rounding
+		exponent, err = strconv.ParseInt(exponentPart, 10, 32)
+		if err != nil && !errors.Is(err, strconv.ErrRange) {
+			return false, "", 0, ErrInvalidNumber
+		}
+	}
+
+	whole, fraction, hasFraction := strings.Cut(mantissa, ".")
+	if whole == "" || (hasFraction && fraction == "") || !isDigits(whole) || !isDigits(fraction) {
+		return false, "", 0, ErrInvalidNumber
+	}
+	digits := strings.TrimLeft(whole+fraction, "0")
+	return negative, digits, int(exponent) - len(fraction), nil
+}
+
+func isDigits(value string) bool {
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func parseMagnitude(digits string, limit uint64) (uint64, error) {
+	var magnitude uint64
+	for _, c := range digits {
+		digit := uint64(c - '0')
+		if magnitude > (limit-digit)/10 {
+			return 0, ErrOverflow
+		}
+		magnitude = magnitude*10 + digit
+	}
+	return magnitude, nil
+}
+
+func (mode RoundingMode) roundsUp(kept uint64, dropped string) (bool, error) {
+	rest := strings.TrimRight(dropped, "0")
+	if rest == "" {
+		return false, nil
+	}
+	switch mode {
+	case RoundDown:
+		return false, nil
+	case RoundHalfUp:
+		return rest[0] >= '5', nil
+	case RoundHalfEven:
+		if rest[0] != '5' {
+			return rest[0] > '5', nil
+		}
+		return len(rest) > 1 || kept%2 == 1, nil
+	default:
+		return false, ErrTooPrecise
+	}
 }
 
-func (s *CurrencyBalance) Add(other CurrencyBalance) {
-	s.Balance += other.Balance
+func (s CurrencyBalance) String() string {
+	magnitude := uint64(s.Balance)
+	if s.Balance < 0 {
+		magnitude = uint64(-s.Balance)
+	}
+	var result strings.Builder
+	if s.Balance < 0 {
+		result.WriteByte('-')
+	}
+	result.WriteString(strconv.FormatUint(magnitude/minorUnits, 10))
+	if fraction := magnitude % minorUnits; fraction != 0 {
+		fractionStr := strconv.FormatUint(fraction+minorUnits, 10)[1:]
+		result.WriteByte('.')
+		result.WriteString(strings.TrimRight(fractionStr, "0"))
+	}
+	return result.String()
 }
 
 func (s CurrencyBalance) MarshalJSON() ([]byte, error) {
-	return json.Marshal(s.GetFloat())
+	return []byte(s.String()), nil
 }
 
 func (s *CurrencyBalance) UnmarshalJSON(data []byte) error {
-	var floatValue float64
-	if err := json.Unmarshal(data, &floatValue); err != nil {
+	if string(data) == "null" {
+		return nil
+	}
+	parsed, err := Parse(string(data), RoundExact)
+	if err != nil {
 		return err
 	}
-	s.SetFloat(floatValue)
+	*s = parsed
 	return nil
 }
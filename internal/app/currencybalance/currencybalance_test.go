@@ -0,0 +1,138 @@
+package currencybalance
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		mode  RoundingMode
+		want  int64
+		err   error
+	}{
+		{name: "integer", value: "500", mode: RoundExact, want: 50000},
+		{name: "cents without float error", value: "0.29", mode: RoundExact, want: 29},
+		{name: "one decimal", value: "500.5", mode: RoundExact, want: 50050},
+		{name: "negative", value: "-1.05", mode: RoundExact, want: -105},
+		{name: "exponent", value: "1.5e2", mode: RoundExact, want: 15000},
+		{name: "negative exponent", value: "100e-4", mode: RoundExact, want: 1},
+		{name: "trailing zeros are exact", value: "1.2300", mode: RoundExact, want: 123},
+		{name: "too precise", value: "1.005", mode: RoundExact, err: ErrTooPrecise},
+		{name: "round down", value: "1.009", mode: RoundDown, want: 100},
+		{name: "round half up", value: "1.005", mode: RoundHalfUp, want: 101},
+		{name: "round half up negative", value: "-1.005", mode: RoundHalfUp, want: -101},
+		{name: "round half even down", value: "1.025", mode: RoundHalfEven, want: 102},
+		{name: "round half even up", value: "1.035", mode: RoundHalfEven, want: 104},
+		{name: "round half even above half", value: "1.0251", mode: RoundHalfEven, want: 103},
+		{name: "tiny value", value: "1e-400", mode: RoundHalfUp, want: 0},
+		{name: "max", value: "92233720368547758.07", mode: RoundExact, want: math.MaxInt64},
+		{name: "min", value: "-92233720368547758.08", mode: RoundExact, want: math.MinInt64},
+		{name: "overflow", value: "92233720368547758.08", mode: RoundExact, err: ErrOverflow},
+		{name: "rounding overflow", value: "92233720368547758.075", mode: RoundHalfUp, err: ErrOverflow},
+		{name: "huge exponent", value: "1e400", mode: RoundExact, err: ErrOverflow},
+		{name: "empty", value: "", mode: RoundExact, err: ErrInvalidNumber},
+		{name: "no integer part", value: ".5", mode: RoundExact, err: ErrInvalidNumber},
+		{name: "no fraction digits", value: "5.", mode: RoundExact, err: ErrInvalidNumber},
+		{name: "string", value: `"5"`, mode: RoundExact, err: ErrInvalidNumber},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.value, tt.mode)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got.Balance)
+		})
+	}
+}
+
+func TestSetFloat(t *testing.T) {
+	var balance CurrencyBalance
+	require.NoError(t, balance.SetFloat(0.29))
+	require.Equal(t, int64(29), balance.Balance)
+	require.ErrorIs(t, balance.SetFloat(math.NaN()), ErrInvalidNumber)
+	require.ErrorIs(t, balance.SetFloat(1e300), ErrOverflow)
+}
+
+func TestAddWithdrawOverflow(t *testing.T) {
+	balance := CurrencyBalance{Balance: math.MaxInt64}
+	require.ErrorIs(t, balance.Add(CurrencyBalance{Balance: 1}), ErrOverflow)
+	require.Equal(t, int64(math.MaxInt64), balance.Balance)
+
+	balance = CurrencyBalance{Balance: math.MinInt64}
+	require.ErrorIs(t, balance.Withdraw(CurrencyBalance{Balance: 1}), ErrOverflow)
+	require.ErrorIs(t, balance.Add(CurrencyBalance{Balance: -1}), ErrOverflow)
+
+	balance = CurrencyBalance{Balance: 100}
+	require.NoError(t, balance.Withdraw(CurrencyBalance{Balance: 150}))
+	require.Equal(t, int64(-50), balance.Balance)
+	require.NoError(t, balance.Add(CurrencyBalance{Balance: 75}))
+	require.Equal(t, int64(25), balance.Balance)
+}
+
+func TestMarshalJSON(t *testing.T) {
+	tests := []struct {
+		balance int64
+		want    string
+	}{
+		{balance: 50000, want: "500"},
+		{balance: 50050, want: "500.5"},
+		{balance: 29, want: "0.29"},
+		{balance: -5, want: "-0.05"},
+		{balance: 0, want: "0"},
+		{balance: math.MinInt64, want: "-92233720368547758.08"},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(CurrencyBalance{Balance: tt.balance})
+		require.NoError(t, err)
+		require.Equal(t, tt.want, string(data))
+	}
+}
+
+func FuzzMarshalRoundTrip(f *testing.F) {
+	for _, seed := range []int64{0, 1, -1, 29, 50050, math.MaxInt64, math.MinInt64} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, value int64) {
+		data, err := json.Marshal(CurrencyBalance{Balance: value})
+		require.NoError(t, err)
+		var parsed CurrencyBalance
+		require.NoError(t, json.Unmarshal(data, &parsed))
+		require.Equal(t, value, parsed.Balance)
+	})
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{"0", "0.29", "-1.005", "1e2", "1.5E-1", "92233720368547758.07", "abc", "1e-400"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		parsed, err := Parse(value, RoundExact)
+		if err != nil {
+			return
+		}
+		reparsed, err := Parse(parsed.String(), RoundExact)
+		require.NoError(t, err)
+		require.Equal(t, parsed, reparsed)
+
+		// zeros may carry huge exponents which are too slow for big.Rat
+		if parsed.Balance == 0 {
+			return
+		}
+		// exact parse must agree with arbitrary precision arithmetic
+		expected, ok := new(big.Rat).SetString(value)
+		require.True(t, ok, value)
+		expected.Mul(expected, big.NewRat(minorUnits, 1))
+		require.True(t, expected.IsInt(), value)
+		require.Equal(t, expected.Num().String(), big.NewInt(parsed.Balance).String(), value)
+	})
+}
@@ -0,0 +1,89 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+)
+
+// Broker wakes event streams of a user when new events of the user are committed.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{}
+}
+
+// Subscribe returns channel receiving a signal after new events, signals are coalesced
+// so the subscriber should read every event stored after the last one it has seen.
+func (b *Broker) Subscribe(login string) (<-chan struct{}, func()) {
+	wake := make(chan struct{}, 1)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[login] == nil {
+		b.subscribers[login] = make(map[chan struct{}]struct{})
+	}
+	b.subscribers[login][wake] = struct{}{}
+	return wake, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers[login], wake)
+		if len(b.subscribers[login]) == 0 {
+			delete(b.subscribers, login)
+		}
+	}
+}
+
+func signal(wake chan struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+func (b *Broker) Notify(login string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for wake := range b.subscribers[login] {
+		signal(wake)
+	}
+}
+
+// NotifyAll wakes every stream, used when notifications could have been missed.
+func (b *Broker) NotifyAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, subscribers := range b.subscribers {
+		for wake := range subscribers {
+			signal(wake)
+		}
+	}
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: make(map[string]map[chan struct{}]struct{})}
+}
+
+// EventStream serves events of a user from the event log waking up on broker notifications.
+type EventStream struct {
+	Log       outbox.EventLog
+	Broker    *Broker
+	Heartbeat time.Duration
+	BatchSize int
+}
+
+func (s *EventStream) Subscribe(login string) (<-chan struct{}, func()) {
+	return s.Broker.Subscribe(login)
+}
+
+func (s *EventStream) GetEvents(ctx context.Context, login string, afterID int64) ([]outbox.Event, error) {
+	return s.Log.GetUserEvents(ctx, login, afterID, s.BatchSize)
+}
+
+func (s *EventStream) GetLastEventID(ctx context.Context, login string) (int64, error) {
+	return s.Log.GetLastUserEventID(ctx, login)
+}
+
+func NewEventStream(log outbox.EventLog, broker *Broker, heartbeat time.Duration) *EventStream {
+	return &EventStream{Log: log, Broker: broker, Heartbeat: heartbeat, BatchSize: 100}
+}
@@ -0,0 +1,64 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valinurovdenis/gomart/internal/app/logger"
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"go.uber.org/zap"
+)
+
+const reconnectDelay = time.Second
+
+// PgListener forwards notifications of outbox events committed by any replica to broker.
+type PgListener struct {
+	Pool   *pgxpool.Pool
+	Broker *Broker
+	Stop   func()
+}
+
+// listen holds a dedicated connection, pooled connections can't wait for notifications.
+func (l *PgListener) listen(ctx context.Context) error {
+	conn, err := pgx.ConnectConfig(ctx, l.Pool.Config().ConnConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if _, err = conn.Exec(ctx, "LISTEN "+outbox.EventsChannel); err != nil {
+		return err
+	}
+	// events committed while reconnecting were not notified
+	l.Broker.NotifyAll()
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		l.Broker.Notify(notification.Payload)
+	}
+}
+
+func (l *PgListener) run(ctx context.Context) {
+	for {
+		err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Log.Error("events listener disconnected", zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func NewPgListener(pool *pgxpool.Pool, broker *Broker) *PgListener {
+	ctx, stop := context.WithCancel(context.Background())
+	ret := &PgListener{Pool: pool, Broker: broker, Stop: stop}
+	go ret.run(ctx)
+	return ret
+}
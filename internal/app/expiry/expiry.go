@@ -0,0 +1,102 @@
+package expiry
+
+import (
+	"context"
+	"time"
+
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/logger"
+	"github.com/valinurovdenis/gomart/internal/app/lotstorage"
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"github.com/valinurovdenis/gomart/internal/app/programs"
+	"github.com/valinurovdenis/gomart/internal/app/txmanager"
+	"github.com/valinurovdenis/gomart/internal/app/userstorage"
+	"go.uber.org/zap"
+)
+
+type Expirer struct {
+	LotStorage     lotstorage.LotStorage
+	BalanceStorage userstorage.BalanceStorage
+	TxManager      txmanager.TxManager
+	Outbox         outbox.OutboxStorage
+	Programs       *programs.Registry
+	Clock          clock.Clock
+	Interval       time.Duration
+	Stop           func()
+}
+
+// ExpireDue expires lots of every program with expiry policy which are older than policy allows.
+func (e *Expirer) ExpireDue(ctx context.Context) ([]lotstorage.Expiration, error) {
+	now := e.Clock.Now()
+	var res []lotstorage.Expiration
+	for _, program := range e.Programs.List() {
+		if !program.Expiry.Expires() {
+			continue
+		}
+		expirations, err := e.expireProgram(ctx, program.Code, program.Expiry.Cutoff(now), now)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, expirations...)
+	}
+	return res, nil
+}
+
+// expireProgram expires lots, debits expired points from balances and records events in one unit of work.
+func (e *Expirer) expireProgram(ctx context.Context, program string, cutoff time.Time, now time.Time) ([]lotstorage.Expiration, error) {
+	var expirations []lotstorage.Expiration
+	err := e.TxManager.Do(ctx, func(ctx context.Context) error {
+		var err error
+		expirations, err = e.LotStorage.ExpireLots(ctx, program, cutoff, now)
+		if err != nil {
+			return err
+		}
+		for _, expiration := range expirations {
+			debit := currencybalance.CurrencyBalance{Balance: -expiration.Amount.Balance}
+			if err = e.BalanceStorage.AddBalance(ctx, expiration.Login, expiration.Program, debit); err != nil {
+				return err
+			}
+			event, err := outbox.NewEvent(outbox.PointsExpired, expiration.Login,
+				outbox.PointsExpiredData{Program: expiration.Program, Amount: expiration.Amount})
+			if err != nil {
+				return err
+			}
+			if err = e.Outbox.AddEvent(ctx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expirations, nil
+}
+
+func (e *Expirer) runBackgroundExpiry(ctx context.Context) {
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+	for {
+		expirations, err := e.ExpireDue(ctx)
+		if err != nil {
+			logger.Log.Error("failed to expire points", zap.Error(err))
+		} else if len(expirations) > 0 {
+			logger.Log.Info("expired points", zap.Int("balances", len(expirations)))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func NewExpirer(lotStorage lotstorage.LotStorage, balanceStorage userstorage.BalanceStorage, txManager txmanager.TxManager,
+	outboxStorage outbox.OutboxStorage, registry *programs.Registry, clock clock.Clock, interval time.Duration) *Expirer {
+	ctx, stop := context.WithCancel(context.Background())
+	ret := &Expirer{LotStorage: lotStorage, BalanceStorage: balanceStorage, TxManager: txManager, Outbox: outboxStorage,
+		Programs: registry, Clock: clock, Interval: interval, Stop: stop}
+	go ret.runBackgroundExpiry(ctx)
+	return ret
+}
@@ -0,0 +1,56 @@
+package expiry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/lotstorage"
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"github.com/valinurovdenis/gomart/internal/app/programs"
+	"github.com/valinurovdenis/gomart/mocks"
+)
+
+func TestExpirer_ExpireDue(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := mocks.NewLotStorage(t)
+	mockBalances := mocks.NewBalanceStorage(t)
+	mockTx := mocks.NewTxManager(t)
+	mockOutbox := mocks.NewOutboxStorage(t)
+	mockTx.On("Do", ctx, mock.Anything).Return(func(ctx context.Context, fn func(context.Context) error) error {
+		return fn(ctx)
+	})
+	registry, err := programs.ParseRegistry("points:Gophermart points:2:6;miles:Gopher miles:0;stars:Stars:2:1")
+	require.NoError(t, err)
+	testClock := &clock.FixedClock{Time: time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)}
+	expirer := &Expirer{LotStorage: mockStorage, BalanceStorage: mockBalances, TxManager: mockTx, Outbox: mockOutbox, Programs: registry, Clock: testClock}
+
+	pointsExpiration := lotstorage.Expiration{Login: "a", Program: "points", Amount: currencybalance.CurrencyBalance{Balance: 500}, Expired: testClock.Time}
+	mockStorage.On("ExpireLots", ctx, "points", time.Date(2023, time.September, 10, 0, 0, 0, 0, time.UTC), testClock.Time).
+		Return([]lotstorage.Expiration{pointsExpiration}, nil).Once()
+	mockStorage.On("ExpireLots", ctx, "stars", time.Date(2024, time.February, 10, 0, 0, 0, 0, time.UTC), testClock.Time).
+		Return(nil, nil).Once()
+	mockBalances.On("AddBalance", ctx, "a", "points", currencybalance.CurrencyBalance{Balance: -500}).Return(nil).Once()
+	mockOutbox.On("AddEvent", ctx, mock.MatchedBy(func(event outbox.Event) bool {
+		return event.Type == outbox.PointsExpired && event.Login == "a"
+	})).Return(nil).Once()
+
+	expirations, err := expirer.ExpireDue(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []lotstorage.Expiration{pointsExpiration}, expirations)
+
+	// a month later cutoffs move with the clock
+	testClock.Advance(31 * 24 * time.Hour)
+	mockStorage.On("ExpireLots", ctx, "points", time.Date(2023, time.October, 10, 0, 0, 0, 0, time.UTC), testClock.Time).
+		Return(nil, nil).Once()
+	mockStorage.On("ExpireLots", ctx, "stars", time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC), testClock.Time).
+		Return(nil, nil).Once()
+
+	expirations, err = expirer.ExpireDue(ctx)
+	require.NoError(t, err)
+	require.Empty(t, expirations)
+}
@@ -0,0 +1,68 @@
+package grpcapi
+
+import (
+	"context"
+	"expvar"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/valinurovdenis/gomart/internal/app/logger"
+	pb "github.com/valinurovdenis/gomart/pkg/gophermartpb"
+)
+
+// Metrics counts calls by "<method> <code>" and sums their durations in microseconds by "<method> duration_us",
+// published with expvar as "grpc".
+var Metrics = expvar.NewMap("grpc")
+
+var publicMethods = map[string]bool{
+	pb.Gophermart_Register_FullMethodName:    true,
+	pb.Gophermart_Login_FullMethodName:       true,
+	pb.Gophermart_VerifyLogin_FullMethodName: true,
+}
+
+// AuthInterceptor puts login of "authorization: Bearer <token>" metadata into call context,
+// calls other than Register, Login and VerifyLogin are rejected without it.
+func (s *Server) AuthInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if publicMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+	}
+	ctx, err := s.Auth.ContextWithToken(ctx, token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return handler(ctx, req)
+}
+
+func LoggingInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logger.Log.Info("got incoming gRPC request",
+		zap.String("method", info.FullMethod),
+		zap.String("code", status.Code(err).String()),
+		zap.Duration("duration", time.Since(start)),
+	)
+	return resp, err
+}
+
+func MetricsInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	Metrics.Add(info.FullMethod+" "+status.Code(err).String(), 1)
+	Metrics.Add(info.FullMethod+" duration_us", time.Since(start).Microseconds())
+	return resp, err
+}
@@ -0,0 +1,310 @@
+// Package grpcapi serves the user API over gRPC with the same service layer and tokens as http handlers.
+package grpcapi
+
+//go:generate protoc -I ../../../api --go_out=../../.. --go_opt=module=github.com/valinurovdenis/gomart --go-grpc_out=../../.. --go-grpc_opt=module=github.com/valinurovdenis/gomart gophermart/v1/gophermart.proto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/valinurovdenis/gomart/internal/app/accrualorder"
+	"github.com/valinurovdenis/gomart/internal/app/auth"
+	"github.com/valinurovdenis/gomart/internal/app/lockout"
+	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/programs"
+	"github.com/valinurovdenis/gomart/internal/app/service"
+	"github.com/valinurovdenis/gomart/internal/app/statement"
+	"github.com/valinurovdenis/gomart/internal/app/twofactor"
+	"github.com/valinurovdenis/gomart/internal/app/userstorage"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+	"github.com/valinurovdenis/gomart/internal/app/withdrawstorage"
+	pb "github.com/valinurovdenis/gomart/pkg/gophermartpb"
+)
+
+type Server struct {
+	pb.UnimplementedGophermartServer
+	Service service.OrderService
+	Auth    auth.JwtAuthenticator
+	Limits  validators.Limits
+}
+
+// statusError converts service error to gRPC status.
+func statusError(err error) error {
+	var validationErr *validators.ValidationError
+	if errors.As(err, &validationErr) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	} else if errors.Is(err, userstorage.ErrLoginExists) || errors.Is(err, orderstorage.ErrOrderExists) {
+		return status.Error(codes.AlreadyExists, err.Error())
+	} else if errors.Is(err, validators.ErrInvalidOrder) || errors.Is(err, accrualorder.ErrNoSuchOrder) ||
+		errors.Is(err, programs.ErrUnknownProgram) || errors.Is(err, programs.ErrTooPrecise) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	} else if errors.Is(err, service.ErrNotEnoughBalance) || errors.Is(err, service.ErrNegativeBalance) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	} else if errors.Is(err, lockout.ErrLocked) || errors.Is(err, lockout.ErrTooManyFailures) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	} else if errors.Is(err, twofactor.ErrConfirmationRequired) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	} else if errors.Is(err, auth.ErrInvalidCredentials) || errors.Is(err, twofactor.ErrInvalidCode) || errors.Is(err, twofactor.ErrNotEnrolled) {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// clientFromContext returns peer address and user agent of the call.
+func clientFromContext(ctx context.Context) lockout.Client {
+	var client lockout.Client
+	if p, ok := peer.FromContext(ctx); ok {
+		client.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(client.IP); err == nil {
+			client.IP = host
+		}
+	}
+	if userAgent := metadata.ValueFromIncomingContext(ctx, "user-agent"); len(userAgent) > 0 {
+		client.UserAgent = userAgent[0]
+	}
+	return client
+}
+
+func (s *Server) Register(ctx context.Context, request *pb.Credentials) (*pb.AuthToken, error) {
+	token, err := s.Auth.SignUp(ctx, userstorage.LoginPassword{Login: request.GetLogin(), Password: request.GetPassword()})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.AuthToken{Token: token}, nil
+}
+
+func (s *Server) Login(ctx context.Context, request *pb.Credentials) (*pb.AuthToken, error) {
+	result, err := s.Auth.SignIn(ctx, userstorage.LoginPassword{Login: request.GetLogin(), Password: request.GetPassword()}, clientFromContext(ctx))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.AuthToken{Token: result.Token, Challenge: result.Challenge}, nil
+}
+
+func (s *Server) VerifyLogin(ctx context.Context, request *pb.VerifyLoginRequest) (*pb.AuthToken, error) {
+	token, err := s.Auth.VerifyLogin(ctx, request.GetChallenge(), request.GetCode(), clientFromContext(ctx))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.AuthToken{Token: token}, nil
+}
+
+func (s *Server) UploadOrder(ctx context.Context, request *pb.UploadOrderRequest) (*pb.UploadOrderResponse, error) {
+	login, _ := auth.LoginFromContext(ctx)
+
+	err := s.Service.AddUserOrder(ctx, login, request.GetNumber())
+
+	if errors.Is(err, orderstorage.ErrAlreadySent) {
+		return &pb.UploadOrderResponse{Accepted: false}, nil
+	} else if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.UploadOrderResponse{Accepted: true}, nil
+}
+
+func (s *Server) UploadOrders(ctx context.Context, request *pb.UploadOrdersRequest) (*pb.UploadOrdersResponse, error) {
+	login, _ := auth.LoginFromContext(ctx)
+
+	numbers := request.GetNumbers()
+	if len(numbers) == 0 {
+		return nil, statusError(validators.NewFieldError("numbers", "must not be empty"))
+	}
+	if s.Limits.MaxBatchOrders > 0 && len(numbers) > s.Limits.MaxBatchOrders {
+		return nil, statusError(validators.NewFieldError("numbers", fmt.Sprintf("must contain at most %d numbers", s.Limits.MaxBatchOrders)))
+	}
+
+	results, err := s.Service.AddUserOrders(ctx, login, numbers)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	response := &pb.UploadOrdersResponse{Results: make([]*pb.BatchOrderResult, 0, len(results))}
+	for _, result := range results {
+		response.Results = append(response.Results, &pb.BatchOrderResult{Number: result.Number, Status: string(result.Status)})
+	}
+	return response, nil
+}
+
+func (s *Server) ListOrders(ctx context.Context, request *pb.ListOrdersRequest) (*pb.ListOrdersResponse, error) {
+	login, _ := auth.LoginFromContext(ctx)
+
+	orders, err := s.Service.GetUserOrders(ctx, login)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	response := &pb.ListOrdersResponse{Orders: make([]*pb.Order, 0, len(orders))}
+	for _, order := range orders {
+		response.Orders = append(response.Orders, &pb.Order{
+			Number:     order.Number,
+			Program:    order.Program,
+			Status:     string(order.Status),
+			Accrual:    order.Balance.String(),
+			UploadedAt: timestamp(&order.Uploaded),
+		})
+	}
+	return response, nil
+}
+
+func (s *Server) GetBalance(ctx context.Context, request *pb.GetBalanceRequest) (*pb.Balance, error) {
+	login, _ := auth.LoginFromContext(ctx)
+
+	var balances service.UserBalances
+	var err error
+	if request.GetAt() != nil {
+		if err = request.GetAt().CheckValid(); err != nil {
+			return nil, statusError(validators.NewFieldError("at", err.Error()))
+		}
+		balances, err = s.Service.GetUserBalanceAt(ctx, login, request.GetAt().AsTime())
+	} else {
+		balances, err = s.Service.GetUserBalance(ctx, login)
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	response := &pb.Balance{Current: balances.Current.String(), Withdrawn: balances.Withdrawn.String()}
+	for _, program := range balances.Programs {
+		response.Programs = append(response.Programs, &pb.ProgramBalance{
+			Program:   program.Program,
+			Name:      program.Name,
+			Current:   program.Current.String(),
+			Withdrawn: program.Withdrawn.String(),
+		})
+	}
+	for _, expiring := range balances.ExpiringSoon {
+		response.ExpiringSoon = append(response.ExpiringSoon, &pb.ExpiringPoints{
+			Program:   expiring.Program,
+			Amount:    expiring.Amount.String(),
+			ExpiresAt: timestamp(&expiring.ExpiresAt),
+		})
+	}
+	return response, nil
+}
+
+func (s *Server) GetBalanceHistory(ctx context.Context, request *pb.GetBalanceHistoryRequest) (*pb.GetBalanceHistoryResponse, error) {
+	login, _ := auth.LoginFromContext(ctx)
+
+	validationErr := &validators.ValidationError{}
+	last := time.Now().UTC().Truncate(24 * time.Hour)
+	if request.GetTo() != "" {
+		parsed, err := time.Parse(statement.DateLayout, request.GetTo())
+		if err != nil {
+			validationErr.Add("to", "must be a date")
+		}
+		last = parsed
+	}
+	first := last.AddDate(0, 0, -30)
+	if request.GetFrom() != "" {
+		parsed, err := time.Parse(statement.DateLayout, request.GetFrom())
+		if err != nil {
+			validationErr.Add("from", "must be a date")
+		}
+		first = parsed
+	}
+	if err := validationErr.OrNil(); err != nil {
+		return nil, statusError(err)
+	}
+
+	points, err := s.Service.GetBalanceHistory(ctx, login, first, last)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	response := &pb.GetBalanceHistoryResponse{Points: make([]*pb.BalancePoint, 0, len(points))}
+	for _, point := range points {
+		response.Points = append(response.Points, &pb.BalancePoint{Date: point.Date, Program: point.Program, Balance: point.Balance.String()})
+	}
+	return response, nil
+}
+
+func (s *Server) Withdraw(ctx context.Context, request *pb.WithdrawRequest) (*pb.WithdrawResponse, error) {
+	login, _ := auth.LoginFromContext(ctx)
+
+	sum, err := validators.ParseAmount("sum", json.Number(request.GetSum()), s.Limits.MaxWithdraw)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	withdraw := withdrawstorage.UserWithdraw{Login: login, Number: request.GetOrder(), Program: request.GetProgram()}
+	withdraw.Withdraw.Balance = sum
+
+	if err = s.Service.AddUserWithdraw(ctx, withdraw); err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.WithdrawResponse{}, nil
+}
+
+func (s *Server) ListWithdrawals(ctx context.Context, request *pb.ListWithdrawalsRequest) (*pb.ListWithdrawalsResponse, error) {
+	login, _ := auth.LoginFromContext(ctx)
+
+	withdrawals, err := s.Service.GetUserWithdrawals(ctx, login)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	response := &pb.ListWithdrawalsResponse{Withdrawals: make([]*pb.Withdrawal, 0, len(withdrawals))}
+	for _, withdraw := range withdrawals {
+		response.Withdrawals = append(response.Withdrawals, &pb.Withdrawal{
+			Id:            withdraw.ID,
+			Order:         withdraw.Number,
+			Program:       withdraw.Program,
+			Sum:           withdraw.Withdraw.String(),
+			ProcessedAt:   timestamp(&withdraw.Processed),
+			Status:        string(withdraw.Status),
+			ReversedAt:    timestamp(withdraw.Reversed),
+			ReverseReason: withdraw.ReverseReason,
+		})
+	}
+	return response, nil
+}
+
+func (s *Server) ListAdjustments(ctx context.Context, request *pb.ListAdjustmentsRequest) (*pb.ListAdjustmentsResponse, error) {
+	login, _ := auth.LoginFromContext(ctx)
+
+	adjustments, err := s.Service.GetUserAdjustments(ctx, login)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	response := &pb.ListAdjustmentsResponse{Adjustments: make([]*pb.Adjustment, 0, len(adjustments))}
+	for _, adjustment := range adjustments {
+		response.Adjustments = append(response.Adjustments, &pb.Adjustment{
+			Order:     adjustment.Number,
+			Program:   adjustment.Program,
+			Amount:    adjustment.Amount.String(),
+			Reason:    adjustment.Reason,
+			CreatedAt: timestamp(&adjustment.Created),
+		})
+	}
+	return response, nil
+}
+
+func NewServer(service service.OrderService, auth auth.JwtAuthenticator, limits validators.Limits) *Server {
+	return &Server{Service: service, Auth: auth, Limits: limits}
+}
+
+// NewGrpcServer returns grpc server of the user API with auth, logging and metrics interceptors.
+func NewGrpcServer(server *Server, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(MetricsInterceptor, LoggingInterceptor, server.AuthInterceptor))
+	grpcServer := grpc.NewServer(opts...)
+	pb.RegisterGophermartServer(grpcServer, server)
+	return grpcServer
+}
@@ -0,0 +1,187 @@
+package grpcapi_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/valinurovdenis/gomart/internal/app/accrualorder"
+	"github.com/valinurovdenis/gomart/internal/app/auth"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/grpcapi"
+	"github.com/valinurovdenis/gomart/internal/app/memstorage"
+	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/programs"
+	"github.com/valinurovdenis/gomart/internal/app/service"
+	"github.com/valinurovdenis/gomart/internal/app/twofactor"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+	"github.com/valinurovdenis/gomart/mocks"
+	pb "github.com/valinurovdenis/gomart/pkg/gophermartpb"
+)
+
+// newClient serves memory storage, users can enable the second factor with returned service.
+func newClient(t *testing.T, twoFactorClock clock.Clock) (pb.GophermartClient, *twofactor.TwoFactorService) {
+	registry, err := programs.ParseRegistry("points:Gophermart points:2")
+	require.NoError(t, err)
+	storage := memstorage.NewMemoryStorage(clock.RealClock{})
+	accrual := mocks.NewAccrualOrderService(t)
+	accrual.On("GetOrder", mock.Anything, "79927398713").
+		Return(accrualorder.AccrualOrder{Status: orderstorage.Processed, Accrual: "500", Program: "points"}, nil).Maybe()
+
+	twoFactor := twofactor.NewTwoFactorService(storage, twoFactorClock, "Gophermart", time.Minute)
+	serviceStorage := service.NewServiceStorage(storage, storage, storage, storage, storage, storage)
+	orderService := service.NewOrderService(serviceStorage, accrual,
+		service.Settings{Programs: registry, Clock: clock.RealClock{}, TwoFactor: twoFactor, ConfirmWithdrawAbove: 100})
+	authenticator := auth.NewAuthenticator("secret", "", storage)
+	authenticator.TwoFactor = twoFactor
+	server := grpcapi.NewGrpcServer(grpcapi.NewServer(*orderService, *authenticator, validators.Limits{MaxBatchOrders: 2}))
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewGophermartClient(conn), twoFactor
+}
+
+func requireCode(t *testing.T, code codes.Code, err error) {
+	t.Helper()
+	require.Error(t, err)
+	require.Equal(t, code, status.Code(err), err.Error())
+}
+
+func TestServer(t *testing.T) {
+	client, _ := newClient(t, clock.RealClock{})
+	ctx := context.Background()
+
+	_, err := client.Login(ctx, &pb.Credentials{Login: "user1", Password: "Passw0rd!"})
+	requireCode(t, codes.Unauthenticated, err)
+	_, err = client.Register(ctx, &pb.Credentials{Login: "ab", Password: "Passw0rd!"})
+	requireCode(t, codes.InvalidArgument, err)
+	token, err := client.Register(ctx, &pb.Credentials{Login: "user1", Password: "Passw0rd!"})
+	require.NoError(t, err)
+	_, err = client.Register(ctx, &pb.Credentials{Login: "user1", Password: "Passw0rd!"})
+	requireCode(t, codes.AlreadyExists, err)
+	_, err = client.Login(ctx, &pb.Credentials{Login: "user1", Password: "wrong"})
+	requireCode(t, codes.Unauthenticated, err)
+
+	_, err = client.ListOrders(ctx, &pb.ListOrdersRequest{})
+	requireCode(t, codes.Unauthenticated, err)
+	_, err = client.ListOrders(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer invalid"), &pb.ListOrdersRequest{})
+	requireCode(t, codes.Unauthenticated, err)
+
+	// token issued over grpc is the same as http one
+	login, err := auth.NewAuthenticator("secret", "", nil).ParseToken(token.GetToken())
+	require.NoError(t, err)
+	require.Equal(t, "user1", login)
+
+	user := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token.GetToken())
+	uploaded, err := client.UploadOrder(user, &pb.UploadOrderRequest{Number: "79927398713"})
+	require.NoError(t, err)
+	require.True(t, uploaded.GetAccepted())
+	uploaded, err = client.UploadOrder(user, &pb.UploadOrderRequest{Number: "79927398713"})
+	require.NoError(t, err)
+	require.False(t, uploaded.GetAccepted())
+	_, err = client.UploadOrder(user, &pb.UploadOrderRequest{Number: "12345"})
+	requireCode(t, codes.InvalidArgument, err)
+
+	batch, err := client.UploadOrders(user, &pb.UploadOrdersRequest{Numbers: []string{"79927398713", "12345"}})
+	require.NoError(t, err)
+	require.Equal(t, "already_sent", batch.GetResults()[0].GetStatus())
+	require.Equal(t, "invalid", batch.GetResults()[1].GetStatus())
+	_, err = client.UploadOrders(user, &pb.UploadOrdersRequest{Numbers: []string{"1", "2", "3"}})
+	requireCode(t, codes.InvalidArgument, err)
+
+	orders, err := client.ListOrders(user, &pb.ListOrdersRequest{})
+	require.NoError(t, err)
+	require.Len(t, orders.GetOrders(), 1)
+	require.Equal(t, "PROCESSED", orders.GetOrders()[0].GetStatus())
+	require.Equal(t, "500", orders.GetOrders()[0].GetAccrual())
+
+	_, err = client.Withdraw(user, &pb.WithdrawRequest{Order: "2377225624", Sum: "1.5"})
+	require.NoError(t, err)
+	_, err = client.Withdraw(user, &pb.WithdrawRequest{Order: "2377225624", Sum: "1000"})
+	requireCode(t, codes.FailedPrecondition, err)
+	_, err = client.Withdraw(user, &pb.WithdrawRequest{Order: "2377225624", Sum: "1.005"})
+	requireCode(t, codes.InvalidArgument, err)
+	_, err = client.Withdraw(user, &pb.WithdrawRequest{Order: "12345", Sum: "1"})
+	requireCode(t, codes.InvalidArgument, err)
+
+	balance, err := client.GetBalance(user, &pb.GetBalanceRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "498.5", balance.GetCurrent())
+	require.Equal(t, "1.5", balance.GetWithdrawn())
+	require.Equal(t, "points", balance.GetPrograms()[0].GetProgram())
+	_, err = client.GetBalance(user, &pb.GetBalanceRequest{At: &timestamppb.Timestamp{Nanos: -1}})
+	requireCode(t, codes.InvalidArgument, err)
+
+	withdrawals, err := client.ListWithdrawals(user, &pb.ListWithdrawalsRequest{})
+	require.NoError(t, err)
+	require.Len(t, withdrawals.GetWithdrawals(), 1)
+	require.Equal(t, "1.5", withdrawals.GetWithdrawals()[0].GetSum())
+	require.Nil(t, withdrawals.GetWithdrawals()[0].GetReversedAt())
+
+	adjustments, err := client.ListAdjustments(user, &pb.ListAdjustmentsRequest{})
+	require.NoError(t, err)
+	require.Empty(t, adjustments.GetAdjustments())
+
+	_, err = client.GetBalanceHistory(user, &pb.GetBalanceHistoryRequest{From: "yesterday"})
+	requireCode(t, codes.InvalidArgument, err)
+
+	require.NotNil(t, grpcapi.Metrics.Get(pb.Gophermart_Withdraw_FullMethodName+" OK"))
+	require.NotNil(t, grpcapi.Metrics.Get(pb.Gophermart_ListOrders_FullMethodName+" Unauthenticated"))
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	twoFactorClock := &clock.FixedClock{Time: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	client, twoFactor := newClient(t, twoFactorClock)
+	ctx := context.Background()
+	code := func(secret string) string {
+		twoFactorClock.Advance(30 * time.Second)
+		code, err := twofactor.Code(secret, twoFactorClock.Now().Unix()/30)
+		require.NoError(t, err)
+		return code
+	}
+
+	_, err := client.Register(ctx, &pb.Credentials{Login: "user1", Password: "Passw0rd!"})
+	require.NoError(t, err)
+	enrollment, err := twoFactor.Enroll(ctx, "user1")
+	require.NoError(t, err)
+	_, err = twoFactor.Enable(ctx, "user1", code(enrollment.Secret))
+	require.NoError(t, err)
+
+	challenge, err := client.Login(ctx, &pb.Credentials{Login: "user1", Password: "Passw0rd!"})
+	require.NoError(t, err)
+	require.Empty(t, challenge.GetToken())
+	_, err = client.ListOrders(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+challenge.GetChallenge()), &pb.ListOrdersRequest{})
+	requireCode(t, codes.Unauthenticated, err)
+	_, err = client.VerifyLogin(ctx, &pb.VerifyLoginRequest{Challenge: challenge.GetChallenge(), Code: "abcdef"})
+	requireCode(t, codes.Unauthenticated, err)
+	token, err := client.VerifyLogin(ctx, &pb.VerifyLoginRequest{Challenge: challenge.GetChallenge(), Code: code(enrollment.Secret)})
+	require.NoError(t, err)
+
+	// login confirmed the second factor, withdrawal above threshold is refused once confirmation is stale
+	user := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token.GetToken())
+	_, err = client.Withdraw(user, &pb.WithdrawRequest{Order: "2377225624", Sum: "2"})
+	requireCode(t, codes.FailedPrecondition, err)
+	twoFactorClock.Advance(2 * time.Minute)
+	_, err = client.Withdraw(user, &pb.WithdrawRequest{Order: "2377225624", Sum: "2"})
+	requireCode(t, codes.PermissionDenied, err)
+	_, err = client.Withdraw(user, &pb.WithdrawRequest{Order: "2377225624", Sum: "1"})
+	requireCode(t, codes.FailedPrecondition, err)
+}
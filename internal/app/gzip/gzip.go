@@ -7,9 +7,12 @@ import (
 	"strings"
 )
 
+// compressWriter compresses successful responses only, error bodies are sent as is.
 type compressWriter struct {
-	w  http.ResponseWriter
-	zw *gzip.Writer
+	w           http.ResponseWriter
+	zw          *gzip.Writer
+	wroteHeader bool
+	compress    bool
 }
 
 func newCompressWriter(w http.ResponseWriter) *compressWriter {
@@ -24,17 +27,39 @@ func (c *compressWriter) Header() http.Header {
 }
 
 func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.compress {
+		return c.w.Write(p)
+	}
 	return c.zw.Write(p)
 }
 
 func (c *compressWriter) WriteHeader(statusCode int) {
+	c.wroteHeader = true
 	if statusCode < 300 {
+		c.compress = true
 		c.w.Header().Set("Content-Encoding", "gzip")
 	}
 	c.w.WriteHeader(statusCode)
 }
 
+// FlushError writes compressed data buffered so far, used by streaming responses.
+func (c *compressWriter) FlushError() error {
+	if !c.compress {
+		return http.NewResponseController(c.w).Flush()
+	}
+	if err := c.zw.Flush(); err != nil {
+		return err
+	}
+	return http.NewResponseController(c.w).Flush()
+}
+
 func (c *compressWriter) Close() error {
+	if !c.compress {
+		return nil
+	}
 	return c.zw.Close()
 }
 
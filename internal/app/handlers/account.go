@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/valinurovdenis/gomart/internal/app/twofactor"
+)
+
+// ExportUserData sends zip archive of all data kept about user.
+func (h *ApiHandler) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	var archive bytes.Buffer
+	if err := h.Accounts.Export(r.Context(), r.Header.Get("Login"), &archive); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="gophermart-export.zip"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive.Bytes())
+}
+
+// DeleteUser deletes account of user and clears the user's cookie, financial records are kept anonymized.
+func (h *ApiHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	err := h.Accounts.Delete(r.Context(), r.Header.Get("Login"))
+
+	if errors.Is(err, twofactor.ErrConfirmationRequired) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: "Authorization", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
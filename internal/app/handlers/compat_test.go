@@ -0,0 +1,79 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/valinurovdenis/gomart/internal/app/accrualorder"
+	"github.com/valinurovdenis/gomart/internal/app/auth"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/handlers"
+	"github.com/valinurovdenis/gomart/internal/app/memstorage"
+	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/programs"
+	"github.com/valinurovdenis/gomart/internal/app/service"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+	"github.com/valinurovdenis/gomart/mocks"
+)
+
+// TestVersionsOutput pins exact v1 responses as they were before v2, which must not change with it, and v2 ones of the same data.
+func TestVersionsOutput(t *testing.T) {
+	registry, err := programs.ParseRegistry("points:Gophermart points:2")
+	require.NoError(t, err)
+	fixedClock := &clock.FixedClock{Time: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	storage := memstorage.NewMemoryStorage(fixedClock)
+	accrual := mocks.NewAccrualOrderService(t)
+	accrual.On("GetOrder", mock.Anything, "79927398713").
+		Return(accrualorder.AccrualOrder{Status: orderstorage.Processed, Accrual: "500.5", Program: "points"}, nil).Once()
+
+	serviceStorage := service.NewServiceStorage(storage, storage, storage, storage, storage, storage)
+	orderService := service.NewOrderService(serviceStorage, accrual,
+		service.Settings{Programs: registry, Clock: fixedClock, History: storage})
+	handler := handlers.NewApiHandler(*orderService, validators.Limits{MaxBodySize: 1024})
+	router := handlers.MartRouter(*handler, *auth.NewAuthenticator("secret", "", storage))
+	c := &contract{t: t, router: router}
+
+	user := cookie(t, c.serve(context.Background(), request{method: http.MethodPost, path: "/api/user/register",
+		body: `{"login":"user1","password":"Passw0rd!"}`}))
+	require.Equal(t, http.StatusAccepted, c.serve(context.Background(), request{method: http.MethodPost, path: "/api/user/orders",
+		contentType: "text/plain", body: "79927398713", cookie: user}).Code)
+	require.Equal(t, http.StatusOK, c.serve(context.Background(), request{method: http.MethodPost, path: "/api/user/balance/withdraw",
+		contentType: "application/json", body: `{"order":"2377225624","sum":0.25}`, cookie: user}).Code)
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{path: "/api/user/orders", status: http.StatusOK,
+			body: `[{"Login":"user1","number":"79927398713","program":"points","status":"PROCESSED","accrual":500.5,"uploaded_at":"2024-03-01T10:00:00Z"}]` + "\n"},
+		{path: "/api/user/balance", status: http.StatusOK,
+			body: `{"current":500.25,"withdrawn":0.25,"programs":[{"program":"points","name":"Gophermart points","current":500.25,"withdrawn":0.25}],"expiring_soon":[]}` + "\n"},
+		{path: "/api/user/withdrawals", status: http.StatusOK,
+			body: `[{"id":1,"Login":"user1","order":"2377225624","program":"points","sum":0.25,"processed_at":"2024-03-01T10:00:00Z","status":"DONE"}]` + "\n"},
+		{path: "/api/user/adjustments", status: http.StatusNoContent},
+		{path: "/api/user/balance/history?from=2024-03-01&to=2024-03-01", status: http.StatusOK,
+			body: `[{"date":"2024-03-01","program":"points","balance":500.25}]` + "\n"},
+
+		{path: "/api/v2/user/orders", status: http.StatusOK,
+			body: `{"items":[{"number":"79927398713","status":"PROCESSED","accrual":{"amount":50050,"currency":"points"},"uploaded_at":"2024-03-01T10:00:00Z"}],"pagination":{"limit":100,"offset":0,"total":1}}` + "\n"},
+		{path: "/api/v2/user/balance", status: http.StatusOK,
+			body: `{"programs":[{"program":"points","name":"Gophermart points","current":{"amount":50025,"currency":"points"},"withdrawn":{"amount":25,"currency":"points"}}],"expiring_soon":[]}` + "\n"},
+		{path: "/api/v2/user/withdrawals", status: http.StatusOK,
+			body: `{"items":[{"id":1,"order":"2377225624","amount":{"amount":25,"currency":"points"},"processed_at":"2024-03-01T10:00:00Z","status":"DONE"}],"pagination":{"limit":100,"offset":0,"total":1}}` + "\n"},
+		{path: "/api/v2/user/adjustments?offset=5", status: http.StatusOK,
+			body: `{"items":[],"pagination":{"limit":100,"offset":5,"total":0}}` + "\n"},
+		{path: "/api/v2/user/balance/history?from=2024-03-01&to=2024-03-01", status: http.StatusOK,
+			body: `{"items":[{"date":"2024-03-01","balance":{"amount":50025,"currency":"points"}}],"pagination":{"limit":100,"offset":0,"total":1}}` + "\n"},
+	}
+	for _, tt := range tests {
+		w := c.serve(context.Background(), request{method: http.MethodGet, path: tt.path, cookie: user})
+		require.Equal(t, tt.status, w.Code, tt.path)
+		require.Equal(t, tt.body, w.Body.String(), tt.path)
+	}
+}
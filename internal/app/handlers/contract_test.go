@@ -0,0 +1,537 @@
+package handlers_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/valinurovdenis/gomart/internal/app/account"
+	"github.com/valinurovdenis/gomart/internal/app/accrualorder"
+	"github.com/valinurovdenis/gomart/internal/app/auth"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/events"
+	"github.com/valinurovdenis/gomart/internal/app/handlers"
+	"github.com/valinurovdenis/gomart/internal/app/lockout"
+	"github.com/valinurovdenis/gomart/internal/app/memstorage"
+	"github.com/valinurovdenis/gomart/internal/app/notify"
+	"github.com/valinurovdenis/gomart/internal/app/openapi"
+	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/passwordreset"
+	"github.com/valinurovdenis/gomart/internal/app/programs"
+	"github.com/valinurovdenis/gomart/internal/app/ratelimit"
+	"github.com/valinurovdenis/gomart/internal/app/rbac"
+	"github.com/valinurovdenis/gomart/internal/app/service"
+	"github.com/valinurovdenis/gomart/internal/app/twofactor"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+	"github.com/valinurovdenis/gomart/internal/app/webhooks"
+	"github.com/valinurovdenis/gomart/mocks"
+)
+
+const adminToken = "admin-token"
+
+type request struct {
+	method      string
+	path        string
+	contentType string
+	body        string
+	headers     map[string]string
+	cookie      string
+}
+
+// contract sends requests to router checking every response is documented and matches its schema.
+type contract struct {
+	t       *testing.T
+	spec    *openapi.Document
+	router  http.Handler
+	covered map[string]bool
+}
+
+func operationKey(method string, template string, status string) string {
+	return method + " " + template + " " + status
+}
+
+func (c *contract) serve(ctx context.Context, req request) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(req.method, req.path, strings.NewReader(req.body)).WithContext(ctx)
+	if req.contentType != "" {
+		r.Header.Set("Content-Type", req.contentType)
+	}
+	for name, value := range req.headers {
+		r.Header.Set(name, value)
+	}
+	if req.cookie != "" {
+		r.AddCookie(&http.Cookie{Name: "Authorization", Value: req.cookie})
+	}
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, r)
+	return w
+}
+
+func (c *contract) check(req request, w *httptest.ResponseRecorder, status int) {
+	t := c.t
+	require.Equal(t, status, w.Code, "%s %s: %s", req.method, req.path, w.Body.String())
+
+	operation, template, _ := c.spec.Find(req.method, strings.Split(req.path, "?")[0])
+	require.NotNil(t, operation, "%s %s is not documented", req.method, req.path)
+	response, ok := operation.Responses[strconv.Itoa(status)]
+	require.True(t, ok, "%s %s: status %d is not documented", req.method, template, status)
+	c.covered[operationKey(req.method, template, strconv.Itoa(status))] = true
+
+	if len(response.Content) == 0 {
+		require.Empty(t, w.Body.String(), "%s %s: undocumented body", req.method, template)
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	require.NoError(t, err, "%s %s: no Content-Type", req.method, template)
+	content, ok := response.Content[mediaType]
+	require.True(t, ok, "%s %s: undocumented Content-Type %s", req.method, template, mediaType)
+	if mediaType != "application/json" {
+		return
+	}
+	decoder := json.NewDecoder(bytes.NewReader(w.Body.Bytes()))
+	decoder.UseNumber()
+	var value any
+	require.NoError(t, decoder.Decode(&value))
+	require.NoError(t, c.spec.Validate(content.Schema, value, ""), "%s %s: %s", req.method, template, w.Body.String())
+}
+
+func (c *contract) do(req request, status int) *httptest.ResponseRecorder {
+	w := c.serve(context.Background(), req)
+	c.check(req, w, status)
+	return w
+}
+
+// exhaustibleStore counts every request as the first one of its window until exhausted.
+type exhaustibleStore struct {
+	exhausted bool
+}
+
+func (s *exhaustibleStore) Take(ctx context.Context, key string, windowStart time.Time, period time.Duration) (int, error) {
+	if s.exhausted {
+		return math.MaxInt, nil
+	}
+	return 1, nil
+}
+
+func cookie(t *testing.T, w *httptest.ResponseRecorder) string {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "Authorization" {
+			return cookie.Value
+		}
+	}
+	t.Fatal("no Authorization cookie")
+	return ""
+}
+
+func TestContract(t *testing.T) {
+	spec, err := openapi.Load()
+	require.NoError(t, err)
+	registry, err := programs.ParseRegistry("points:Gophermart points:2")
+	require.NoError(t, err)
+
+	storage := memstorage.NewMemoryStorage(clock.RealClock{})
+	accrual := mocks.NewAccrualOrderService(t)
+	processed := accrualorder.AccrualOrder{Status: orderstorage.Processed, Accrual: "500", Program: "points"}
+	accrual.On("GetOrder", mock.Anything, "79927398713").Return(processed, nil).Times(3)
+	processed.Accrual = "600"
+	accrual.On("GetOrder", mock.Anything, "79927398713").Return(processed, nil).Once()
+	accrual.On("GetOrder", mock.Anything, "79927398721").Return(accrualorder.AccrualOrder{Status: orderstorage.Processing}, nil).Once()
+	accrual.On("GetOrder", mock.Anything, "12345678903").Return(accrualorder.AccrualOrder{}, accrualorder.ErrNoSuchOrder).Once()
+	processed.Accrual = "1.25"
+	accrual.On("GetOrder", mock.Anything, "79927398739").Return(processed, nil).Times(3)
+	accrual.On("GetOrder", mock.Anything, "79927398747").Return(processed, nil).Twice()
+	accrual.On("EnqueueNewOrders", mock.Anything, "user1", mock.Anything).Return(nil).Maybe()
+
+	// codes of the second factor are generated for the next time step of own clock, an accepted one is not accepted again
+	twoFactorClock := &clock.FixedClock{Time: time.Now()}
+	twoFactor := twofactor.NewTwoFactorService(storage, twoFactorClock, "Gophermart", 5*time.Minute)
+	serviceStorage := service.NewServiceStorage(storage, storage, storage, storage, storage, storage)
+	orderService := service.NewOrderService(serviceStorage, accrual,
+		service.Settings{Programs: registry, Clock: clock.RealClock{}, History: storage, TwoFactor: twoFactor, ConfirmWithdrawAbove: 100})
+	handler := handlers.NewApiHandler(*orderService, validators.Limits{MaxBodySize: 1024, MaxBatchOrders: 10})
+	handler.Webhooks = webhooks.NewWebhookService(storage)
+	handler.Statements = storage
+	handler.Events = events.NewEventStream(storage, events.NewBroker(), time.Second)
+	handler.Accounts = account.NewAccountService(storage, storage, storage, storage, storage, storage, clock.RealClock{})
+	handler.Accounts.Sessions = storage
+	handler.Accounts.TwoFactor = twoFactor
+	limits := &exhaustibleStore{}
+	handler.Limiter = ratelimit.NewLimiter(limits, map[string]ratelimit.Limit{"*": {Requests: 1, Period: time.Minute}}, clock.RealClock{})
+	authenticator := auth.NewAuthenticator("secret", adminToken, storage)
+	authenticator.Guard = lockout.NewGuard(storage, storage, storage, clock.RealClock{},
+		lockout.Settings{FreeFailures: 1, Delay: time.Minute, LockAfter: 3, LockFor: time.Hour})
+	authenticator.TwoFactor = twoFactor
+	var notifications bytes.Buffer
+	authenticator.Reset = passwordreset.NewResetService(storage, storage, &notify.WriterNotifier{Writer: &notifications},
+		storage, clock.RealClock{}, time.Hour)
+	authenticator.ServiceAccounts = rbac.NewServiceAccountService(storage, clock.RealClock{})
+	router := handlers.MartRouter(*handler, *authenticator)
+
+	c := &contract{t: t, spec: spec, router: router, covered: map[string]bool{}}
+	admin := map[string]string{"Authorization": "Bearer " + adminToken}
+
+	t.Run("every route is documented", func(t *testing.T) {
+		documented := map[string]bool{}
+		for template, operations := range spec.Paths {
+			for method := range operations {
+				documented[strings.ToUpper(method)+" "+template] = true
+			}
+		}
+		served := map[string]bool{}
+		err := chi.Walk(router, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+			served[method+" "+strings.ReplaceAll(route, "/*/", "/")] = true
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, documented, served)
+	})
+
+	c.do(request{method: http.MethodGet, path: "/openapi.json"}, http.StatusOK)
+
+	// authentication
+	user := cookie(t, c.do(request{method: http.MethodPost, path: "/api/user/register", contentType: "application/json",
+		body: `{"login":"user1","password":"Passw0rd!"}`}, http.StatusOK))
+	other := cookie(t, c.do(request{method: http.MethodPost, path: "/api/user/register",
+		body: `{"login":"user2","password":"Passw0rd!"}`}, http.StatusOK))
+	c.do(request{method: http.MethodPost, path: "/api/user/register", body: `{"login":"ab","password":"Passw0rd!"}`}, http.StatusBadRequest)
+	c.do(request{method: http.MethodPost, path: "/api/user/register", body: `{"login":"bad login","password":"Passw0rd!"}`}, http.StatusBadRequest)
+	c.do(request{method: http.MethodPost, path: "/api/user/register", body: `{"login":"user1","password":"Passw0rd!"}`}, http.StatusConflict)
+	c.do(request{method: http.MethodPost, path: "/api/user/login", body: `{"login":"user1","password":"Passw0rd!"}`}, http.StatusOK)
+	c.do(request{method: http.MethodPost, path: "/api/user/login", body: `{"login":"user1"`}, http.StatusBadRequest)
+	c.do(request{method: http.MethodPost, path: "/api/user/login", body: `{"login":"nobody","password":"Passw0rd!"}`}, http.StatusUnauthorized)
+
+	// failed logins
+	c.do(request{method: http.MethodGet, path: "/api/user/sessions", cookie: other}, http.StatusNoContent)
+	c.do(request{method: http.MethodPost, path: "/api/user/login", body: `{"login":"user2","password":"wrong"}`}, http.StatusUnauthorized)
+	c.do(request{method: http.MethodPost, path: "/api/user/login", body: `{"login":"user2","password":"wrong"}`}, http.StatusUnauthorized)
+	w := c.do(request{method: http.MethodPost, path: "/api/user/login", body: `{"login":"user2","password":"Passw0rd!"}`}, http.StatusTooManyRequests)
+	require.Equal(t, "60", w.Header().Get("Retry-After"))
+	c.do(request{method: http.MethodPost, path: "/api/admin/users/user2/unlock", headers: admin}, http.StatusNoContent)
+	c.do(request{method: http.MethodPost, path: "/api/admin/users/nobody/unlock", headers: admin}, http.StatusNotFound)
+	c.do(request{method: http.MethodPost, path: "/api/user/login", body: `{"login":"user2","password":"Passw0rd!"}`}, http.StatusOK)
+	w = c.do(request{method: http.MethodGet, path: "/api/user/sessions", cookie: user}, http.StatusOK)
+	var sessions []lockout.Session
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+	require.Len(t, sessions, 1)
+	require.Equal(t, "192.0.2.1", sessions[0].IP)
+
+	// empty collections
+	for _, path := range []string{"/api/user/orders", "/api/user/withdrawals", "/api/user/adjustments", "/api/user/webhooks",
+		"/api/user/balance/history?from=2000-01-01&to=2000-01-31"} {
+		c.do(request{method: http.MethodGet, path: path, cookie: user}, http.StatusNoContent)
+	}
+	for _, path := range []string{"/api/v2/user/orders", "/api/v2/user/withdrawals", "/api/v2/user/adjustments",
+		"/api/v2/user/balance/history?from=2000-01-01&to=2000-01-31"} {
+		w := c.do(request{method: http.MethodGet, path: path, cookie: user}, http.StatusOK)
+		require.JSONEq(t, `{"items":[],"pagination":{"limit":100,"offset":0,"total":0}}`, w.Body.String())
+	}
+
+	// orders
+	c.do(request{method: http.MethodPost, path: "/api/user/orders", contentType: "text/plain", body: "79927398713", cookie: user}, http.StatusAccepted)
+	c.do(request{method: http.MethodPost, path: "/api/user/orders", contentType: "text/plain", body: "79927398713", cookie: user}, http.StatusOK)
+	c.do(request{method: http.MethodPost, path: "/api/user/orders", contentType: "text/plain", body: "79927398713", cookie: other}, http.StatusConflict)
+	c.do(request{method: http.MethodPost, path: "/api/user/orders", contentType: "text/plain", body: "12345", cookie: user}, http.StatusUnprocessableEntity)
+	c.do(request{method: http.MethodPost, path: "/api/user/orders/batch", contentType: "application/json",
+		body: `["79927398721", 12345678903, "12345"]`, cookie: user}, http.StatusOK)
+	c.do(request{method: http.MethodPost, path: "/api/user/orders/batch", contentType: "application/json", body: `[]`, cookie: user}, http.StatusBadRequest)
+	c.do(request{method: http.MethodGet, path: "/api/user/orders", cookie: user}, http.StatusOK)
+
+	// balance
+	c.do(request{method: http.MethodGet, path: "/api/user/balance", cookie: user}, http.StatusOK)
+	c.do(request{method: http.MethodGet, path: "/api/user/balance?at=yesterday", cookie: user}, http.StatusBadRequest)
+	c.do(request{method: http.MethodGet, path: "/api/user/balance/history", cookie: user}, http.StatusOK)
+	c.do(request{method: http.MethodGet, path: "/api/user/balance/history?from=2000-13-01", cookie: user}, http.StatusBadRequest)
+
+	// withdrawals
+	c.do(request{method: http.MethodPost, path: "/api/user/balance/withdraw", contentType: "application/json",
+		body: `{"order":"2377225624","sum":1.5}`, cookie: user}, http.StatusOK)
+	c.do(request{method: http.MethodPost, path: "/api/user/balance/withdraw", contentType: "application/json",
+		body: `{"order":"2377225624","sum":-1}`, cookie: user}, http.StatusBadRequest)
+	c.do(request{method: http.MethodPost, path: "/api/user/balance/withdraw", contentType: "application/json",
+		body: `{"order":"2377225624","sum":100000}`, cookie: user}, http.StatusPaymentRequired)
+	c.do(request{method: http.MethodPost, path: "/api/user/balance/withdraw", contentType: "application/json",
+		body: `{"order":"12345","sum":1}`, cookie: user}, http.StatusUnprocessableEntity)
+	c.do(request{method: http.MethodGet, path: "/api/user/withdrawals", cookie: user}, http.StatusOK)
+	withdrawals, err := storage.GetUserWithdrawals(context.Background(), "user1")
+	require.NoError(t, err)
+	reverse := "/api/admin/withdrawals/" + strconv.FormatInt(withdrawals[0].ID, 10) + "/reverse"
+	c.do(request{method: http.MethodPost, path: reverse, contentType: "application/json", body: `{"reason":"cancelled"}`, headers: admin}, http.StatusOK)
+	c.do(request{method: http.MethodPost, path: reverse, contentType: "application/json", body: `{"reason":"cancelled"}`, headers: admin}, http.StatusConflict)
+	c.do(request{method: http.MethodPost, path: reverse, contentType: "application/json", body: `{"reason":""}`, headers: admin}, http.StatusBadRequest)
+	c.do(request{method: http.MethodPost, path: "/api/admin/withdrawals/999/reverse", contentType: "application/json",
+		body: `{"reason":"cancelled"}`, headers: admin}, http.StatusNotFound)
+
+	// recheck
+	c.do(request{method: http.MethodPost, path: "/api/admin/orders/79927398713/recheck", headers: admin}, http.StatusOK)
+	c.do(request{method: http.MethodPost, path: "/api/admin/orders/79927398721/recheck", headers: admin}, http.StatusConflict)
+	c.do(request{method: http.MethodPost, path: "/api/admin/orders/12345678903/recheck", headers: admin}, http.StatusBadGateway)
+	c.do(request{method: http.MethodPost, path: "/api/admin/orders/2377225624/recheck", headers: admin}, http.StatusNotFound)
+	c.do(request{method: http.MethodGet, path: "/api/user/adjustments", cookie: user}, http.StatusOK)
+
+	// service accounts act with their own role only
+	accounts := "/api/admin/service-accounts"
+	c.do(request{method: http.MethodGet, path: accounts, headers: admin}, http.StatusNoContent)
+	w = c.do(request{method: http.MethodPost, path: accounts, body: `{"name":"reconciler"}`, headers: admin}, http.StatusCreated)
+	var created struct {
+		APIKey string `json:"api_key"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	c.do(request{method: http.MethodPost, path: accounts, body: `{"name":"reconciler"}`, headers: admin}, http.StatusConflict)
+	c.do(request{method: http.MethodPost, path: accounts, body: `{"name":"Reconciler!"}`, headers: admin}, http.StatusBadRequest)
+	c.do(request{method: http.MethodGet, path: accounts, headers: admin}, http.StatusOK)
+	machine := map[string]string{"Authorization": "Bearer " + created.APIKey}
+	c.do(request{method: http.MethodPost, path: "/api/admin/orders/2377225624/recheck", headers: machine}, http.StatusNotFound)
+	c.do(request{method: http.MethodPost, path: "/api/admin/users/user2/unlock", headers: machine}, http.StatusForbidden)
+	c.do(request{method: http.MethodGet, path: accounts, headers: machine}, http.StatusForbidden)
+	c.do(request{method: http.MethodDelete, path: accounts + "/reconciler", headers: admin}, http.StatusNoContent)
+	c.do(request{method: http.MethodDelete, path: accounts + "/reconciler", headers: admin}, http.StatusNotFound)
+	c.do(request{method: http.MethodPost, path: "/api/admin/orders/2377225624/recheck", headers: machine}, http.StatusUnauthorized)
+
+	// assigned role revokes tokens issued with the previous one
+	support := cookie(t, c.do(request{method: http.MethodPost, path: "/api/user/register",
+		body: `{"login":"support1","password":"Passw0rd!"}`}, http.StatusOK))
+	c.do(request{method: http.MethodPost, path: "/api/admin/users/user2/unlock", cookie: support}, http.StatusForbidden)
+	c.do(request{method: http.MethodPut, path: "/api/admin/users/support1/role", body: `{"role":"support"}`, headers: admin}, http.StatusNoContent)
+	c.do(request{method: http.MethodPut, path: "/api/admin/users/support1/role", body: `{"role":"service"}`, headers: admin}, http.StatusBadRequest)
+	c.do(request{method: http.MethodPut, path: "/api/admin/users/nobody/role", body: `{"role":"support"}`, headers: admin}, http.StatusNotFound)
+	c.do(request{method: http.MethodGet, path: "/api/user/balance", cookie: support}, http.StatusUnauthorized)
+	support = cookie(t, c.do(request{method: http.MethodPost, path: "/api/user/login", body: `{"login":"support1","password":"Passw0rd!"}`}, http.StatusOK))
+	c.do(request{method: http.MethodGet, path: "/api/user/balance", cookie: support}, http.StatusOK)
+	c.do(request{method: http.MethodPost, path: "/api/admin/users/user2/unlock", cookie: support}, http.StatusNoContent)
+	c.do(request{method: http.MethodPut, path: "/api/admin/users/support1/role", body: `{"role":"admin"}`, cookie: support}, http.StatusForbidden)
+
+	// statement and events
+	c.do(request{method: http.MethodGet, path: "/api/user/statement?format=csv", cookie: user}, http.StatusOK)
+	c.do(request{method: http.MethodGet, path: "/api/user/statement?format=xml", cookie: user}, http.StatusBadRequest)
+	c.do(request{method: http.MethodGet, path: "/api/user/events", headers: map[string]string{"Last-Event-ID": "last"}, cookie: user}, http.StatusBadRequest)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	streamRequest := request{method: http.MethodGet, path: "/api/user/events", headers: map[string]string{"Last-Event-ID": "0"}, cookie: user}
+	stream := c.serve(ctx, streamRequest)
+	c.check(streamRequest, stream, http.StatusOK)
+	require.Contains(t, stream.Body.String(), "event: order.processed")
+
+	// webhooks
+	c.do(request{method: http.MethodPost, path: "/api/user/webhooks", contentType: "application/json",
+		body: `{"url":"http://203.0.113.10/hook","events":["order.processed"]}`, cookie: user}, http.StatusCreated)
+	c.do(request{method: http.MethodPost, path: "/api/user/webhooks", contentType: "application/json",
+		body: `{"url":"ftp://203.0.113.10/hook"}`, cookie: user}, http.StatusBadRequest)
+	c.do(request{method: http.MethodPost, path: "/api/user/webhooks", contentType: "application/json",
+		body: `{"url":"http://169.254.169.254/latest"}`, cookie: user}, http.StatusBadRequest)
+	c.do(request{method: http.MethodGet, path: "/api/user/webhooks", cookie: user}, http.StatusOK)
+	subscriptions, err := storage.GetSubscriptions(context.Background(), "user1")
+	require.NoError(t, err)
+	webhook := "/api/user/webhooks/" + strconv.FormatInt(subscriptions[0].ID, 10)
+	c.do(request{method: http.MethodGet, path: webhook + "/deliveries", cookie: user}, http.StatusNoContent)
+	_, err = storage.RecordDelivery(context.Background(), webhooks.Delivery{SubscriptionID: subscriptions[0].ID, EventID: 1,
+		EventType: "order.processed", Attempt: 1, StatusCode: http.StatusOK})
+	require.NoError(t, err)
+	c.do(request{method: http.MethodGet, path: webhook + "/deliveries", cookie: user}, http.StatusOK)
+	c.do(request{method: http.MethodPost, path: webhook + "/enable", cookie: user}, http.StatusOK)
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+		path := map[string]string{http.MethodGet: "/deliveries", http.MethodPost: "/enable", http.MethodDelete: ""}[method]
+		c.do(request{method: method, path: webhook + path, cookie: other}, http.StatusNotFound)
+		c.do(request{method: method, path: "/api/user/webhooks/first" + path, cookie: user}, http.StatusBadRequest)
+	}
+	c.do(request{method: http.MethodDelete, path: webhook, cookie: user}, http.StatusNoContent)
+
+	// two-factor authentication
+	w = c.do(request{method: http.MethodPost, path: "/api/user/2fa", cookie: other}, http.StatusOK)
+	var enrollment twofactor.Enrollment
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+	require.Contains(t, enrollment.URI, "otpauth://totp/Gophermart:user2?")
+	code := func() string {
+		twoFactorClock.Advance(30 * time.Second)
+		code, err := twofactor.Code(enrollment.Secret, twoFactorClock.Now().Unix()/30)
+		require.NoError(t, err)
+		return code
+	}
+	codeBody := func(code string) string {
+		return `{"code":"` + code + `"}`
+	}
+	c.do(request{method: http.MethodPost, path: "/api/user/2fa/confirm", body: `{"code":"abcdef"}`, cookie: other}, http.StatusConflict)
+	c.do(request{method: http.MethodPost, path: "/api/user/2fa/verify", body: `{"code":"abcdef"}`, cookie: other}, http.StatusBadRequest)
+	w = c.do(request{method: http.MethodPost, path: "/api/user/2fa/verify", body: codeBody(code()), cookie: other}, http.StatusOK)
+	var recovery struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &recovery))
+	require.Len(t, recovery.RecoveryCodes, 10)
+	c.do(request{method: http.MethodPost, path: "/api/user/2fa", cookie: other}, http.StatusConflict)
+	c.do(request{method: http.MethodPost, path: "/api/user/2fa/verify", body: codeBody(code()), cookie: other}, http.StatusConflict)
+
+	w = c.do(request{method: http.MethodPost, path: "/api/user/login", body: `{"login":"user2","password":"Passw0rd!"}`}, http.StatusAccepted)
+	var challenge struct {
+		Token string `json:"challenge_token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &challenge))
+	c.do(request{method: http.MethodGet, path: "/api/user/orders", cookie: challenge.Token}, http.StatusUnauthorized)
+	verifyLogin := func(code string) string {
+		return `{"challenge_token":"` + challenge.Token + `","code":"` + code + `"}`
+	}
+	c.do(request{method: http.MethodPost, path: "/api/user/login/2fa", body: verifyLogin("abcdef")}, http.StatusUnauthorized)
+	c.do(request{method: http.MethodPost, path: "/api/user/login/2fa", body: verifyLogin("")}, http.StatusBadRequest)
+	other = cookie(t, c.do(request{method: http.MethodPost, path: "/api/user/login/2fa", body: verifyLogin(code())}, http.StatusOK))
+
+	// confirmation of login gets stale for large withdrawals
+	twoFactorClock.Advance(6 * time.Minute)
+	c.do(request{method: http.MethodPost, path: "/api/user/balance/withdraw", body: `{"order":"2377225624","sum":2}`, cookie: other}, http.StatusForbidden)
+	c.do(request{method: http.MethodPost, path: "/api/v2/user/balance/withdraw", body: `{"order":"2377225624","amount":{"amount":200}}`, cookie: other}, http.StatusForbidden)
+	c.do(request{method: http.MethodPost, path: "/api/user/balance/withdraw", body: `{"order":"2377225624","sum":1}`, cookie: other}, http.StatusPaymentRequired)
+	c.do(request{method: http.MethodDelete, path: "/api/user", cookie: other}, http.StatusForbidden)
+	c.do(request{method: http.MethodPost, path: "/api/user/2fa/confirm", body: `{"code":"abcdef"}`, cookie: other}, http.StatusBadRequest)
+	other = cookie(t, c.do(request{method: http.MethodPost, path: "/api/user/2fa/confirm", body: codeBody(code()), cookie: other}, http.StatusOK))
+	c.do(request{method: http.MethodPost, path: "/api/user/balance/withdraw", body: `{"order":"2377225624","sum":2}`, cookie: other}, http.StatusPaymentRequired)
+
+	c.do(request{method: http.MethodPost, path: "/api/user/2fa/disable", body: `{"code":""}`, cookie: other}, http.StatusBadRequest)
+	c.do(request{method: http.MethodPost, path: "/api/user/2fa/disable", body: codeBody(recovery.RecoveryCodes[0]), cookie: other}, http.StatusNoContent)
+	c.do(request{method: http.MethodPost, path: "/api/user/2fa/disable", body: `{"code":"abcdef"}`, cookie: other}, http.StatusConflict)
+	c.do(request{method: http.MethodPost, path: "/api/user/login", body: `{"login":"user2","password":"Passw0rd!"}`}, http.StatusOK)
+
+	// password change revokes other sessions
+	stale := other
+	c.do(request{method: http.MethodPost, path: "/api/user/password", body: `{"old_password":"Passw0rd!","new_password":"short"}`, cookie: other}, http.StatusBadRequest)
+	c.do(request{method: http.MethodPost, path: "/api/user/password", body: `{"old_password":"wrong","new_password":"N3w-Passw0rd"}`, cookie: other}, http.StatusForbidden)
+	other = cookie(t, c.do(request{method: http.MethodPost, path: "/api/user/password",
+		body: `{"old_password":"Passw0rd!","new_password":"N3w-Passw0rd"}`, cookie: other}, http.StatusOK))
+	c.do(request{method: http.MethodGet, path: "/api/user/sessions", cookie: stale}, http.StatusUnauthorized)
+	c.do(request{method: http.MethodGet, path: "/api/user/sessions", cookie: other}, http.StatusOK)
+
+	// password reset by token sent to user
+	c.do(request{method: http.MethodPost, path: "/api/user/password/reset", body: `{"login":"nobody"}`}, http.StatusAccepted)
+	require.Zero(t, notifications.Len())
+	c.do(request{method: http.MethodPost, path: "/api/user/password/reset", body: `{"login":""}`}, http.StatusBadRequest)
+	c.do(request{method: http.MethodPost, path: "/api/user/password/reset", body: `{"login":"user2"}`}, http.StatusAccepted)
+	var notification notify.Message
+	require.NoError(t, json.Unmarshal(notifications.Bytes(), &notification))
+	require.Equal(t, "user2", notification.Login)
+	resetBody := func(password string) string {
+		return `{"token":"` + strings.Fields(notification.Text)[2] + `","new_password":"` + password + `"}`
+	}
+	c.do(request{method: http.MethodPost, path: "/api/user/password/reset/confirm", body: resetBody("short")}, http.StatusBadRequest)
+	c.do(request{method: http.MethodPost, path: "/api/user/password/reset/confirm", body: resetBody("Passw0rd!")}, http.StatusNoContent)
+	c.do(request{method: http.MethodPost, path: "/api/user/password/reset/confirm", body: resetBody("Passw0rd!")}, http.StatusBadRequest)
+	c.do(request{method: http.MethodGet, path: "/api/user/sessions", cookie: other}, http.StatusUnauthorized)
+	other = cookie(t, c.do(request{method: http.MethodPost, path: "/api/user/login", body: `{"login":"user2","password":"Passw0rd!"}`}, http.StatusOK))
+
+	// data export and account deletion
+	w = c.do(request{method: http.MethodGet, path: "/api/user/export", cookie: user}, http.StatusOK)
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	var names []string
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	require.Equal(t, []string{"profile.json", "orders.json", "adjustments.json", "withdrawals.json", "events.json", "sessions.json"}, names)
+	deleted := cookie(t, c.do(request{method: http.MethodPost, path: "/api/user/register", body: `{"login":"user3","password":"Passw0rd!"}`}, http.StatusOK))
+	c.do(request{method: http.MethodPost, path: "/api/user/orders", contentType: "text/plain", body: "79927398747", cookie: deleted}, http.StatusAccepted)
+	c.do(request{method: http.MethodDelete, path: "/api/user", cookie: deleted}, http.StatusNoContent)
+	c.do(request{method: http.MethodGet, path: "/api/user/export", cookie: deleted}, http.StatusUnauthorized)
+	c.do(request{method: http.MethodPost, path: "/api/user/register", body: `{"login":"user3","password":"Passw0rd!"}`}, http.StatusOK)
+	c.do(request{method: http.MethodGet, path: "/api/user/orders", cookie: deleted}, http.StatusUnauthorized)
+	c.do(request{method: http.MethodPost, path: "/api/user/orders", contentType: "text/plain", body: "79927398747", cookie: other}, http.StatusConflict)
+
+	// api v2
+	v2Orders := "/api/v2/user/orders"
+	c.do(request{method: http.MethodPost, path: v2Orders, contentType: "text/plain", body: "79927398739", cookie: user}, http.StatusAccepted)
+	c.do(request{method: http.MethodPost, path: v2Orders, contentType: "text/plain", body: "79927398739", cookie: user}, http.StatusOK)
+	c.do(request{method: http.MethodPost, path: v2Orders, contentType: "text/plain", body: "79927398739", cookie: other}, http.StatusConflict)
+	c.do(request{method: http.MethodPost, path: v2Orders, contentType: "text/plain", body: "12345", cookie: user}, http.StatusUnprocessableEntity)
+	c.do(request{method: http.MethodPost, path: v2Orders + "/batch", contentType: "text/plain", body: "79927398739\n12345", cookie: user}, http.StatusOK)
+	c.do(request{method: http.MethodPost, path: v2Orders + "/batch", contentType: "text/plain", body: "\n", cookie: user}, http.StatusBadRequest)
+	w = c.do(request{method: http.MethodGet, path: v2Orders + "?limit=1", cookie: user}, http.StatusOK)
+	var orders struct {
+		Items []struct {
+			Accrual struct {
+				Amount   int64
+				Currency string
+			}
+		}
+		Pagination struct{ Total int }
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &orders))
+	require.Len(t, orders.Items, 1)
+	require.Equal(t, 4, orders.Pagination.Total)
+	require.Equal(t, int64(125), orders.Items[0].Accrual.Amount)
+	require.Equal(t, "points", orders.Items[0].Accrual.Currency)
+	w = c.do(request{method: http.MethodGet, path: v2Orders + "?limit=2&offset=3", cookie: user}, http.StatusOK)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &orders))
+	require.Len(t, orders.Items, 1)
+	c.do(request{method: http.MethodGet, path: v2Orders + "?limit=0", cookie: user}, http.StatusBadRequest)
+	c.do(request{method: http.MethodGet, path: "/api/v2/user/balance", cookie: user}, http.StatusOK)
+	c.do(request{method: http.MethodGet, path: "/api/v2/user/balance?at=yesterday", cookie: user}, http.StatusBadRequest)
+	c.do(request{method: http.MethodGet, path: "/api/v2/user/balance/history", cookie: user}, http.StatusOK)
+	c.do(request{method: http.MethodGet, path: "/api/v2/user/balance/history?offset=-1", cookie: user}, http.StatusBadRequest)
+	withdrawV2 := "/api/v2/user/balance/withdraw"
+	c.do(request{method: http.MethodPost, path: withdrawV2, contentType: "application/json",
+		body: `{"order":"2377225624","amount":{"amount":125,"currency":"points"}}`, cookie: user}, http.StatusOK)
+	c.do(request{method: http.MethodPost, path: withdrawV2, contentType: "application/json",
+		body: `{"order":"2377225624","amount":{"amount":125,"currency":"miles"}}`, cookie: user}, http.StatusBadRequest)
+	c.do(request{method: http.MethodPost, path: withdrawV2, contentType: "application/json",
+		body: `{"order":"2377225624","amount":{"amount":10000000}}`, cookie: user}, http.StatusPaymentRequired)
+	c.do(request{method: http.MethodPost, path: withdrawV2, contentType: "application/json",
+		body: `{"order":"12345","amount":{"amount":1}}`, cookie: user}, http.StatusUnprocessableEntity)
+	c.do(request{method: http.MethodGet, path: "/api/v2/user/withdrawals", cookie: user}, http.StatusOK)
+	c.do(request{method: http.MethodGet, path: "/api/v2/user/withdrawals?limit=many", cookie: user}, http.StatusBadRequest)
+	c.do(request{method: http.MethodGet, path: "/api/v2/user/adjustments", cookie: user}, http.StatusOK)
+	c.do(request{method: http.MethodGet, path: "/api/v2/user/adjustments?limit=1001", cookie: user}, http.StatusBadRequest)
+
+	// statuses shared by operations: missing credentials, body size and content type
+	for template, operations := range spec.Paths {
+		for method, operation := range operations {
+			req := request{method: strings.ToUpper(method), path: strings.ReplaceAll(template, "{id}", "1"), cookie: user}
+			req.path = strings.ReplaceAll(strings.ReplaceAll(req.path, "{number}", "79927398713"), "{login}", "user1")
+			req.path = strings.ReplaceAll(req.path, "{name}", "reconciler")
+			if strings.HasPrefix(template, "/api/admin") {
+				c.do(req, http.StatusForbidden)
+				req.cookie, req.headers = "", admin
+			}
+			if _, ok := operation.Responses["401"]; ok && template != "/api/user/login" && template != "/api/user/login/2fa" {
+				c.do(request{method: req.method, path: req.path}, http.StatusUnauthorized)
+			}
+			if operation.RequestBody == nil {
+				continue
+			}
+			for contentType := range operation.RequestBody.Content {
+				req.contentType = contentType
+			}
+			req.body = strings.Repeat("1", 2048)
+			c.do(req, http.StatusRequestEntityTooLarge)
+			req.contentType, req.body = "application/xml", "<order/>"
+			c.do(req, http.StatusUnsupportedMediaType)
+		}
+	}
+
+	limits.exhausted = true
+	for template, operations := range spec.Paths {
+		for method, operation := range operations {
+			if _, ok := operation.Responses["429"]; !ok {
+				continue
+			}
+			path := strings.ReplaceAll(strings.ReplaceAll(template, "{id}", "1"), "{number}", "79927398713")
+			w := c.do(request{method: strings.ToUpper(method), path: path, cookie: user}, http.StatusTooManyRequests)
+			require.NotEmpty(t, w.Header().Get("Retry-After"))
+		}
+	}
+
+	for template, operations := range spec.Paths {
+		for method, operation := range operations {
+			for status := range operation.Responses {
+				key := operationKey(strings.ToUpper(method), template, status)
+				require.True(t, status == "default" || c.covered[key], "%s is not exercised", key)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const sseRetry = 3 * time.Second
+
+func (h *ApiHandler) writeEvents(ctx context.Context, w io.Writer, login string, lastID int64) (int64, error) {
+	for {
+		events, err := h.Events.GetEvents(ctx, login, lastID)
+		if err != nil {
+			return lastID, err
+		}
+		for _, event := range events {
+			if _, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data); err != nil {
+				return lastID, err
+			}
+			lastID = event.ID
+		}
+		if len(events) < h.Events.BatchSize {
+			return lastID, nil
+		}
+	}
+}
+
+// StreamEvents streams events of user as server-sent events, a reconnecting client
+// gets events missed after Last-Event-ID, a new one only events happening after connection.
+func (h *ApiHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	login := r.Header.Get("Login")
+	ctx := r.Context()
+
+	wake, unsubscribe := h.Events.Subscribe(login)
+	defer unsubscribe()
+
+	var lastID int64
+	var err error
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		lastID, err = strconv.ParseInt(header, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	} else if lastID, err = h.Events.GetLastEventID(ctx, login); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds())
+
+	heartbeat := time.NewTicker(h.Events.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		if lastID, err = h.writeEvents(ctx, w, login, lastID); err != nil {
+			return
+		}
+		if err = controller.Flush(); err != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+	}
+}
@@ -3,26 +3,74 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
-	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/go-chi/chi"
+
+	"github.com/valinurovdenis/gomart/internal/app/account"
 	"github.com/valinurovdenis/gomart/internal/app/accrualorder"
+	"github.com/valinurovdenis/gomart/internal/app/events"
 	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/programs"
+	"github.com/valinurovdenis/gomart/internal/app/ratelimit"
 	"github.com/valinurovdenis/gomart/internal/app/service"
+	"github.com/valinurovdenis/gomart/internal/app/statement"
+	"github.com/valinurovdenis/gomart/internal/app/twofactor"
 	"github.com/valinurovdenis/gomart/internal/app/validators"
+	"github.com/valinurovdenis/gomart/internal/app/webhooks"
 	"github.com/valinurovdenis/gomart/internal/app/withdrawstorage"
 )
 
 type ApiHandler struct {
-	Service service.OrderService
+	Service    service.OrderService
+	Limits     validators.Limits
+	Webhooks   *webhooks.WebhookService
+	Events     *events.EventStream
+	Statements statement.StatementStorage
+	Limiter    *ratelimit.Limiter
+	Accounts   *account.AccountService
+}
+
+type withdrawRequest struct {
+	Order   string      `json:"order"`
+	Sum     json.Number `json:"sum"`
+	Program string      `json:"program"`
+}
+
+// listAdapter writes items fetched by handler shared between api versions in format of the version.
+type listAdapter[T any] func(w http.ResponseWriter, r *http.Request, items []T)
+
+// objectAdapter is listAdapter of single value.
+type objectAdapter[T any] func(w http.ResponseWriter, r *http.Request, value T)
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeList is v1 format of lists: 204 without items.
+func writeList[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	if len(items) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, items)
+}
+
+func writeObject[T any](w http.ResponseWriter, r *http.Request, value T) {
+	writeJSON(w, value)
 }
 
 func (h *ApiHandler) AddUserOrder(w http.ResponseWriter, r *http.Request) {
 	login := r.Header.Get("Login")
 
-	number, err := io.ReadAll(r.Body)
+	number, err := validators.ReadBody(r.Body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		validators.WriteError(w, err, validators.ErrorStatus(err))
 		return
 	}
 
@@ -41,56 +89,158 @@ func (h *ApiHandler) AddUserOrder(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *ApiHandler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
+func (h *ApiHandler) AddUserOrders(w http.ResponseWriter, r *http.Request) {
 	login := r.Header.Get("Login")
 
-	orders, err := h.Service.GetUserOrders(r.Context(), login)
+	body, err := validators.ReadBody(r.Body)
+	if err != nil {
+		validators.WriteError(w, err, validators.ErrorStatus(err))
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	numbers, err := validators.ParseOrderNumbers(mediaType, body, h.Limits.MaxBatchOrders)
+	if err != nil {
+		validators.WriteError(w, err, http.StatusBadRequest)
+		return
+	}
 
+	results, err := h.Service.AddUserOrders(r.Context(), login, numbers)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if len(orders) == 0 {
-		w.WriteHeader(http.StatusNoContent)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
+}
+
+func (h *ApiHandler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
+	h.getUserOrders(w, r, writeList)
+}
+
+func (h *ApiHandler) getUserOrders(w http.ResponseWriter, r *http.Request, write listAdapter[orderstorage.UserOrder]) {
+	login := r.Header.Get("Login")
+
+	orders, err := h.Service.GetUserOrders(r.Context(), login)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(orders)
+
+	write(w, r, orders)
 }
 
 func (h *ApiHandler) GetUserBalance(w http.ResponseWriter, r *http.Request) {
+	h.getUserBalance(w, r, writeObject)
+}
+
+func (h *ApiHandler) getUserBalance(w http.ResponseWriter, r *http.Request, write objectAdapter[service.UserBalances]) {
 	login := r.Header.Get("Login")
 
-	userBalance, err := h.Service.GetUserBalance(r.Context(), login)
+	var userBalance service.UserBalances
+	var err error
+	if value := r.URL.Query().Get("at"); value != "" {
+		at, parseErr := time.Parse(time.RFC3339, value)
+		if parseErr != nil {
+			validators.WriteError(w, validators.NewFieldError("at", "must be RFC 3339 time"), http.StatusBadRequest)
+			return
+		}
+		userBalance, err = h.Service.GetUserBalanceAt(r.Context(), login, at)
+	} else {
+		userBalance, err = h.Service.GetUserBalance(r.Context(), login)
+	}
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(userBalance)
+	write(w, r, userBalance)
+}
+
+func (h *ApiHandler) GetBalanceHistory(w http.ResponseWriter, r *http.Request) {
+	h.getBalanceHistory(w, r, writeList)
+}
+
+func (h *ApiHandler) getBalanceHistory(w http.ResponseWriter, r *http.Request, write listAdapter[statement.BalancePoint]) {
+	login := r.Header.Get("Login")
+
+	validationErr := &validators.ValidationError{}
+	last := time.Now().UTC().Truncate(24 * time.Hour)
+	if value := r.URL.Query().Get("to"); value != "" {
+		parsed, err := time.Parse(statement.DateLayout, value)
+		if err != nil {
+			validationErr.Add("to", "must be a date")
+		}
+		last = parsed
+	}
+	first := last.AddDate(0, 0, -30)
+	if value := r.URL.Query().Get("from"); value != "" {
+		parsed, err := time.Parse(statement.DateLayout, value)
+		if err != nil {
+			validationErr.Add("from", "must be a date")
+		}
+		first = parsed
+	}
+	if err := validationErr.OrNil(); err != nil {
+		validators.WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	points, err := h.Service.GetBalanceHistory(r.Context(), login, first, last)
+
+	var fieldErr *validators.ValidationError
+	if errors.As(err, &fieldErr) {
+		validators.WriteError(w, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	write(w, r, points)
 }
 
 func (h *ApiHandler) WithdrawOrder(w http.ResponseWriter, r *http.Request) {
 	login := r.Header.Get("Login")
 
-	var withdraw withdrawstorage.UserWithdraw
-	if err := json.NewDecoder(r.Body).Decode(&withdraw); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var request withdrawRequest
+	if err := validators.DecodeJSON(r.Body, &request); err != nil {
+		validators.WriteError(w, err, validators.ErrorStatus(err))
 		return
 	}
-	withdraw.Login = login
+	sum, err := validators.ParseAmount("sum", request.Sum, h.Limits.MaxWithdraw)
+	if err != nil {
+		validators.WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+	withdraw := withdrawstorage.UserWithdraw{Login: login, Number: request.Order, Program: request.Program}
+	withdraw.Withdraw.Balance = sum
 
+	h.withdraw(w, r, withdraw, "program", "sum")
+}
+
+// withdraw adds withdraw reporting program and precision errors as errors of request fields.
+func (h *ApiHandler) withdraw(w http.ResponseWriter, r *http.Request, withdraw withdrawstorage.UserWithdraw, programField string, sumField string) {
 	err := h.Service.AddUserWithdraw(r.Context(), withdraw)
 
-	if errors.Is(err, service.ErrNotEnoughBalance) {
+	if errors.Is(err, service.ErrNotEnoughBalance) || errors.Is(err, service.ErrNegativeBalance) {
 		http.Error(w, err.Error(), http.StatusPaymentRequired)
 		return
+	} else if errors.Is(err, twofactor.ErrConfirmationRequired) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
 	} else if errors.Is(err, validators.ErrInvalidOrder) {
 		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 		return
+	} else if errors.Is(err, programs.ErrUnknownProgram) {
+		validators.WriteError(w, validators.NewFieldError(programField, err.Error()), http.StatusBadRequest)
+		return
+	} else if errors.Is(err, programs.ErrTooPrecise) {
+		validators.WriteError(w, validators.NewFieldError(sumField, err.Error()), http.StatusBadRequest)
+		return
 	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -100,6 +250,10 @@ func (h *ApiHandler) WithdrawOrder(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *ApiHandler) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
+	h.getWithdrawals(w, r, writeList)
+}
+
+func (h *ApiHandler) getWithdrawals(w http.ResponseWriter, r *http.Request, write listAdapter[withdrawstorage.UserWithdraw]) {
 	login := r.Header.Get("Login")
 
 	withdrawals, err := h.Service.GetUserWithdrawals(r.Context(), login)
@@ -108,15 +262,86 @@ func (h *ApiHandler) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(withdrawals) == 0 {
-		w.WriteHeader(http.StatusNoContent)
+	write(w, r, withdrawals)
+}
+
+func (h *ApiHandler) GetAdjustments(w http.ResponseWriter, r *http.Request) {
+	h.getAdjustments(w, r, writeList)
+}
+
+func (h *ApiHandler) getAdjustments(w http.ResponseWriter, r *http.Request, write listAdapter[orderstorage.Adjustment]) {
+	login := r.Header.Get("Login")
+
+	adjustments, err := h.Service.GetUserAdjustments(r.Context(), login)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	write(w, r, adjustments)
+}
+
+func (h *ApiHandler) RecheckOrder(w http.ResponseWriter, r *http.Request) {
+	order, err := h.Service.RecheckOrder(r.Context(), chi.URLParam(r, "number"))
+
+	if errors.Is(err, orderstorage.ErrOrderNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if errors.Is(err, service.ErrOrderNotFinal) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if errors.Is(err, accrualorder.ErrNoSuchOrder) || errors.Is(err, accrualorder.ErrNoAnswer) {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(order)
+}
+
+type reverseRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (h *ApiHandler) ReverseWithdraw(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		validators.WriteError(w, validators.NewFieldError("id", "must be an integer"), http.StatusBadRequest)
+		return
+	}
+
+	var request reverseRequest
+	if err = validators.DecodeJSON(r.Body, &request); err != nil {
+		validators.WriteError(w, err, validators.ErrorStatus(err))
+		return
+	}
+
+	withdraw, err := h.Service.ReverseWithdraw(r.Context(), id, request.Reason)
+
+	var validationErr *validators.ValidationError
+	if errors.As(err, &validationErr) {
+		validators.WriteError(w, err, http.StatusBadRequest)
+		return
+	} else if errors.Is(err, withdrawstorage.ErrWithdrawNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if errors.Is(err, withdrawstorage.ErrAlreadyReversed) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(withdrawals)
+	json.NewEncoder(w).Encode(withdraw)
 }
 
-func NewApiHandler(service service.OrderService) *ApiHandler {
-	return &ApiHandler{Service: service}
+func NewApiHandler(service service.OrderService, limits validators.Limits) *ApiHandler {
+	return &ApiHandler{Service: service, Limits: limits}
 }
@@ -1,27 +1,122 @@
 package handlers
 
 import (
+	"net/http"
+
 	"github.com/go-chi/chi"
 	"github.com/valinurovdenis/gomart/internal/app/auth"
 	"github.com/valinurovdenis/gomart/internal/app/gzip"
 	"github.com/valinurovdenis/gomart/internal/app/logger"
+	"github.com/valinurovdenis/gomart/internal/app/openapi"
+	"github.com/valinurovdenis/gomart/internal/app/rbac"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
 )
 
+// MartRouter serves routes documented in openapi.json, requests are validated against
+// the document after authentication, so unauthenticated ones get 401 first.
+// User routes are rate limited by their documented path if handler has limiter.
+// Routes declare permission they require, role of authenticated identity is checked before validation.
 func MartRouter(handler ApiHandler, auth auth.JwtAuthenticator) chi.Router {
+	spec := openapi.MustLoad()
+	limit := func(h http.Handler) http.Handler { return h }
+	if handler.Limiter != nil {
+		limit = handler.Limiter.Middleware(func(r *http.Request) string {
+			_, template, _ := spec.Find(r.Method, r.URL.Path)
+			return r.Method + " " + template
+		})
+	}
 	r := chi.NewRouter()
 	r.Use(logger.RequestLogger)
 	r.Use(gzip.GzipMiddleware)
+	r.Use(validators.LimitBody(handler.Limits.MaxBodySize))
 
-	r.Post("/api/user/register", auth.Register)
-	r.Post("/api/user/login", auth.Login)
+	r.Get("/openapi.json", openapi.ServeSpec)
+	r.With(limit, spec.ValidateRequest).Post("/api/user/register", auth.Register)
+	r.With(limit, spec.ValidateRequest).Post("/api/user/login", auth.Login)
+	if auth.TwoFactor != nil {
+		r.With(limit, spec.ValidateRequest).Post("/api/user/login/2fa", auth.VerifyLoginHandler)
+	}
+	if auth.Reset != nil {
+		r.With(limit, spec.ValidateRequest).Post("/api/user/password/reset", auth.RequestPasswordReset)
+		r.With(limit, spec.ValidateRequest).Post("/api/user/password/reset/confirm", auth.ResetPasswordHandler)
+	}
 
 	r.Route("/", func(r chi.Router) {
 		r.Use(auth.Authenticate)
+		r.Use(auth.Require(rbac.OwnAccount))
+		r.Use(limit)
+		r.Use(spec.ValidateRequest)
 		r.Post("/api/user/orders", handler.AddUserOrder)
+		r.Post("/api/user/orders/batch", handler.AddUserOrders)
 		r.Get("/api/user/orders", handler.GetUserOrders)
 		r.Get("/api/user/balance", handler.GetUserBalance)
+		r.Get("/api/user/balance/history", handler.GetBalanceHistory)
 		r.Post("/api/user/balance/withdraw", handler.WithdrawOrder)
 		r.Get("/api/user/withdrawals", handler.GetWithdrawals)
+		r.Get("/api/user/adjustments", handler.GetAdjustments)
+		r.Post("/api/user/password", auth.ChangePasswordHandler)
+
+		if handler.Statements != nil {
+			r.Get("/api/user/statement", handler.GetStatement)
+		}
+
+		if handler.Events != nil {
+			r.Get("/api/user/events", handler.StreamEvents)
+		}
+
+		if auth.Guard != nil {
+			r.Get("/api/user/sessions", auth.GetSessions)
+		}
+
+		if handler.Accounts != nil {
+			r.Get("/api/user/export", handler.ExportUserData)
+			r.Delete("/api/user", handler.DeleteUser)
+		}
+
+		if auth.TwoFactor != nil {
+			r.Post("/api/user/2fa", auth.EnrollTwoFactor)
+			r.Post("/api/user/2fa/verify", auth.VerifyTwoFactor)
+			r.Post("/api/user/2fa/confirm", auth.ConfirmTwoFactor)
+			r.Post("/api/user/2fa/disable", auth.DisableTwoFactor)
+		}
+
+		if handler.Webhooks != nil {
+			r.Post("/api/user/webhooks", handler.Subscribe)
+			r.Get("/api/user/webhooks", handler.GetSubscriptions)
+			r.Delete("/api/user/webhooks/{id}", handler.Unsubscribe)
+			r.Post("/api/user/webhooks/{id}/enable", handler.EnableSubscription)
+			r.Get("/api/user/webhooks/{id}/deliveries", handler.GetDeliveries)
+		}
+
+		// v2 returns amounts in minor units and pages of lists, v1 responses stay unchanged
+		r.Post("/api/v2/user/orders", handler.AddUserOrder)
+		r.Post("/api/v2/user/orders/batch", handler.AddUserOrders)
+		r.Get("/api/v2/user/orders", handler.GetUserOrdersV2)
+		r.Get("/api/v2/user/balance", handler.GetUserBalanceV2)
+		r.Get("/api/v2/user/balance/history", handler.GetBalanceHistoryV2)
+		r.Post("/api/v2/user/balance/withdraw", handler.WithdrawOrderV2)
+		r.Get("/api/v2/user/withdrawals", handler.GetWithdrawalsV2)
+		r.Get("/api/v2/user/adjustments", handler.GetAdjustmentsV2)
+	})
+
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(auth.AuthenticateAdmin)
+		require := func(permission rbac.Permission) chi.Router {
+			return r.With(auth.Require(permission), spec.ValidateRequest)
+		}
+		require(rbac.ReverseWithdrawals).Post("/withdrawals/{id}/reverse", handler.ReverseWithdraw)
+		require(rbac.RecheckOrders).Post("/orders/{number}/recheck", handler.RecheckOrder)
+		require(rbac.ManageAccess).Put("/users/{login}/role", auth.SetUserRole)
+
+		if auth.Guard != nil {
+			require(rbac.UnlockUsers).Post("/users/{login}/unlock", auth.UnlockUser)
+		}
+
+		if auth.ServiceAccounts != nil {
+			require(rbac.ManageAccess).Post("/service-accounts", auth.CreateServiceAccount)
+			require(rbac.ManageAccess).Get("/service-accounts", auth.GetServiceAccounts)
+			require(rbac.ManageAccess).Delete("/service-accounts/{name}", auth.DeleteServiceAccount)
+		}
 	})
 
 	return r
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/valinurovdenis/gomart/internal/app/logger"
+	"github.com/valinurovdenis/gomart/internal/app/statement"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+	"go.uber.org/zap"
+)
+
+const dateLayout = "2006-01-02"
+
+// parseBound parses RFC 3339 time or a date, dates of upper bound include the whole day.
+func parseBound(value string, upper bool) (time.Time, bool) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, true
+	}
+	parsed, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if upper {
+		parsed = parsed.AddDate(0, 0, 1)
+	}
+	return parsed, true
+}
+
+func parsePeriod(r *http.Request) (time.Time, time.Time, error) {
+	validationErr := &validators.ValidationError{}
+	from, to := time.Time{}, time.Now()
+	var ok bool
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, ok = parseBound(value, false); !ok {
+			validationErr.Add("from", "must be a date or RFC 3339 time")
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to, ok = parseBound(value, true); !ok {
+			validationErr.Add("to", "must be a date or RFC 3339 time")
+		}
+	}
+	if validationErr.OrNil() == nil && !from.Before(to) {
+		validationErr.Add("to", "must be after from")
+	}
+	return from, to, validationErr.OrNil()
+}
+
+// GetStatement streams orders, withdrawals and other balance changes of period with running balance.
+func (h *ApiHandler) GetStatement(w http.ResponseWriter, r *http.Request) {
+	login := r.Header.Get("Login")
+
+	from, to, err := parsePeriod(r)
+	if err != nil {
+		validators.WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	contentType, err := statement.ContentType(format)
+	if errors.Is(err, statement.ErrUnknownFormat) {
+		validators.WriteError(w, validators.NewFieldError("format", "must be csv, json or ndjson"), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if format == "csv" {
+		w.Header().Set("Content-Disposition", `attachment; filename="statement.csv"`)
+	}
+	// headers are sent with the first entry, so failures before it still get an error status
+	var writer statement.Writer
+	started := false
+	start := func() (err error) {
+		started = true
+		w.WriteHeader(http.StatusOK)
+		writer, err = statement.NewWriter(format, w)
+		return err
+	}
+	err = h.Statements.StreamStatement(r.Context(), login, from, to, func(entry statement.Entry) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return writer.Write(entry)
+	})
+	if err != nil && !started {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if err != nil {
+		logger.Log.Error("statement interrupted", zap.String("login", login), zap.Error(err))
+		return
+	}
+	if !started && start() != nil {
+		return
+	}
+	writer.Close()
+}
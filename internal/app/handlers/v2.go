@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/service"
+	"github.com/valinurovdenis/gomart/internal/app/statement"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+	"github.com/valinurovdenis/gomart/internal/app/withdrawstorage"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// money is v2 amount in hundredths of the currency, which is a loyalty program code.
+type money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type pagination struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+	Total  int `json:"total"`
+}
+
+// page is v2 format of lists, empty list is returned as well.
+type page[T any] struct {
+	Items      []T        `json:"items"`
+	Pagination pagination `json:"pagination"`
+}
+
+type orderV2 struct {
+	Number     string    `json:"number"`
+	Status     string    `json:"status"`
+	Accrual    money     `json:"accrual"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+type programBalanceV2 struct {
+	Program   string `json:"program"`
+	Name      string `json:"name"`
+	Current   money  `json:"current"`
+	Withdrawn money  `json:"withdrawn"`
+}
+
+type expiringPointsV2 struct {
+	Amount    money     `json:"amount"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type balanceV2 struct {
+	Programs     []programBalanceV2 `json:"programs"`
+	ExpiringSoon []expiringPointsV2 `json:"expiring_soon"`
+}
+
+type balancePointV2 struct {
+	Date    string `json:"date"`
+	Balance money  `json:"balance"`
+}
+
+type withdrawalV2 struct {
+	ID            int64      `json:"id"`
+	Order         string     `json:"order"`
+	Amount        money      `json:"amount"`
+	ProcessedAt   time.Time  `json:"processed_at"`
+	Status        string     `json:"status"`
+	ReversedAt    *time.Time `json:"reversed_at,omitempty"`
+	ReverseReason string     `json:"reverse_reason,omitempty"`
+}
+
+type adjustmentV2 struct {
+	Order     string    `json:"order"`
+	Amount    money     `json:"amount"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type withdrawRequestV2 struct {
+	Order  string `json:"order"`
+	Amount struct {
+		Amount int64 `json:"amount"`
+		// Currency is the default program if empty.
+		Currency string `json:"currency"`
+	} `json:"amount"`
+}
+
+// money converts balance of program, empty program is the default one.
+func (h *ApiHandler) money(balance currencybalance.CurrencyBalance, program string) money {
+	if program == "" {
+		program = h.Service.Programs.Default().Code
+	}
+	return money{Amount: balance.Balance, Currency: program}
+}
+
+func parsePagination(r *http.Request) (pagination, error) {
+	result := pagination{Limit: defaultPageLimit}
+	validationErr := &validators.ValidationError{}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			validationErr.Add("limit", fmt.Sprintf("must be an integer from 1 to %d", maxPageLimit))
+		}
+		result.Limit = limit
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			validationErr.Add("offset", "must be a non-negative integer")
+		}
+		result.Offset = offset
+	}
+	return result, validationErr.OrNil()
+}
+
+// writePage is v2 format of lists: requested page of items converted by convert. Pages are sliced from
+// the whole list on purpose: v2 lists are loaded by the same service calls as v1 ones, which return
+// everything, and balance history is a running total which needs every earlier entry anyway. Lists are
+// of a single user, move limit and offset into storages if they grow large.
+func writePage[T any, V any](convert func(T) V) listAdapter[T] {
+	return func(w http.ResponseWriter, r *http.Request, items []T) {
+		pagination, err := parsePagination(r)
+		if err != nil {
+			validators.WriteError(w, err, http.StatusBadRequest)
+			return
+		}
+		pagination.Total = len(items)
+		first := min(pagination.Offset, len(items))
+		last := min(first+pagination.Limit, len(items))
+		result := page[V]{Items: make([]V, 0, last-first), Pagination: pagination}
+		for _, item := range items[first:last] {
+			result.Items = append(result.Items, convert(item))
+		}
+		writeJSON(w, result)
+	}
+}
+
+func (h *ApiHandler) GetUserOrdersV2(w http.ResponseWriter, r *http.Request) {
+	h.getUserOrders(w, r, writePage(func(order orderstorage.UserOrder) orderV2 {
+		return orderV2{Number: order.Number, Status: string(order.Status), Accrual: h.money(order.Balance, order.Program), UploadedAt: order.Uploaded}
+	}))
+}
+
+func (h *ApiHandler) GetUserBalanceV2(w http.ResponseWriter, r *http.Request) {
+	h.getUserBalance(w, r, func(w http.ResponseWriter, r *http.Request, balances service.UserBalances) {
+		result := balanceV2{Programs: []programBalanceV2{}, ExpiringSoon: []expiringPointsV2{}}
+		for _, program := range balances.Programs {
+			result.Programs = append(result.Programs, programBalanceV2{Program: program.Program, Name: program.Name,
+				Current: h.money(program.Current, program.Program), Withdrawn: h.money(program.Withdrawn, program.Program)})
+		}
+		for _, expiring := range balances.ExpiringSoon {
+			result.ExpiringSoon = append(result.ExpiringSoon, expiringPointsV2{Amount: h.money(expiring.Amount, expiring.Program), ExpiresAt: expiring.ExpiresAt})
+		}
+		writeJSON(w, result)
+	})
+}
+
+func (h *ApiHandler) GetBalanceHistoryV2(w http.ResponseWriter, r *http.Request) {
+	h.getBalanceHistory(w, r, writePage(func(point statement.BalancePoint) balancePointV2 {
+		return balancePointV2{Date: point.Date, Balance: h.money(point.Balance, point.Program)}
+	}))
+}
+
+func (h *ApiHandler) WithdrawOrderV2(w http.ResponseWriter, r *http.Request) {
+	login := r.Header.Get("Login")
+
+	var request withdrawRequestV2
+	if err := validators.DecodeJSON(r.Body, &request); err != nil {
+		validators.WriteError(w, err, validators.ErrorStatus(err))
+		return
+	}
+	if request.Amount.Amount <= 0 {
+		validators.WriteError(w, validators.NewFieldError("amount.amount", "must be greater than zero"), http.StatusBadRequest)
+		return
+	}
+	if h.Limits.MaxWithdraw > 0 && request.Amount.Amount > h.Limits.MaxWithdraw {
+		validators.WriteError(w, validators.NewFieldError("amount.amount", fmt.Sprintf("must not exceed %d", h.Limits.MaxWithdraw)), http.StatusBadRequest)
+		return
+	}
+	withdraw := withdrawstorage.UserWithdraw{Login: login, Number: request.Order, Program: request.Amount.Currency}
+	withdraw.Withdraw.Balance = request.Amount.Amount
+
+	h.withdraw(w, r, withdraw, "amount.currency", "amount.amount")
+}
+
+func (h *ApiHandler) GetWithdrawalsV2(w http.ResponseWriter, r *http.Request) {
+	h.getWithdrawals(w, r, writePage(func(withdraw withdrawstorage.UserWithdraw) withdrawalV2 {
+		return withdrawalV2{ID: withdraw.ID, Order: withdraw.Number, Amount: h.money(withdraw.Withdraw, withdraw.Program),
+			ProcessedAt: withdraw.Processed, Status: string(withdraw.Status), ReversedAt: withdraw.Reversed, ReverseReason: withdraw.ReverseReason}
+	}))
+}
+
+func (h *ApiHandler) GetAdjustmentsV2(w http.ResponseWriter, r *http.Request) {
+	h.getAdjustments(w, r, writePage(func(adjustment orderstorage.Adjustment) adjustmentV2 {
+		return adjustmentV2{Order: adjustment.Number, Amount: h.money(adjustment.Amount, adjustment.Program), Reason: adjustment.Reason, CreatedAt: adjustment.Created}
+	}))
+}
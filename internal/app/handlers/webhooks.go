@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+	"github.com/valinurovdenis/gomart/internal/app/webhooks"
+)
+
+type subscribeRequest struct {
+	URL    string             `json:"url"`
+	Events []outbox.EventType `json:"events"`
+}
+
+func subscriptionID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		validators.WriteError(w, validators.NewFieldError("id", "must be an integer"), http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *ApiHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	login := r.Header.Get("Login")
+
+	var request subscribeRequest
+	if err := validators.DecodeJSON(r.Body, &request); err != nil {
+		validators.WriteError(w, err, validators.ErrorStatus(err))
+		return
+	}
+
+	subscription, err := h.Webhooks.Subscribe(r.Context(), login, request.URL, request.Events)
+
+	var validationErr *validators.ValidationError
+	if errors.As(err, &validationErr) {
+		validators.WriteError(w, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+func (h *ApiHandler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	login := r.Header.Get("Login")
+
+	subscriptions, err := h.Webhooks.GetSubscriptions(r.Context(), login)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(subscriptions) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+func (h *ApiHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	id, ok := subscriptionID(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Webhooks.Unsubscribe(r.Context(), r.Header.Get("Login"), id)
+
+	if errors.Is(err, webhooks.ErrSubscriptionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *ApiHandler) EnableSubscription(w http.ResponseWriter, r *http.Request) {
+	id, ok := subscriptionID(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Webhooks.Enable(r.Context(), r.Header.Get("Login"), id)
+
+	if errors.Is(err, webhooks.ErrSubscriptionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (h *ApiHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := subscriptionID(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.Webhooks.GetDeliveries(r.Context(), r.Header.Get("Login"), id)
+
+	if errors.Is(err, webhooks.ErrSubscriptionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(deliveries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(deliveries)
+}
@@ -0,0 +1,102 @@
+package jobqueue
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+const memoryRetryDelay = time.Minute
+
+type scheduledJob[T any] struct {
+	job          T
+	scheduledFor time.Time
+}
+
+type jobHeap[T any] []scheduledJob[T]
+
+func (h jobHeap[T]) Len() int           { return len(h) }
+func (h jobHeap[T]) Less(i, j int) bool { return h[i].scheduledFor.Before(h[j].scheduledFor) }
+func (h jobHeap[T]) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *jobHeap[T]) Push(x any)        { *h = append(*h, x.(scheduledJob[T])) }
+func (h *jobHeap[T]) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// MemoryQueue is an in-process queue for running without database, jobs are lost on restart.
+type MemoryQueue[T any] struct {
+	mu   sync.Mutex
+	jobs jobHeap[T]
+	wake chan struct{}
+}
+
+func (q *MemoryQueue[T]) Publish(ctx context.Context, job T, scheduledFor time.Time) error {
+	return q.PublishBatch(ctx, []T{job}, scheduledFor)
+}
+
+func (q *MemoryQueue[T]) PublishBatch(ctx context.Context, jobs []T, scheduledFor time.Time) error {
+	q.mu.Lock()
+	for _, job := range jobs {
+		heap.Push(&q.jobs, scheduledJob[T]{job: job, scheduledFor: scheduledFor})
+	}
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// next waits for the earliest job to become due.
+func (q *MemoryQueue[T]) next(ctx context.Context) (T, error) {
+	for {
+		q.mu.Lock()
+		wait := time.Hour
+		if len(q.jobs) > 0 {
+			wait = time.Until(q.jobs[0].scheduledFor)
+			if wait <= 0 {
+				item := heap.Pop(&q.jobs).(scheduledJob[T])
+				q.mu.Unlock()
+				return item.job, nil
+			}
+		}
+		q.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			var zero T
+			return zero, ctx.Err()
+		case <-q.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+func (q *MemoryQueue[T]) Consume(ctx context.Context, handler Handler[T]) error {
+	for {
+		job, err := q.next(ctx)
+		if err != nil {
+			return err
+		}
+		if processed, _ := handler(ctx, job); !processed {
+			q.Publish(ctx, job, time.Now().Add(memoryRetryDelay))
+		}
+	}
+}
+
+func (q *MemoryQueue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs)
+}
+
+func NewMemoryQueue[T any]() *MemoryQueue[T] {
+	return &MemoryQueue[T]{wake: make(chan struct{}, 1)}
+}
@@ -0,0 +1,90 @@
+package jobqueue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"go.dataddo.com/pgq"
+	"go.dataddo.com/pgq/x/schema"
+)
+
+// Handler processes queued job, job is delivered again unless handler reports it processed.
+type Handler[T any] func(ctx context.Context, job T) (bool, error)
+
+type Queue[T any] interface {
+	Publish(ctx context.Context, job T, scheduledFor time.Time) error
+
+	// PublishBatch publishes jobs at once, either all of them or none.
+	PublishBatch(ctx context.Context, jobs []T, scheduledFor time.Time) error
+
+	// Consume blocks handling due jobs until context is cancelled.
+	Consume(ctx context.Context, handler Handler[T]) error
+}
+
+// MetadataProvider is implemented by jobs which annotate queue messages for debugging.
+type MetadataProvider interface {
+	Metadata() map[string]string
+}
+
+type PgqQueue[T any] struct {
+	DB   *sql.DB
+	Name string
+}
+
+func (q *PgqQueue[T]) Init() {
+	tx, _ := q.DB.BeginTx(context.Background(), nil)
+	create := schema.GenerateCreateTableQuery(q.Name)
+	tx.Exec(create)
+	tx.Commit()
+}
+
+func (q *PgqQueue[T]) Publish(ctx context.Context, job T, scheduledFor time.Time) error {
+	return q.PublishBatch(ctx, []T{job}, scheduledFor)
+}
+
+func (q *PgqQueue[T]) PublishBatch(ctx context.Context, jobs []T, scheduledFor time.Time) error {
+	publisher := pgq.NewPublisher(q.DB)
+	msgs := make([]*pgq.MessageOutgoing, 0, len(jobs))
+	for _, job := range jobs {
+		payload, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		msg := &pgq.MessageOutgoing{Payload: payload, ScheduledFor: &scheduledFor}
+		if provider, ok := any(job).(MetadataProvider); ok {
+			msg.Metadata = provider.Metadata()
+		}
+		msgs = append(msgs, msg)
+	}
+	_, err := publisher.Publish(ctx, q.Name, msgs...)
+	return err
+}
+
+type pgqHandler[T any] struct {
+	handler Handler[T]
+}
+
+func (h pgqHandler[T]) HandleMessage(ctx context.Context, msg *pgq.MessageIncoming) (bool, error) {
+	var job T
+	if err := json.Unmarshal(msg.Payload, &job); err != nil {
+		return true, err
+	}
+	return h.handler(ctx, job)
+}
+
+func (q *PgqQueue[T]) Consume(ctx context.Context, handler Handler[T]) error {
+	consumer, err := pgq.NewConsumer(q.DB, q.Name, pgqHandler[T]{handler: handler})
+	if err != nil {
+		return err
+	}
+
+	return consumer.Run(ctx)
+}
+
+func NewPgqQueue[T any](db *sql.DB, name string) *PgqQueue[T] {
+	ret := &PgqQueue[T]{DB: db, Name: name}
+	ret.Init()
+	return ret
+}
@@ -0,0 +1,161 @@
+// Package lockout slows down and locks logins after failed password attempts and records sessions of users.
+package lockout
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"github.com/valinurovdenis/gomart/internal/app/txmanager"
+)
+
+// Settings of failed attempts: the first FreeFailures are not delayed, every next one delays
+// the following attempt by Delay doubled for each failure, LockAfter failures lock login for LockFor.
+// Failures older than LockFor are forgotten.
+type Settings struct {
+	FreeFailures int
+	Delay        time.Duration
+	LockAfter    int
+	LockFor      time.Duration
+}
+
+func (s Settings) delay(failures int) time.Duration {
+	if failures <= s.FreeFailures {
+		return 0
+	}
+	return s.Delay << min(failures-s.FreeFailures-1, 16)
+}
+
+var ErrTooManyFailures = errors.New("too many failed login attempts")
+var ErrLocked = errors.New("login is temporarily locked")
+
+// RetryError rejects login attempt made earlier than RetryAfter.
+type RetryError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// Client is the address and user agent login attempt is made from.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+const sessionsLimit = 50
+
+type Guard struct {
+	Storage   LockoutStorage
+	Outbox    outbox.OutboxStorage
+	TxManager txmanager.TxManager
+	Clock     clock.Clock
+	Settings  Settings
+}
+
+// Reserve rejects attempt to log in while login is locked or delayed after failures, otherwise it counts
+// the attempt as failed in the same unit of work, so that concurrent attempts are delayed by it. The caller
+// settles the attempt by Failed, Succeeded or Passed, attempts failing for other reasons stay counted.
+func (g *Guard) Reserve(ctx context.Context, login string) error {
+	now := g.Clock.Now()
+	return g.TxManager.Do(ctx, func(ctx context.Context) error {
+		attempts, err := g.Storage.LockAttempts(ctx, login)
+		if err != nil {
+			return err
+		}
+		if now.Before(attempts.LockedUntil) {
+			return &RetryError{Err: ErrLocked, RetryAfter: attempts.LockedUntil.Sub(now)}
+		}
+		if next := attempts.LastFailure.Add(g.Settings.delay(attempts.Failures)); now.Before(next) {
+			return &RetryError{Err: ErrTooManyFailures, RetryAfter: next.Sub(now)}
+		}
+		_, err = g.Storage.AddFailure(ctx, login, now, now.Add(-g.Settings.LockFor))
+		return err
+	})
+}
+
+// Failed locks login after too many reserved attempts failed, user is notified
+// of the lock if notify is set, it is not for logins of unknown users.
+func (g *Guard) Failed(ctx context.Context, login string, client Client, notify bool) error {
+	if g.Settings.LockAfter <= 0 {
+		return nil
+	}
+	until := g.Clock.Now().Add(g.Settings.LockFor)
+	return g.TxManager.Do(ctx, func(ctx context.Context) error {
+		attempts, err := g.Storage.LockAttempts(ctx, login)
+		if err != nil || attempts.Failures < g.Settings.LockAfter {
+			return err
+		}
+		if err = g.Storage.SetLockedUntil(ctx, login, until); err != nil {
+			return err
+		}
+		if !notify {
+			return nil
+		}
+		event, err := outbox.NewEvent(outbox.UserLocked, login,
+			outbox.UserLockedData{Failures: attempts.Failures, LockedUntil: until, IP: client.IP})
+		if err != nil {
+			return err
+		}
+		return g.Outbox.AddEvent(ctx, event)
+	})
+}
+
+// Passed takes back reserved attempt which did not fail on credentials but did not log in either,
+// such as one waiting for the second factor, failures before it are kept.
+func (g *Guard) Passed(ctx context.Context, login string) error {
+	return g.Storage.RemoveFailure(ctx, login)
+}
+
+// Succeeded resets failures of login and records its session, login from a new address is reported to user.
+func (g *Guard) Succeeded(ctx context.Context, login string, client Client) error {
+	sessions, err := g.Storage.GetSessions(ctx, login, sessionsLimit)
+	if err != nil {
+		return err
+	}
+	session := Session{Login: login, IP: client.IP, UserAgent: client.UserAgent, NewAddress: len(sessions) > 0, Created: g.Clock.Now()}
+	for _, previous := range sessions {
+		if previous.IP == client.IP {
+			session.NewAddress = false
+			break
+		}
+	}
+	return g.TxManager.Do(ctx, func(ctx context.Context) error {
+		if err := g.Storage.ResetAttempts(ctx, login); err != nil {
+			return err
+		}
+		if err := g.Storage.AddSession(ctx, session); err != nil {
+			return err
+		}
+		if !session.NewAddress {
+			return nil
+		}
+		event, err := outbox.NewEvent(outbox.UserLoginAnomaly, login,
+			outbox.UserLoginAnomalyData{IP: client.IP, UserAgent: client.UserAgent, Reason: "new address"})
+		if err != nil {
+			return err
+		}
+		return g.Outbox.AddEvent(ctx, event)
+	})
+}
+
+// Unlock lets login in again before its lock expires.
+func (g *Guard) Unlock(ctx context.Context, login string) error {
+	return g.Storage.ResetAttempts(ctx, login)
+}
+
+func (g *Guard) GetSessions(ctx context.Context, login string) ([]Session, error) {
+	return g.Storage.GetSessions(ctx, login, sessionsLimit)
+}
+
+func NewGuard(storage LockoutStorage, outboxStorage outbox.OutboxStorage, txManager txmanager.TxManager, clock clock.Clock, settings Settings) *Guard {
+	return &Guard{Storage: storage, Outbox: outboxStorage, TxManager: txManager, Clock: clock, Settings: settings}
+}
@@ -0,0 +1,164 @@
+package lockout_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/lockout"
+	"github.com/valinurovdenis/gomart/internal/app/memstorage"
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+)
+
+func TestGuard(t *testing.T) {
+	ctx := context.Background()
+	testClock := &clock.FixedClock{Time: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	storage := memstorage.NewMemoryStorage(testClock)
+	guard := lockout.NewGuard(storage, storage, storage, testClock,
+		lockout.Settings{FreeFailures: 2, Delay: time.Second, LockAfter: 5, LockFor: 15 * time.Minute})
+	client := lockout.Client{IP: "10.0.0.1", UserAgent: "test"}
+
+	// free failures are not delayed, the next ones double the delay
+	for _, delay := range []time.Duration{0, 0, time.Second, 2 * time.Second} {
+		require.NoError(t, guard.Reserve(ctx, "user"))
+		require.NoError(t, guard.Failed(ctx, "user", client, true))
+		if delay == 0 {
+			continue
+		}
+		var retryErr *lockout.RetryError
+		require.ErrorAs(t, guard.Reserve(ctx, "user"), &retryErr)
+		require.ErrorIs(t, retryErr, lockout.ErrTooManyFailures)
+		require.Equal(t, delay, retryErr.RetryAfter)
+		testClock.Advance(delay)
+	}
+
+	// the fifth failure locks login and notifies user
+	require.NoError(t, guard.Reserve(ctx, "user"))
+	require.NoError(t, guard.Failed(ctx, "user", client, true))
+	var retryErr *lockout.RetryError
+	require.ErrorAs(t, guard.Reserve(ctx, "user"), &retryErr)
+	require.ErrorIs(t, retryErr, lockout.ErrLocked)
+	require.Equal(t, 15*time.Minute, retryErr.RetryAfter)
+	events, err := storage.GetUserEvents(ctx, "user", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, outbox.UserLocked, events[0].Type)
+	var locked outbox.UserLockedData
+	require.NoError(t, json.Unmarshal(events[0].Data, &locked))
+	require.Equal(t, outbox.UserLockedData{Failures: 5, LockedUntil: testClock.Time.Add(15 * time.Minute), IP: "10.0.0.1"}, locked)
+
+	// lock expires with failures counted before it
+	testClock.Advance(15 * time.Minute)
+	require.NoError(t, guard.Reserve(ctx, "user"))
+	require.NoError(t, guard.Failed(ctx, "user", client, true))
+	require.NoError(t, guard.Reserve(ctx, "user"))
+
+	// unknown logins are locked silently
+	for i := 0; i < 5; i++ {
+		require.NoError(t, guard.Reserve(ctx, "nobody"))
+		require.NoError(t, guard.Failed(ctx, "nobody", client, false))
+		testClock.Advance(10 * time.Second)
+	}
+	require.ErrorIs(t, guard.Reserve(ctx, "nobody"), lockout.ErrLocked)
+	events, err = storage.GetUserEvents(ctx, "nobody", 0, 10)
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	// unlock lets login in at once
+	require.NoError(t, guard.Unlock(ctx, "nobody"))
+	require.NoError(t, guard.Reserve(ctx, "nobody"))
+}
+
+func TestGuardConcurrentAttempts(t *testing.T) {
+	const guesses = 10
+	ctx := context.Background()
+	testClock := &clock.FixedClock{Time: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	storage := memstorage.NewMemoryStorage(testClock)
+	guard := lockout.NewGuard(storage, storage, storage, testClock,
+		lockout.Settings{FreeFailures: 1, Delay: time.Second, LockAfter: 5, LockFor: time.Minute})
+
+	// parallel guesses are delayed by the ones reserved before them
+	var wg sync.WaitGroup
+	var reserved atomic.Int32
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := guard.Reserve(ctx, "user")
+			if err == nil {
+				reserved.Add(1)
+			} else {
+				require.ErrorIs(t, err, lockout.ErrTooManyFailures)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(2), reserved.Load())
+
+	// correct password waiting for the second factor is not counted
+	require.NoError(t, guard.Passed(ctx, "user"))
+	attempts, err := storage.GetAttempts(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, 1, attempts.Failures)
+}
+
+func TestGuardForgetsOldFailures(t *testing.T) {
+	ctx := context.Background()
+	testClock := &clock.FixedClock{Time: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	storage := memstorage.NewMemoryStorage(testClock)
+	guard := lockout.NewGuard(storage, storage, storage, testClock,
+		lockout.Settings{FreeFailures: 0, Delay: time.Second, LockAfter: 2, LockFor: time.Minute})
+	client := lockout.Client{IP: "10.0.0.1"}
+
+	require.NoError(t, guard.Reserve(ctx, "user"))
+	require.NoError(t, guard.Failed(ctx, "user", client, true))
+	testClock.Advance(time.Minute + time.Second)
+	require.NoError(t, guard.Reserve(ctx, "user"))
+	require.NoError(t, guard.Failed(ctx, "user", client, true))
+	attempts, err := storage.GetAttempts(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, 1, attempts.Failures)
+	require.True(t, attempts.LockedUntil.IsZero())
+}
+
+func TestGuardSessions(t *testing.T) {
+	ctx := context.Background()
+	testClock := &clock.FixedClock{Time: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	storage := memstorage.NewMemoryStorage(testClock)
+	guard := lockout.NewGuard(storage, storage, storage, testClock,
+		lockout.Settings{FreeFailures: 0, Delay: time.Second, LockAfter: 3, LockFor: time.Minute})
+	home := lockout.Client{IP: "10.0.0.1", UserAgent: "browser"}
+	away := lockout.Client{IP: "10.0.0.2", UserAgent: "phone"}
+
+	require.NoError(t, guard.Reserve(ctx, "user"))
+	require.NoError(t, guard.Failed(ctx, "user", home, true))
+	require.Error(t, guard.Reserve(ctx, "user"))
+	// success resets failures, the first session is not an anomaly
+	require.NoError(t, guard.Succeeded(ctx, "user", home))
+	require.NoError(t, guard.Reserve(ctx, "user"))
+	testClock.Advance(time.Hour)
+	require.NoError(t, guard.Succeeded(ctx, "user", away))
+	testClock.Advance(time.Hour)
+	require.NoError(t, guard.Succeeded(ctx, "user", home))
+
+	sessions, err := guard.GetSessions(ctx, "user")
+	require.NoError(t, err)
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	require.Equal(t, []lockout.Session{
+		{Login: "user", IP: "10.0.0.1", UserAgent: "browser", Created: start.Add(2 * time.Hour)},
+		{Login: "user", IP: "10.0.0.2", UserAgent: "phone", NewAddress: true, Created: start.Add(time.Hour)},
+		{Login: "user", IP: "10.0.0.1", UserAgent: "browser", Created: start},
+	}, sessions)
+
+	events, err := storage.GetUserEvents(ctx, "user", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, outbox.UserLoginAnomaly, events[0].Type)
+	require.JSONEq(t, `{"ip":"10.0.0.2","user_agent":"phone","reason":"new address"}`, string(events[0].Data))
+}
@@ -0,0 +1,149 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valinurovdenis/gomart/internal/app/pgdb"
+)
+
+// Attempts are failed login attempts of a login since its last successful login or unlock.
+type Attempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Session is a successful login, NewAddress marks login from IP not seen in previous sessions.
+type Session struct {
+	Login      string    `json:"-"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	NewAddress bool      `json:"new_address"`
+	Created    time.Time `json:"created_at"`
+}
+
+//go:generate mockery --name LockoutStorage
+type LockoutStorage interface {
+	GetAttempts(ctx context.Context, login string) (Attempts, error)
+
+	// LockAttempts returns attempts of login locking them until the end of unit of work.
+	LockAttempts(ctx context.Context, login string) (Attempts, error)
+
+	// AddFailure counts failed attempt made at time and returns updated attempts,
+	// failures are counted from one if the previous one was made before since.
+	AddFailure(ctx context.Context, login string, at time.Time, since time.Time) (Attempts, error)
+
+	// RemoveFailure takes back the last counted failure.
+	RemoveFailure(ctx context.Context, login string) error
+
+	// SetLockedUntil locks login until time resetting its failures.
+	SetLockedUntil(ctx context.Context, login string, until time.Time) error
+
+	// ResetAttempts clears failures and lock of login.
+	ResetAttempts(ctx context.Context, login string) error
+
+	AddSession(ctx context.Context, session Session) error
+
+	// GetSessions returns the latest sessions of user first.
+	GetSessions(ctx context.Context, login string, limit int) ([]Session, error)
+}
+
+type DatabaseLockoutStorage struct {
+	Pool *pgxpool.Pool
+}
+
+func (s *DatabaseLockoutStorage) Init() error {
+	return pgdb.ExecBatch(context.Background(), s.Pool,
+		`CREATE TABLE IF NOT EXISTS login_attempts("login" TEXT PRIMARY KEY, "failures" INT DEFAULT 0, "last_failure" TIMESTAMPTZ, "locked_until" TIMESTAMPTZ)`,
+		`CREATE TABLE IF NOT EXISTS login_sessions("id" BIGSERIAL PRIMARY KEY, "login" TEXT, "ip" TEXT, "user_agent" TEXT, "new_address" BOOLEAN, "created" TIMESTAMPTZ)`,
+		`CREATE INDEX IF NOT EXISTS user_login_sessions_index ON login_sessions USING btree(login, created)`,
+	)
+}
+
+func scanAttempts(row pgx.Row) (Attempts, error) {
+	var attempts Attempts
+	var lastFailure, lockedUntil *time.Time
+	err := row.Scan(&attempts.Failures, &lastFailure, &lockedUntil)
+	if lastFailure != nil {
+		attempts.LastFailure = *lastFailure
+	}
+	if lockedUntil != nil {
+		attempts.LockedUntil = *lockedUntil
+	}
+	return attempts, err
+}
+
+func (s *DatabaseLockoutStorage) GetAttempts(ctx context.Context, login string) (Attempts, error) {
+	attempts, err := scanAttempts(pgdb.Conn(ctx, s.Pool).QueryRow(ctx,
+		"SELECT failures, last_failure, locked_until FROM login_attempts WHERE login=$1", login))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Attempts{}, nil
+	}
+	return attempts, err
+}
+
+func (s *DatabaseLockoutStorage) LockAttempts(ctx context.Context, login string) (Attempts, error) {
+	return scanAttempts(pgdb.Conn(ctx, s.Pool).QueryRow(ctx,
+		`INSERT INTO login_attempts (login) VALUES ($1)
+		ON CONFLICT (login) DO UPDATE SET login = EXCLUDED.login
+		RETURNING failures, last_failure, locked_until`, login))
+}
+
+func (s *DatabaseLockoutStorage) AddFailure(ctx context.Context, login string, at time.Time, since time.Time) (Attempts, error) {
+	return scanAttempts(pgdb.Conn(ctx, s.Pool).QueryRow(ctx,
+		`INSERT INTO login_attempts (login, failures, last_failure) VALUES ($1, 1, $2)
+		ON CONFLICT (login) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure = EXCLUDED.last_failure
+		RETURNING failures, last_failure, locked_until`,
+		login, at, since))
+}
+
+func (s *DatabaseLockoutStorage) RemoveFailure(ctx context.Context, login string) error {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx,
+		"UPDATE login_attempts SET failures = GREATEST(failures - 1, 0) WHERE login=$1", login)
+	return err
+}
+
+func (s *DatabaseLockoutStorage) SetLockedUntil(ctx context.Context, login string, until time.Time) error {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx,
+		`INSERT INTO login_attempts (login, failures, locked_until) VALUES ($1, 0, $2)
+		ON CONFLICT (login) DO UPDATE SET failures=0, locked_until=EXCLUDED.locked_until`, login, until)
+	return err
+}
+
+func (s *DatabaseLockoutStorage) ResetAttempts(ctx context.Context, login string) error {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, "DELETE FROM login_attempts WHERE login=$1", login)
+	return err
+}
+
+func (s *DatabaseLockoutStorage) AddSession(ctx context.Context, session Session) error {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx,
+		"INSERT INTO login_sessions (login, ip, user_agent, new_address, created) VALUES ($1, $2, $3, $4, $5)",
+		session.Login, session.IP, session.UserAgent, session.NewAddress, session.Created)
+	return err
+}
+
+func (s *DatabaseLockoutStorage) GetSessions(ctx context.Context, login string, limit int) ([]Session, error) {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx,
+		`SELECT login, ip, user_agent, new_address, created FROM login_sessions
+		WHERE login=$1 ORDER BY created DESC, id DESC LIMIT $2`, login, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Session, error) {
+		var session Session
+		err := row.Scan(&session.Login, &session.IP, &session.UserAgent, &session.NewAddress, &session.Created)
+		return session, err
+	})
+}
+
+func NewDatabaseLockoutStorage(pool *pgxpool.Pool) *DatabaseLockoutStorage {
+	ret := &DatabaseLockoutStorage{Pool: pool}
+	ret.Init()
+	return ret
+}
@@ -0,0 +1,152 @@
+package lotstorage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/pgdb"
+)
+
+// AccrualLot is a part of balance credited by a single order, withdrawals consume lots oldest first.
+type AccrualLot struct {
+	ID        int64
+	Login     string
+	Program   string
+	Number    string
+	Amount    currencybalance.CurrencyBalance
+	Remaining currencybalance.CurrencyBalance
+	Accrued   time.Time
+}
+
+type Expiration struct {
+	Login   string                          `json:"-"`
+	Program string                          `json:"program"`
+	Amount  currencybalance.CurrencyBalance `json:"amount"`
+	Expired time.Time                       `json:"expired_at"`
+}
+
+//go:generate mockery --name LotStorage
+type LotStorage interface {
+	// AddLot records points credited to user balance by order.
+	AddLot(ctx context.Context, login string, program string, number string, amount currencybalance.CurrencyBalance) error
+
+	// ConsumeLots takes amount debited from user balance from lots oldest first.
+	ConsumeLots(ctx context.Context, login string, program string, amount currencybalance.CurrencyBalance) error
+
+	// ExpireLots expires remaining points of lots accrued before cutoff returning expired total per user,
+	// balances are left to the caller.
+	ExpireLots(ctx context.Context, program string, accruedBefore time.Time, now time.Time) ([]Expiration, error)
+
+	GetActiveLots(ctx context.Context, login string, program string, accruedBefore time.Time) ([]AccrualLot, error)
+}
+
+type DatabaseLotStorage struct {
+	Pool *pgxpool.Pool
+}
+
+func (s *DatabaseLotStorage) Init() error {
+	return pgdb.ExecBatch(context.Background(), s.Pool,
+		`CREATE TABLE IF NOT EXISTS accrual_lots("id" BIGSERIAL PRIMARY KEY, "login" TEXT, "program" TEXT, "number" TEXT, "amount" BIGINT, "remaining" BIGINT, "accrued" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP)`,
+		`CREATE INDEX IF NOT EXISTS accrual_lots_user_index ON accrual_lots USING btree(login, program, accrued) WHERE remaining > 0`,
+		`CREATE INDEX IF NOT EXISTS accrual_lots_expiry_index ON accrual_lots USING btree(program, accrued) WHERE remaining > 0`,
+		`CREATE TABLE IF NOT EXISTS expirations("lot_id" BIGINT, "login" TEXT, "program" TEXT, "amount" BIGINT, "expired" TIMESTAMPTZ)`,
+		`CREATE INDEX IF NOT EXISTS user_expirations_index ON expirations USING btree(login)`,
+	)
+}
+
+func (s *DatabaseLotStorage) AddLot(ctx context.Context, login string, program string, number string, amount currencybalance.CurrencyBalance) error {
+	if amount.Balance <= 0 {
+		return nil
+	}
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx,
+		`INSERT INTO accrual_lots (login, program, number, amount, remaining) VALUES ($1, $2, $3, $4, $4)`,
+		login, program, number, amount.Balance)
+	return err
+}
+
+func (s *DatabaseLotStorage) ConsumeLots(ctx context.Context, login string, program string, amount currencybalance.CurrencyBalance) error {
+	const consumeQuery = `
+		WITH ordered AS (
+			SELECT id, remaining, SUM(remaining) OVER (ORDER BY accrued, id) AS running
+			FROM accrual_lots
+			WHERE login=$1 AND program=$2 AND remaining > 0
+		)
+		UPDATE accrual_lots l
+			SET remaining=GREATEST(o.running-$3, 0)
+			FROM ordered o
+			WHERE l.id=o.id AND o.running-o.remaining < $3
+	`
+	batch := &pgx.Batch{}
+	batch.Queue("SELECT id FROM accrual_lots WHERE login=$1 AND program=$2 AND remaining > 0 FOR UPDATE",
+		login, program)
+	batch.Queue(consumeQuery, login, program, amount.Balance)
+	return pgdb.Conn(ctx, s.Pool).SendBatch(ctx, batch).Close()
+}
+
+func (s *DatabaseLotStorage) ExpireLots(ctx context.Context, program string, accruedBefore time.Time, now time.Time) ([]Expiration, error) {
+	const expireQuery = `
+		WITH due AS (
+			SELECT id, login, program, remaining FROM accrual_lots
+			WHERE program=$1 AND accrued < $2 AND remaining > 0
+			FOR UPDATE
+		), expired_lots AS (
+			UPDATE accrual_lots l SET remaining=0 FROM due WHERE l.id=due.id
+		), entries AS (
+			INSERT INTO expirations (lot_id, login, program, amount, expired)
+			SELECT id, login, program, remaining, $3 FROM due
+		)
+		SELECT login, program, SUM(remaining)::BIGINT FROM due GROUP BY login, program
+	`
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx, expireQuery, program, accruedBefore, now)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Expiration, error) {
+		expiration := Expiration{Expired: now}
+		err := row.Scan(&expiration.Login, &expiration.Program, &expiration.Amount.Balance)
+		return expiration, err
+	})
+}
+
+func (s *DatabaseLotStorage) GetActiveLots(ctx context.Context, login string, program string, accruedBefore time.Time) ([]AccrualLot, error) {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx,
+		`SELECT id, login, program, number, amount, remaining, accrued FROM accrual_lots
+		WHERE login=$1 AND program=$2 AND accrued < $3 AND remaining > 0 ORDER BY accrued, id`,
+		login, program, accruedBefore)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (AccrualLot, error) {
+		var lot AccrualLot
+		err := row.Scan(&lot.ID, &lot.Login, &lot.Program, &lot.Number, &lot.Amount.Balance, &lot.Remaining.Balance, &lot.Accrued)
+		return lot, err
+	})
+}
+
+// AddMissingLots records lots for parts of balances not covered by lots, such as balances credited
+// before lots were kept. They are dated before the user's first order and every lot of the balance,
+// so they are consumed and expired first.
+func (s *DatabaseLotStorage) AddMissingLots(ctx context.Context) error {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, `
+		INSERT INTO accrual_lots (login, program, number, amount, remaining, accrued)
+		SELECT b.login, b.program, '', b.balance-COALESCE(SUM(l.remaining), 0), b.balance-COALESCE(SUM(l.remaining), 0),
+			LEAST(
+				(SELECT MIN(uploaded) FROM orders WHERE login=b.login),
+				(SELECT MIN(accrued) FROM accrual_lots WHERE login=b.login AND program=b.program),
+				CURRENT_TIMESTAMP
+			) - INTERVAL '1 microsecond'
+		FROM balances b LEFT JOIN accrual_lots l ON l.login=b.login AND l.program=b.program AND l.remaining > 0
+		GROUP BY b.login, b.program, b.balance
+		HAVING b.balance > COALESCE(SUM(l.remaining), 0)
+	`)
+	return err
+}
+
+func NewDatabaseLotStorage(pool *pgxpool.Pool) *DatabaseLotStorage {
+	ret := &DatabaseLotStorage{Pool: pool}
+	ret.Init()
+	return ret
+}
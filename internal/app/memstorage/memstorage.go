@@ -0,0 +1,1015 @@
+package memstorage
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/lockout"
+	"github.com/valinurovdenis/gomart/internal/app/lotstorage"
+	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"github.com/valinurovdenis/gomart/internal/app/passwordreset"
+	"github.com/valinurovdenis/gomart/internal/app/rbac"
+	"github.com/valinurovdenis/gomart/internal/app/statement"
+	"github.com/valinurovdenis/gomart/internal/app/twofactor"
+	"github.com/valinurovdenis/gomart/internal/app/userstorage"
+	"github.com/valinurovdenis/gomart/internal/app/webhooks"
+	"github.com/valinurovdenis/gomart/internal/app/withdrawstorage"
+)
+
+type balanceKey struct {
+	login   string
+	program string
+}
+
+type state struct {
+	users       map[string]string
+	versions    map[string]int
+	versionID   int
+	roles       map[string]rbac.Role
+	balances    map[balanceKey]userstorage.UserBalance
+	orders      map[string]orderstorage.UserOrder
+	accrued     map[string]time.Time // time orders were first credited
+	userOrders  map[string][]string
+	adjustments []orderstorage.Adjustment
+	withdrawals []withdrawstorage.UserWithdraw
+	withdrawID  int64
+	lots        []lotstorage.AccrualLot
+	lotID       int64
+	expirations []lotstorage.Expiration
+	events      []outboxEvent
+	eventID     int64
+	webhooks    map[int64]webhooks.Subscription
+	webhookID   int64
+	deliveries  []webhooks.Delivery
+	attempts    map[string]lockout.Attempts
+	sessions    []lockout.Session
+	twoFactor   map[string]twofactor.TwoFactor
+	resets      map[string]passwordreset.ResetToken
+	deleted     map[string]time.Time
+	services    map[string]rbac.ServiceAccount
+}
+
+type outboxEvent struct {
+	outbox.Event
+	published    bool
+	claimedUntil time.Time
+}
+
+func (s state) clone() state {
+	userOrders := make(map[string][]string, len(s.userOrders))
+	for login, numbers := range s.userOrders {
+		userOrders[login] = slices.Clone(numbers)
+	}
+	return state{
+		users:       maps.Clone(s.users),
+		versions:    maps.Clone(s.versions),
+		versionID:   s.versionID,
+		roles:       maps.Clone(s.roles),
+		balances:    maps.Clone(s.balances),
+		orders:      maps.Clone(s.orders),
+		accrued:     maps.Clone(s.accrued),
+		userOrders:  userOrders,
+		adjustments: slices.Clone(s.adjustments),
+		withdrawals: slices.Clone(s.withdrawals),
+		withdrawID:  s.withdrawID,
+		lots:        slices.Clone(s.lots),
+		lotID:       s.lotID,
+		expirations: slices.Clone(s.expirations),
+		events:      slices.Clone(s.events),
+		eventID:     s.eventID,
+		webhooks:    maps.Clone(s.webhooks),
+		webhookID:   s.webhookID,
+		deliveries:  slices.Clone(s.deliveries),
+		attempts:    maps.Clone(s.attempts),
+		sessions:    slices.Clone(s.sessions),
+		twoFactor:   maps.Clone(s.twoFactor),
+		resets:      maps.Clone(s.resets),
+		deleted:     maps.Clone(s.deleted),
+		services:    maps.Clone(s.services),
+	}
+}
+
+// MemoryStorage implements every storage interface and TxManager over in-memory state.
+// Units of work run one at a time and restore a snapshot of the whole state on failure,
+// which is fine for development and tests but not for large data sets.
+type MemoryStorage struct {
+	state
+	mu    sync.RWMutex
+	txMu  sync.Mutex
+	clock clock.Clock
+	// OnEvent is called with user login after event is committed.
+	OnEvent func(login string)
+	// notifications of running unit of work, guarded by txMu
+	pending []string
+}
+
+type txKey struct{}
+
+func (s *MemoryStorage) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(txKey{}) != nil {
+		return fn(ctx)
+	}
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+	s.mu.RLock()
+	snapshot := s.state.clone()
+	s.mu.RUnlock()
+	s.pending = s.pending[:0]
+	if err := fn(context.WithValue(ctx, txKey{}, true)); err != nil {
+		s.mu.Lock()
+		s.state = snapshot
+		s.mu.Unlock()
+		return err
+	}
+	s.notify(s.pending...)
+	return nil
+}
+
+func (s *MemoryStorage) notify(logins ...string) {
+	if s.OnEvent == nil {
+		return
+	}
+	for _, login := range logins {
+		s.OnEvent(login)
+	}
+}
+
+// lock locks state for writing, writes outside of unit of work wait for running one to finish
+// so that its rollback does not discard them.
+func (s *MemoryStorage) lock(ctx context.Context) func() {
+	if ctx.Value(txKey{}) != nil {
+		s.mu.Lock()
+		return s.mu.Unlock
+	}
+	s.txMu.Lock()
+	s.mu.Lock()
+	return func() {
+		s.mu.Unlock()
+		s.txMu.Unlock()
+	}
+}
+
+func (s *MemoryStorage) AddUser(ctx context.Context, user userstorage.LoginPassword) error {
+	defer s.lock(ctx)()
+	if _, ok := s.users[user.Login]; ok {
+		return userstorage.ErrLoginExists
+	}
+	s.users[user.Login] = user.Password
+	s.versionID++
+	s.versions[user.Login] = s.versionID
+	return nil
+}
+
+func (s *MemoryStorage) GetUserPassword(ctx context.Context, login string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	password, ok := s.users[login]
+	if !ok {
+		return "", userstorage.ErrUserNotFound
+	}
+	return password, nil
+}
+
+func (s *MemoryStorage) SetPassword(ctx context.Context, login string, password string) error {
+	defer s.lock(ctx)()
+	if _, ok := s.users[login]; !ok {
+		return userstorage.ErrUserNotFound
+	}
+	s.users[login] = password
+	s.versionID++
+	s.versions[login] = s.versionID
+	return nil
+}
+
+func (s *MemoryStorage) GetTokenVersion(ctx context.Context, login string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.users[login]; !ok {
+		return 0, userstorage.ErrUserNotFound
+	}
+	return s.versions[login], nil
+}
+
+func (s *MemoryStorage) GetRole(ctx context.Context, login string) (rbac.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.users[login]; !ok {
+		return "", userstorage.ErrUserNotFound
+	}
+	if role, ok := s.roles[login]; ok {
+		return role, nil
+	}
+	return rbac.User, nil
+}
+
+func (s *MemoryStorage) SetRole(ctx context.Context, login string, role rbac.Role) error {
+	defer s.lock(ctx)()
+	if _, ok := s.users[login]; !ok {
+		return userstorage.ErrUserNotFound
+	}
+	s.roles[login] = role
+	s.versionID++
+	s.versions[login] = s.versionID
+	return nil
+}
+
+func (s *MemoryStorage) GetBalance(ctx context.Context, login string, program string) (userstorage.UserBalance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	balance, ok := s.balances[balanceKey{login, program}]
+	if !ok {
+		return userstorage.UserBalance{Program: program}, nil
+	}
+	return balance, nil
+}
+
+// LockBalance needs no lock as units of work run one at a time.
+func (s *MemoryStorage) LockBalance(ctx context.Context, login string, program string) (userstorage.UserBalance, error) {
+	return s.GetBalance(ctx, login, program)
+}
+
+func (s *MemoryStorage) GetBalances(ctx context.Context, login string) ([]userstorage.UserBalance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res []userstorage.UserBalance
+	for key, balance := range s.balances {
+		if key.login == login {
+			res = append(res, balance)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Program < res[j].Program })
+	return res, nil
+}
+
+func (s *MemoryStorage) AddBalance(ctx context.Context, login string, program string, addBalance currencybalance.CurrencyBalance) error {
+	defer s.lock(ctx)()
+	return s.changeBalance(login, program, addBalance, currencybalance.CurrencyBalance{})
+}
+
+func (s *MemoryStorage) SetBalance(ctx context.Context, login string, newBalance userstorage.UserBalance) error {
+	defer s.lock(ctx)()
+	s.balances[balanceKey{login, newBalance.Program}] = newBalance
+	return nil
+}
+
+func (s *MemoryStorage) AddWithdrawn(ctx context.Context, login string, program string, amount currencybalance.CurrencyBalance) error {
+	defer s.lock(ctx)()
+	return s.changeBalance(login, program, currencybalance.CurrencyBalance{Balance: -amount.Balance}, amount)
+}
+
+func (s *MemoryStorage) changeBalance(login string, program string, current currencybalance.CurrencyBalance, withdrawn currencybalance.CurrencyBalance) error {
+	key := balanceKey{login, program}
+	balance, ok := s.balances[key]
+	if !ok {
+		balance = userstorage.UserBalance{Program: program}
+	}
+	if err := balance.Current.Add(current); err != nil {
+		return err
+	}
+	if err := balance.Withdrawn.Add(withdrawn); err != nil {
+		return err
+	}
+	s.balances[key] = balance
+	return nil
+}
+
+func (s *MemoryStorage) AddUserOrder(ctx context.Context, order orderstorage.UserOrder) error {
+	defer s.lock(ctx)()
+	return s.addUserOrder(order)
+}
+
+func (s *MemoryStorage) AddUserOrders(ctx context.Context, orders []orderstorage.UserOrder) ([]error, error) {
+	defer s.lock(ctx)()
+	results := make([]error, len(orders))
+	for i, order := range orders {
+		results[i] = s.addUserOrder(order)
+	}
+	return results, nil
+}
+
+func (s *MemoryStorage) addUserOrder(order orderstorage.UserOrder) error {
+	if existing, ok := s.orders[order.Number]; ok {
+		if existing.Login == order.Login {
+			return orderstorage.ErrAlreadySent
+		}
+		return orderstorage.ErrOrderExists
+	}
+	order.Uploaded = s.clock.Now()
+	s.orders[order.Number] = order
+	s.setAccrued(order)
+	s.userOrders[order.Login] = append(s.userOrders[order.Login], order.Number)
+	return nil
+}
+
+func (s *MemoryStorage) GetOrder(ctx context.Context, number string) (orderstorage.UserOrder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	order, ok := s.orders[number]
+	if !ok {
+		return orderstorage.UserOrder{}, orderstorage.ErrOrderNotFound
+	}
+	return order, nil
+}
+
+func (s *MemoryStorage) GetUserOrders(ctx context.Context, login string) ([]orderstorage.UserOrder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	numbers := s.userOrders[login]
+	res := make([]orderstorage.UserOrder, 0, len(numbers))
+	for i := len(numbers) - 1; i >= 0; i-- {
+		res = append(res, s.orders[numbers[i]])
+	}
+	return res, nil
+}
+
+// GetOrderForUpdate needs no locking as units of work run one at a time.
+func (s *MemoryStorage) GetOrderForUpdate(ctx context.Context, number string) (orderstorage.UserOrder, error) {
+	return s.GetOrder(ctx, number)
+}
+
+func (s *MemoryStorage) UpdateOrder(ctx context.Context, order orderstorage.UserOrder) error {
+	defer s.lock(ctx)()
+	previous, ok := s.orders[order.Number]
+	if !ok {
+		return orderstorage.ErrOrderNotFound
+	}
+	previous.Status = order.Status
+	previous.Balance = order.Balance
+	previous.Program = order.Program
+	s.orders[order.Number] = previous
+	s.setAccrued(previous)
+	return nil
+}
+
+func (s *MemoryStorage) setAccrued(order orderstorage.UserOrder) {
+	if _, ok := s.accrued[order.Number]; !ok && order.Status == orderstorage.Processed {
+		s.accrued[order.Number] = s.clock.Now()
+	}
+}
+
+func (s *MemoryStorage) AddAdjustment(ctx context.Context, adjustment orderstorage.Adjustment) error {
+	defer s.lock(ctx)()
+	adjustment.Created = s.clock.Now()
+	s.adjustments = append(s.adjustments, adjustment)
+	return nil
+}
+
+func (s *MemoryStorage) GetUserAdjustments(ctx context.Context, login string) ([]orderstorage.Adjustment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res []orderstorage.Adjustment
+	for i := len(s.adjustments) - 1; i >= 0; i-- {
+		if s.adjustments[i].Login == login {
+			res = append(res, s.adjustments[i])
+		}
+	}
+	return res, nil
+}
+
+func (s *MemoryStorage) AddUserWithdraw(ctx context.Context, order withdrawstorage.UserWithdraw) error {
+	defer s.lock(ctx)()
+	s.withdrawID++
+	order.ID = s.withdrawID
+	order.Processed = s.clock.Now()
+	order.Status = withdrawstorage.Done
+	s.withdrawals = append(s.withdrawals, order)
+	return nil
+}
+
+func (s *MemoryStorage) GetUserWithdrawals(ctx context.Context, login string) ([]withdrawstorage.UserWithdraw, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res []withdrawstorage.UserWithdraw
+	for i := len(s.withdrawals) - 1; i >= 0; i-- {
+		if s.withdrawals[i].Login == login {
+			res = append(res, s.withdrawals[i])
+		}
+	}
+	return res, nil
+}
+
+func (s *MemoryStorage) ReverseUserWithdraw(ctx context.Context, id int64, reason string) (withdrawstorage.UserWithdraw, error) {
+	defer s.lock(ctx)()
+	i := slices.IndexFunc(s.withdrawals, func(withdraw withdrawstorage.UserWithdraw) bool { return withdraw.ID == id })
+	if i < 0 {
+		return withdrawstorage.UserWithdraw{}, withdrawstorage.ErrWithdrawNotFound
+	}
+	withdraw := s.withdrawals[i]
+	if withdraw.Reversed != nil {
+		return withdrawstorage.UserWithdraw{}, withdrawstorage.ErrAlreadyReversed
+	}
+	reversed := s.clock.Now()
+	withdraw.Reversed = &reversed
+	withdraw.ReverseReason = reason
+	withdraw.Status = withdrawstorage.Reversed
+	s.withdrawals[i] = withdraw
+	return withdraw, nil
+}
+
+func (s *MemoryStorage) AddLot(ctx context.Context, login string, program string, number string, amount currencybalance.CurrencyBalance) error {
+	if amount.Balance <= 0 {
+		return nil
+	}
+	defer s.lock(ctx)()
+	s.lotID++
+	s.lots = append(s.lots, lotstorage.AccrualLot{
+		ID:        s.lotID,
+		Login:     login,
+		Program:   program,
+		Number:    number,
+		Amount:    amount,
+		Remaining: amount,
+		Accrued:   s.clock.Now(),
+	})
+	return nil
+}
+
+// ConsumeLots takes amount from user lots oldest first, lots are kept in accrual order.
+func (s *MemoryStorage) ConsumeLots(ctx context.Context, login string, program string, amount currencybalance.CurrencyBalance) error {
+	defer s.lock(ctx)()
+	left := amount.Balance
+	for i := range s.lots {
+		lot := &s.lots[i]
+		if left <= 0 {
+			break
+		}
+		if lot.Login != login || lot.Program != program || lot.Remaining.Balance <= 0 {
+			continue
+		}
+		taken := min(left, lot.Remaining.Balance)
+		lot.Remaining.Balance -= taken
+		left -= taken
+	}
+	return nil
+}
+
+func (s *MemoryStorage) ExpireLots(ctx context.Context, program string, accruedBefore time.Time, now time.Time) ([]lotstorage.Expiration, error) {
+	defer s.lock(ctx)()
+	totals := make(map[string]currencybalance.CurrencyBalance)
+	var logins []string
+	for i := range s.lots {
+		lot := &s.lots[i]
+		if lot.Program != program || !lot.Accrued.Before(accruedBefore) || lot.Remaining.Balance <= 0 {
+			continue
+		}
+		if _, ok := totals[lot.Login]; !ok {
+			logins = append(logins, lot.Login)
+		}
+		total := totals[lot.Login]
+		total.Add(lot.Remaining)
+		totals[lot.Login] = total
+		lot.Remaining = currencybalance.CurrencyBalance{}
+	}
+
+	var res []lotstorage.Expiration
+	for _, login := range logins {
+		expiration := lotstorage.Expiration{Login: login, Program: program, Amount: totals[login], Expired: now}
+		s.expirations = append(s.expirations, expiration)
+		res = append(res, expiration)
+	}
+	return res, nil
+}
+
+func (s *MemoryStorage) GetActiveLots(ctx context.Context, login string, program string, accruedBefore time.Time) ([]lotstorage.AccrualLot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res []lotstorage.AccrualLot
+	for _, lot := range s.lots {
+		if lot.Login == login && lot.Program == program && lot.Accrued.Before(accruedBefore) && lot.Remaining.Balance > 0 {
+			res = append(res, lot)
+		}
+	}
+	return res, nil
+}
+
+func (s *MemoryStorage) AddEvent(ctx context.Context, event outbox.Event) error {
+	unlock := s.lock(ctx)
+	s.eventID++
+	event.ID = s.eventID
+	event.Created = s.clock.Now()
+	s.events = append(s.events, outboxEvent{Event: event})
+	if ctx.Value(txKey{}) != nil {
+		s.pending = append(s.pending, event.Login)
+		unlock()
+		return nil
+	}
+	unlock()
+	s.notify(event.Login)
+	return nil
+}
+
+func (s *MemoryStorage) GetUserEvents(ctx context.Context, login string, afterID int64, limit int) ([]outbox.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res []outbox.Event
+	for _, event := range s.events {
+		if len(res) == limit {
+			break
+		}
+		if event.Login == login && event.ID > afterID {
+			res = append(res, event.Event)
+		}
+	}
+	return res, nil
+}
+
+func (s *MemoryStorage) GetLastUserEventID(ctx context.Context, login string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if s.events[i].Login == login {
+			return s.events[i].ID, nil
+		}
+	}
+	return 0, nil
+}
+
+func (s *MemoryStorage) ClaimPendingEvents(ctx context.Context, limit int, lease time.Duration) ([]outbox.Event, error) {
+	defer s.lock(ctx)()
+	now := s.clock.Now()
+	claimed := make(map[string]bool)
+	var res []outbox.Event
+	for i := range s.events {
+		event := &s.events[i]
+		if len(res) == limit {
+			break
+		}
+		if event.published || claimed[event.Login] {
+			continue
+		}
+		if event.claimedUntil.After(now) {
+			claimed[event.Login] = true
+			continue
+		}
+		event.claimedUntil = now.Add(lease)
+		res = append(res, event.Event)
+	}
+	return res, nil
+}
+
+func (s *MemoryStorage) MarkPublished(ctx context.Context, ids []int64) error {
+	defer s.lock(ctx)()
+	for i := range s.events {
+		if slices.Contains(ids, s.events[i].ID) {
+			s.events[i].published = true
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStorage) ReleaseEvents(ctx context.Context, ids []int64) error {
+	defer s.lock(ctx)()
+	for i := range s.events {
+		if slices.Contains(ids, s.events[i].ID) {
+			s.events[i].claimedUntil = time.Time{}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStorage) AddSubscription(ctx context.Context, subscription webhooks.Subscription) (webhooks.Subscription, error) {
+	defer s.lock(ctx)()
+	s.webhookID++
+	subscription.ID = s.webhookID
+	subscription.Active = true
+	subscription.Created = s.clock.Now()
+	s.webhooks[subscription.ID] = subscription
+	return subscription, nil
+}
+
+func (s *MemoryStorage) GetSubscription(ctx context.Context, id int64) (webhooks.Subscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	subscription, ok := s.webhooks[id]
+	if !ok {
+		return webhooks.Subscription{}, webhooks.ErrSubscriptionNotFound
+	}
+	return subscription, nil
+}
+
+func (s *MemoryStorage) filterSubscriptions(filter func(webhooks.Subscription) bool) []webhooks.Subscription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res []webhooks.Subscription
+	for _, subscription := range s.webhooks {
+		if filter(subscription) {
+			res = append(res, subscription)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+func (s *MemoryStorage) GetSubscriptions(ctx context.Context, login string) ([]webhooks.Subscription, error) {
+	return s.filterSubscriptions(func(subscription webhooks.Subscription) bool {
+		return subscription.Login == login
+	}), nil
+}
+
+func (s *MemoryStorage) GetActiveSubscriptions(ctx context.Context, login string, eventType outbox.EventType) ([]webhooks.Subscription, error) {
+	return s.filterSubscriptions(func(subscription webhooks.Subscription) bool {
+		return subscription.Login == login && subscription.Active && subscription.Accepts(eventType)
+	}), nil
+}
+
+func (s *MemoryStorage) DeleteSubscription(ctx context.Context, login string, id int64) error {
+	defer s.lock(ctx)()
+	subscription, ok := s.webhooks[id]
+	if !ok || subscription.Login != login {
+		return webhooks.ErrSubscriptionNotFound
+	}
+	delete(s.webhooks, id)
+	return nil
+}
+
+func (s *MemoryStorage) SetActive(ctx context.Context, id int64, active bool) error {
+	defer s.lock(ctx)()
+	subscription, ok := s.webhooks[id]
+	if !ok {
+		return webhooks.ErrSubscriptionNotFound
+	}
+	subscription.Active = active
+	subscription.Failures = 0
+	s.webhooks[id] = subscription
+	return nil
+}
+
+func (s *MemoryStorage) RecordDelivery(ctx context.Context, delivery webhooks.Delivery) (int, error) {
+	defer s.lock(ctx)()
+	subscription, ok := s.webhooks[delivery.SubscriptionID]
+	if !ok {
+		return 0, webhooks.ErrSubscriptionNotFound
+	}
+	if delivery.Succeeded() {
+		subscription.Failures = 0
+	} else {
+		subscription.Failures++
+	}
+	s.webhooks[subscription.ID] = subscription
+	delivery.Delivered = s.clock.Now()
+	s.deliveries = append(s.deliveries, delivery)
+	return subscription.Failures, nil
+}
+
+func (s *MemoryStorage) GetDeliveries(ctx context.Context, subscriptionID int64, limit int) ([]webhooks.Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res []webhooks.Delivery
+	for i := len(s.deliveries) - 1; i >= 0 && len(res) < limit; i-- {
+		if s.deliveries[i].SubscriptionID == subscriptionID {
+			res = append(res, s.deliveries[i])
+		}
+	}
+	return res, nil
+}
+
+func (s *MemoryStorage) GetAttempts(ctx context.Context, login string) (lockout.Attempts, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.attempts[login], nil
+}
+
+// LockAttempts needs no lock as units of work run one at a time.
+func (s *MemoryStorage) LockAttempts(ctx context.Context, login string) (lockout.Attempts, error) {
+	return s.GetAttempts(ctx, login)
+}
+
+func (s *MemoryStorage) AddFailure(ctx context.Context, login string, at time.Time, since time.Time) (lockout.Attempts, error) {
+	defer s.lock(ctx)()
+	attempts := s.attempts[login]
+	if attempts.LastFailure.Before(since) {
+		attempts.Failures = 0
+	}
+	attempts.Failures++
+	attempts.LastFailure = at
+	s.attempts[login] = attempts
+	return attempts, nil
+}
+
+func (s *MemoryStorage) RemoveFailure(ctx context.Context, login string) error {
+	defer s.lock(ctx)()
+	if attempts, ok := s.attempts[login]; ok && attempts.Failures > 0 {
+		attempts.Failures--
+		s.attempts[login] = attempts
+	}
+	return nil
+}
+
+func (s *MemoryStorage) SetLockedUntil(ctx context.Context, login string, until time.Time) error {
+	defer s.lock(ctx)()
+	attempts := s.attempts[login]
+	attempts.Failures = 0
+	attempts.LockedUntil = until
+	s.attempts[login] = attempts
+	return nil
+}
+
+func (s *MemoryStorage) ResetAttempts(ctx context.Context, login string) error {
+	defer s.lock(ctx)()
+	delete(s.attempts, login)
+	return nil
+}
+
+func (s *MemoryStorage) AddSession(ctx context.Context, session lockout.Session) error {
+	defer s.lock(ctx)()
+	s.sessions = append(s.sessions, session)
+	return nil
+}
+
+func (s *MemoryStorage) GetSessions(ctx context.Context, login string, limit int) ([]lockout.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res []lockout.Session
+	for i := len(s.sessions) - 1; i >= 0 && len(res) < limit; i-- {
+		if s.sessions[i].Login == login {
+			res = append(res, s.sessions[i])
+		}
+	}
+	return res, nil
+}
+
+func (s *MemoryStorage) GetTwoFactor(ctx context.Context, login string) (twofactor.TwoFactor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	twoFactor, ok := s.twoFactor[login]
+	if !ok {
+		return twofactor.TwoFactor{}, twofactor.ErrNotEnrolled
+	}
+	return twoFactor, nil
+}
+
+func (s *MemoryStorage) SetTwoFactor(ctx context.Context, twoFactor twofactor.TwoFactor) error {
+	defer s.lock(ctx)()
+	s.twoFactor[twoFactor.Login] = twoFactor
+	return nil
+}
+
+func (s *MemoryStorage) DeleteTwoFactor(ctx context.Context, login string) error {
+	defer s.lock(ctx)()
+	delete(s.twoFactor, login)
+	return nil
+}
+
+func (s *MemoryStorage) UseStep(ctx context.Context, login string, step int64) (bool, error) {
+	defer s.lock(ctx)()
+	twoFactor, ok := s.twoFactor[login]
+	if !ok || twoFactor.LastStep >= step {
+		return false, nil
+	}
+	twoFactor.LastStep = step
+	s.twoFactor[login] = twoFactor
+	return true, nil
+}
+
+func (s *MemoryStorage) UseRecoveryCode(ctx context.Context, login string, hash string) (bool, error) {
+	defer s.lock(ctx)()
+	twoFactor, ok := s.twoFactor[login]
+	if !ok || !slices.Contains(twoFactor.RecoveryCodes, hash) {
+		return false, nil
+	}
+	// snapshots share the slice, replace it instead of deleting in place
+	twoFactor.RecoveryCodes = slices.DeleteFunc(slices.Clone(twoFactor.RecoveryCodes), func(code string) bool { return code == hash })
+	s.twoFactor[login] = twoFactor
+	return true, nil
+}
+
+func (s *MemoryStorage) AddResetToken(ctx context.Context, token passwordreset.ResetToken) error {
+	defer s.lock(ctx)()
+	s.resets[token.Login] = token
+	return nil
+}
+
+func (s *MemoryStorage) UseResetToken(ctx context.Context, hash string, now time.Time) (string, error) {
+	defer s.lock(ctx)()
+	for login, token := range s.resets {
+		if token.Hash != hash {
+			continue
+		}
+		delete(s.resets, login)
+		if !now.Before(token.ExpiresAt) {
+			break
+		}
+		return login, nil
+	}
+	return "", passwordreset.ErrInvalidToken
+}
+
+// moveRecords moves financial records of user to login, records are deleted if login is empty.
+func (s *MemoryStorage) moveRecords(from string, to string) {
+	for key, balance := range s.balances {
+		if key.login == from {
+			delete(s.balances, key)
+			if to != "" {
+				s.balances[balanceKey{login: to, program: key.program}] = balance
+			}
+		}
+	}
+	for _, number := range s.userOrders[from] {
+		if to == "" {
+			delete(s.orders, number)
+			delete(s.accrued, number)
+			continue
+		}
+		order := s.orders[number]
+		order.Login = to
+		s.orders[number] = order
+	}
+	if to != "" {
+		s.userOrders[to] = s.userOrders[from]
+	}
+	delete(s.userOrders, from)
+	s.adjustments = moveLogin(s.adjustments, from, to, func(adjustment *orderstorage.Adjustment) *string { return &adjustment.Login })
+	s.withdrawals = moveLogin(s.withdrawals, from, to, func(withdraw *withdrawstorage.UserWithdraw) *string { return &withdraw.Login })
+	s.lots = moveLogin(s.lots, from, to, func(lot *lotstorage.AccrualLot) *string { return &lot.Login })
+	s.expirations = moveLogin(s.expirations, from, to, func(expiration *lotstorage.Expiration) *string { return &expiration.Login })
+}
+
+// moveLogin changes login of records, records are deleted if login is empty.
+func moveLogin[T any](records []T, from string, to string, login func(*T) *string) []T {
+	res := records[:0]
+	for i := range records {
+		if field := login(&records[i]); *field == from {
+			if to == "" {
+				continue
+			}
+			*field = to
+		}
+		res = append(res, records[i])
+	}
+	return res
+}
+
+func (s *MemoryStorage) AnonymizeUser(ctx context.Context, login string, anonymous string, deleted time.Time) error {
+	defer s.lock(ctx)()
+	if _, ok := s.users[login]; !ok {
+		return userstorage.ErrUserNotFound
+	}
+	delete(s.users, login)
+	delete(s.versions, login)
+	delete(s.roles, login)
+	delete(s.attempts, login)
+	delete(s.twoFactor, login)
+	delete(s.resets, login)
+	s.sessions = slices.DeleteFunc(s.sessions, func(session lockout.Session) bool { return session.Login == login })
+	s.events = slices.DeleteFunc(s.events, func(event outboxEvent) bool { return event.Login == login })
+	for id, subscription := range s.webhooks {
+		if subscription.Login == login {
+			delete(s.webhooks, id)
+			s.deliveries = slices.DeleteFunc(s.deliveries, func(delivery webhooks.Delivery) bool { return delivery.SubscriptionID == id })
+		}
+	}
+	s.moveRecords(login, anonymous)
+	s.deleted[anonymous] = deleted
+	return nil
+}
+
+func (s *MemoryStorage) GetDeletedAccounts(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res []string
+	for anonymous, deleted := range s.deleted {
+		if deleted.Before(before) {
+			res = append(res, anonymous)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return s.deleted[res[i]].Before(s.deleted[res[j]]) })
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (s *MemoryStorage) PurgeAccount(ctx context.Context, anonymous string) error {
+	defer s.lock(ctx)()
+	s.moveRecords(anonymous, "")
+	delete(s.deleted, anonymous)
+	return nil
+}
+
+func (s *MemoryStorage) AddServiceAccount(ctx context.Context, account rbac.ServiceAccount) error {
+	defer s.lock(ctx)()
+	if _, ok := s.services[account.Name]; ok {
+		return rbac.ErrServiceAccountExists
+	}
+	s.services[account.Name] = account
+	return nil
+}
+
+func (s *MemoryStorage) GetServiceAccountByKey(ctx context.Context, keyHash string) (rbac.ServiceAccount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, account := range s.services {
+		if account.KeyHash == keyHash {
+			return account, nil
+		}
+	}
+	return rbac.ServiceAccount{}, rbac.ErrServiceAccountNotFound
+}
+
+func (s *MemoryStorage) GetServiceAccounts(ctx context.Context) ([]rbac.ServiceAccount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := slices.Collect(maps.Values(s.services))
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func (s *MemoryStorage) DeleteServiceAccount(ctx context.Context, name string) error {
+	defer s.lock(ctx)()
+	if _, ok := s.services[name]; !ok {
+		return rbac.ErrServiceAccountNotFound
+	}
+	delete(s.services, name)
+	return nil
+}
+
+// userEntries returns complete history of user for statements.
+func (s *MemoryStorage) userEntries(login string) []statement.Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var entries []statement.Entry
+	adjusted := make(map[string]int64)
+	for _, adjustment := range s.adjustments {
+		if adjustment.Login != login {
+			continue
+		}
+		adjusted[adjustment.Number] += adjustment.Amount.Balance
+		entries = append(entries, statement.Entry{Time: adjustment.Created, Type: statement.AdjustmentEntry, Number: adjustment.Number,
+			Program: adjustment.Program, Amount: adjustment.Amount, Details: adjustment.Reason})
+	}
+	for _, number := range s.userOrders[login] {
+		order := s.orders[number]
+		entry := statement.Entry{Time: order.Uploaded, Type: statement.OrderEntry, Number: number, Program: order.Program, Status: string(order.Status)}
+		if accrued, ok := s.accrued[number]; ok {
+			entry.Time = accrued
+		}
+		if order.Status == orderstorage.Processed {
+			entry.Amount = order.Balance
+		}
+		entry.Amount.Balance -= adjusted[number]
+		entries = append(entries, entry)
+	}
+	for _, withdraw := range s.withdrawals {
+		if withdraw.Login != login {
+			continue
+		}
+		entries = append(entries, statement.Entry{Time: withdraw.Processed, Type: statement.WithdrawalEntry, Number: withdraw.Number,
+			Program: withdraw.Program, Amount: currencybalance.CurrencyBalance{Balance: -withdraw.Withdraw.Balance}})
+		if withdraw.Reversed != nil {
+			entries = append(entries, statement.Entry{Time: *withdraw.Reversed, Type: statement.ReversalEntry, Number: withdraw.Number,
+				Program: withdraw.Program, Amount: withdraw.Withdraw, Details: withdraw.ReverseReason})
+		}
+	}
+	for _, expiration := range s.expirations {
+		if expiration.Login == login {
+			entries = append(entries, statement.Entry{Time: expiration.Expired, Type: statement.ExpirationEntry,
+				Program: expiration.Program, Amount: currencybalance.CurrencyBalance{Balance: -expiration.Amount.Balance}})
+		}
+	}
+	return entries
+}
+
+func (s *MemoryStorage) StreamStatement(ctx context.Context, login string, from time.Time, to time.Time, fn func(statement.Entry) error) error {
+	for _, entry := range statement.WithRunningBalance(s.userEntries(login), from, to) {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStorage) GetDailyBalances(ctx context.Context, login string, first time.Time, last time.Time) ([]statement.BalancePoint, error) {
+	return statement.DailyBalances(s.userEntries(login), first, last), nil
+}
+
+func (s *MemoryStorage) GetBalancesAt(ctx context.Context, login string, at time.Time) ([]userstorage.UserBalance, error) {
+	return statement.BalancesAt(s.userEntries(login), at), nil
+}
+
+func NewMemoryStorage(clock clock.Clock) *MemoryStorage {
+	return &MemoryStorage{
+		clock: clock,
+		state: state{
+			users:      make(map[string]string),
+			versions:   make(map[string]int),
+			roles:      make(map[string]rbac.Role),
+			balances:   make(map[balanceKey]userstorage.UserBalance),
+			orders:     make(map[string]orderstorage.UserOrder),
+			accrued:    make(map[string]time.Time),
+			userOrders: make(map[string][]string),
+			webhooks:   make(map[int64]webhooks.Subscription),
+			attempts:   make(map[string]lockout.Attempts),
+			twoFactor:  make(map[string]twofactor.TwoFactor),
+			resets:     make(map[string]passwordreset.ResetToken),
+			deleted:    make(map[string]time.Time),
+			services:   make(map[string]rbac.ServiceAccount),
+		},
+	}
+}
@@ -0,0 +1,276 @@
+package memstorage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"github.com/valinurovdenis/gomart/internal/app/service"
+	"github.com/valinurovdenis/gomart/internal/app/userstorage"
+	"github.com/valinurovdenis/gomart/internal/app/withdrawstorage"
+)
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage(&clock.FixedClock{Time: time.Now()})
+
+	require.NoError(t, s.AddUser(ctx, userstorage.LoginPassword{Login: "user", Password: "hash"}))
+	require.ErrorIs(t, s.AddUser(ctx, userstorage.LoginPassword{Login: "user", Password: "other"}), userstorage.ErrLoginExists)
+
+	password, err := s.GetUserPassword(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, "hash", password)
+	_, err = s.GetUserPassword(ctx, "unknown")
+	require.ErrorIs(t, err, userstorage.ErrUserNotFound)
+}
+
+func TestOrdersAndWithdrawals(t *testing.T) {
+	ctx := context.Background()
+	fixedClock := &clock.FixedClock{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	memStorage := NewMemoryStorage(fixedClock)
+	s := service.NewServiceStorage(memStorage, memStorage, memStorage, memStorage, memStorage, memStorage)
+
+	require.NoError(t, s.AddUserOrder(ctx, orderstorage.UserOrder{Login: "user", Number: "1", Program: "points", Status: orderstorage.New}))
+	fixedClock.Advance(time.Hour)
+	require.NoError(t, s.AddUserOrder(ctx, orderstorage.UserOrder{Login: "user", Number: "2", Program: "points", Status: orderstorage.New}))
+	require.ErrorIs(t, s.AddUserOrder(ctx, orderstorage.UserOrder{Login: "user", Number: "1"}), orderstorage.ErrAlreadySent)
+	require.ErrorIs(t, s.AddUserOrder(ctx, orderstorage.UserOrder{Login: "other", Number: "1"}), orderstorage.ErrOrderExists)
+
+	orders, err := s.GetUserOrders(ctx, "user")
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	require.Equal(t, "2", orders[0].Number)
+
+	processed := orderstorage.UserOrder{Login: "user", Number: "1", Program: "points", Status: orderstorage.Processed, Balance: currencybalance.CurrencyBalance{Balance: 1000}}
+	require.NoError(t, s.UpdateOrderAccrual(ctx, processed))
+	balance, err := s.GetBalance(ctx, "user", "points")
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), balance.Current.Balance)
+
+	processed.Balance.Balance = 400
+	require.NoError(t, s.UpdateOrderAccrual(ctx, processed))
+	adjustments, err := s.GetUserAdjustments(ctx, "user")
+	require.NoError(t, err)
+	require.Len(t, adjustments, 1)
+	require.Equal(t, int64(-600), adjustments[0].Amount.Balance)
+
+	withdraw := withdrawstorage.UserWithdraw{Login: "user", Number: "3", Program: "points", Withdraw: currencybalance.CurrencyBalance{Balance: 300}}
+	require.NoError(t, s.AddUserWithdraw(ctx, withdraw))
+	lots, err := s.GetActiveLots(ctx, "user", "points", fixedClock.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, lots, 1)
+	require.Equal(t, int64(100), lots[0].Remaining.Balance)
+
+	reversed, err := s.ReverseUserWithdraw(ctx, 1, "cancelled", "points")
+	require.NoError(t, err)
+	require.Equal(t, withdrawstorage.Reversed, reversed.Status)
+	_, err = s.ReverseUserWithdraw(ctx, 1, "cancelled", "points")
+	require.ErrorIs(t, err, withdrawstorage.ErrAlreadyReversed)
+	_, err = s.ReverseUserWithdraw(ctx, 2, "cancelled", "points")
+	require.ErrorIs(t, err, withdrawstorage.ErrWithdrawNotFound)
+
+	balance, err = s.GetBalance(ctx, "user", "points")
+	require.NoError(t, err)
+	require.Equal(t, int64(400), balance.Current.Balance)
+	require.Equal(t, int64(0), balance.Withdrawn.Balance)
+
+	events, err := memStorage.ClaimPendingEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	var types []outbox.EventType
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	require.Equal(t, []outbox.EventType{
+		outbox.OrderStatusChanged, outbox.OrderStatusChanged, outbox.OrderStatusChanged, outbox.OrderProcessed,
+		outbox.BalanceCredited, outbox.BalanceDebited, outbox.WithdrawalCreated, outbox.WithdrawalReversed,
+	}, types)
+}
+
+func TestEventNotifications(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage(&clock.FixedClock{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)})
+	var notified []string
+	s.OnEvent = func(login string) { notified = append(notified, login) }
+
+	failed := errors.New("failed")
+	err := s.Do(ctx, func(ctx context.Context) error {
+		require.NoError(t, s.AddEvent(ctx, outbox.Event{Type: outbox.OrderProcessed, Login: "user"}))
+		return failed
+	})
+	require.ErrorIs(t, err, failed)
+	require.Empty(t, notified)
+
+	require.NoError(t, s.Do(ctx, func(ctx context.Context) error {
+		return s.AddEvent(ctx, outbox.Event{Type: outbox.OrderProcessed, Login: "user"})
+	}))
+	require.NoError(t, s.AddEvent(ctx, outbox.Event{Type: outbox.BalanceCredited, Login: "other"}))
+	require.NoError(t, s.AddEvent(ctx, outbox.Event{Type: outbox.BalanceCredited, Login: "user"}))
+	require.Equal(t, []string{"user", "other", "user"}, notified)
+
+	last, err := s.GetLastUserEventID(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), last)
+	events, err := s.GetUserEvents(ctx, "user", 1, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, outbox.BalanceCredited, events[0].Type)
+}
+
+// Orders count in balance history from their crediting, not upload.
+func TestBalancesAtAccrual(t *testing.T) {
+	ctx := context.Background()
+	uploaded := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fixedClock := &clock.FixedClock{Time: uploaded}
+	memStorage := NewMemoryStorage(fixedClock)
+	s := service.NewServiceStorage(memStorage, memStorage, memStorage, memStorage, memStorage, memStorage)
+
+	require.NoError(t, s.AddUserOrder(ctx, orderstorage.UserOrder{Login: "user", Number: "1", Program: "points", Status: orderstorage.New}))
+	fixedClock.Advance(48 * time.Hour)
+	processed := orderstorage.UserOrder{Login: "user", Number: "1", Program: "points", Status: orderstorage.Processed, Balance: currencybalance.CurrencyBalance{Balance: 1000}}
+	require.NoError(t, s.UpdateOrderAccrual(ctx, processed))
+	fixedClock.Advance(time.Hour)
+	processed.Balance.Balance = 400
+	require.NoError(t, s.UpdateOrderAccrual(ctx, processed))
+
+	balances, err := memStorage.GetBalancesAt(ctx, "user", uploaded.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, balances)
+	balances, err = memStorage.GetBalancesAt(ctx, "user", uploaded.Add(48*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), balances[0].Current.Balance)
+	balances, err = memStorage.GetBalancesAt(ctx, "user", fixedClock.Now())
+	require.NoError(t, err)
+	require.Equal(t, int64(400), balances[0].Current.Balance)
+}
+
+// Claimed events are skipped by other relays together with later events of the same user.
+func TestClaimPendingEvents(t *testing.T) {
+	ctx := context.Background()
+	clk := &clock.FixedClock{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewMemoryStorage(clk)
+	for _, login := range []string{"user", "other", "user", "other"} {
+		require.NoError(t, s.AddEvent(ctx, outbox.Event{Type: outbox.BalanceCredited, Login: login}))
+	}
+	claimed, err := s.ClaimPendingEvents(ctx, 1, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), claimed[0].ID)
+
+	claimed, err = s.ClaimPendingEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	require.Equal(t, []int64{2, 4}, []int64{claimed[0].ID, claimed[1].ID})
+
+	require.NoError(t, s.ReleaseEvents(ctx, []int64{1}))
+	claimed, err = s.ClaimPendingEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	require.Equal(t, []int64{1, 3}, []int64{claimed[0].ID, claimed[1].ID})
+
+	require.NoError(t, s.MarkPublished(ctx, []int64{1, 2, 3}))
+	clk.Advance(time.Minute + time.Second)
+	claimed, err = s.ClaimPendingEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.Equal(t, int64(4), claimed[0].ID)
+}
+
+// IDs are not reused after records of deleted accounts are removed.
+func TestIDsAfterDeletion(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage(&clock.FixedClock{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)})
+	sum := currencybalance.CurrencyBalance{Balance: 100}
+	for _, login := range []string{"deleted", "user"} {
+		require.NoError(t, s.AddUser(ctx, userstorage.LoginPassword{Login: login, Password: "hash"}))
+		require.NoError(t, s.AddEvent(ctx, outbox.Event{Type: outbox.BalanceCredited, Login: login}))
+		require.NoError(t, s.AddUserWithdraw(ctx, withdrawstorage.UserWithdraw{Login: login, Number: "1", Program: "points", Withdraw: sum}))
+	}
+	require.NoError(t, s.AnonymizeUser(ctx, "deleted", "anonymous", time.Now()))
+	require.NoError(t, s.PurgeAccount(ctx, "anonymous"))
+
+	require.NoError(t, s.AddEvent(ctx, outbox.Event{Type: outbox.BalanceCredited, Login: "user"}))
+	events, err := s.GetUserEvents(ctx, "user", 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, []int64{2, 3}, []int64{events[0].ID, events[1].ID})
+	require.NoError(t, s.MarkPublished(ctx, []int64{2}))
+	pending, err := s.ClaimPendingEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.Equal(t, int64(3), pending[0].ID)
+
+	_, err = s.ReverseUserWithdraw(ctx, 1, "cancelled")
+	require.ErrorIs(t, err, withdrawstorage.ErrWithdrawNotFound)
+	reversed, err := s.ReverseUserWithdraw(ctx, 2, "cancelled")
+	require.NoError(t, err)
+	require.Equal(t, "user", reversed.Login)
+	require.NoError(t, s.AddUserWithdraw(ctx, withdrawstorage.UserWithdraw{Login: "user", Number: "2", Program: "points", Withdraw: sum}))
+	withdrawals, err := s.GetUserWithdrawals(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), withdrawals[0].ID)
+}
+
+func TestExpireLots(t *testing.T) {
+	ctx := context.Background()
+	fixedClock := &clock.FixedClock{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewMemoryStorage(fixedClock)
+
+	require.NoError(t, s.AddLot(ctx, "user", "points", "1", currencybalance.CurrencyBalance{Balance: 500}))
+	fixedClock.Advance(48 * time.Hour)
+	require.NoError(t, s.AddLot(ctx, "user", "points", "2", currencybalance.CurrencyBalance{Balance: 200}))
+
+	expirations, err := s.ExpireLots(ctx, "points", fixedClock.Now().Add(-time.Hour), fixedClock.Now())
+	require.NoError(t, err)
+	require.Len(t, expirations, 1)
+	require.Equal(t, int64(500), expirations[0].Amount.Balance)
+
+	lots, err := s.GetActiveLots(ctx, "user", "points", fixedClock.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, lots, 1)
+	require.Equal(t, "2", lots[0].Number)
+}
+
+func TestRollback(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage(clock.RealClock{})
+	require.NoError(t, s.AddBalance(ctx, "user", "points", currencybalance.CurrencyBalance{Balance: 100}))
+
+	errFailed := errors.New("failed")
+	err := s.Do(ctx, func(ctx context.Context) error {
+		require.NoError(t, s.AddWithdrawn(ctx, "user", "points", currencybalance.CurrencyBalance{Balance: 30}))
+		require.NoError(t, s.AddUserOrder(ctx, orderstorage.UserOrder{Login: "user", Number: "1", Status: orderstorage.New}))
+		return errFailed
+	})
+	require.ErrorIs(t, err, errFailed)
+
+	balance, err := s.GetBalance(ctx, "user", "points")
+	require.NoError(t, err)
+	require.Equal(t, int64(100), balance.Current.Balance)
+	require.Equal(t, int64(0), balance.Withdrawn.Balance)
+	_, err = s.GetOrder(ctx, "1")
+	require.ErrorIs(t, err, orderstorage.ErrOrderNotFound)
+}
+
+func TestConcurrentAddBalance(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage(clock.RealClock{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.AddBalance(ctx, "user", "points", currencybalance.CurrencyBalance{Balance: 1})
+		}()
+	}
+	wg.Wait()
+
+	balance, err := s.GetBalance(ctx, "user", "points")
+	require.NoError(t, err)
+	require.Equal(t, int64(100), balance.Current.Balance)
+}
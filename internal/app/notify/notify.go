@@ -0,0 +1,74 @@
+// Package notify delivers messages to users, users have no contacts here so delivery
+// channels are expected to resolve them by login.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+type Message struct {
+	Login   string `json:"login"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+}
+
+//go:generate mockery --name Notifier
+type Notifier interface {
+	Notify(ctx context.Context, message Message) error
+}
+
+var ErrUnknownNotifier = errors.New("unknown notifier")
+
+// WriterNotifier writes messages as json lines, used with a file for local development.
+type WriterNotifier struct {
+	mu     sync.Mutex
+	Writer io.Writer
+}
+
+func (n *WriterNotifier) Notify(ctx context.Context, message Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, err = n.Writer.Write(append(data, '\n'))
+	return err
+}
+
+// LogNotifier writes messages to the log, they contain secrets so it is for local development only.
+type LogNotifier struct {
+	Logger *zap.Logger
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, message Message) error {
+	n.Logger.Info("notification", zap.String("login", message.Login),
+		zap.String("subject", message.Subject), zap.String("text", message.Text))
+	return nil
+}
+
+// ParseNotifier creates notifier from "log" or "file:<path>".
+func ParseNotifier(spec string, logger *zap.Logger) (Notifier, error) {
+	kind, target, _ := strings.Cut(spec, ":")
+	switch {
+	case kind == "log":
+		return &LogNotifier{Logger: logger}, nil
+	case kind == "file" && target != "":
+		file, err := os.OpenFile(target, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		return &WriterNotifier{Writer: file}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNotifier, spec)
+	}
+}
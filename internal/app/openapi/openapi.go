@@ -0,0 +1,273 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+//go:embed openapi.json
+var Spec []byte
+
+// SchemaType is a type name or, as OpenAPI 3.1 allows, a list of them.
+type SchemaType []string
+
+func (t *SchemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = SchemaType{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*t = multiple
+	return nil
+}
+
+// Schema is the subset of JSON schema used by the document.
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 SchemaType         `json:"type"`
+	Format               string             `json:"format"`
+	Enum                 []any              `json:"enum"`
+	Pattern              string             `json:"pattern"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	Items                *Schema            `json:"items"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	AnyOf                []*Schema          `json:"anyOf"`
+
+	// pattern is Pattern compiled on load.
+	pattern *regexp.Regexp
+}
+
+// compilePatterns compiles patterns of schema and its subschemas.
+func (s *Schema) compilePatterns() error {
+	if s == nil {
+		return nil
+	}
+	if s.Pattern != "" && s.pattern == nil {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = pattern
+	}
+	if err := s.Items.compilePatterns(); err != nil {
+		return err
+	}
+	for _, property := range s.Properties {
+		if err := property.compilePatterns(); err != nil {
+			return err
+		}
+	}
+	for _, option := range s.AnyOf {
+		if err := option.compilePatterns(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compileContentPatterns(content map[string]MediaType) error {
+	for _, mediaType := range content {
+		if err := mediaType.Schema.compilePatterns(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Ref         string               `json:"$ref"`
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Parameters  []*Parameter         `json:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Components struct {
+	Schemas    map[string]*Schema    `json:"schemas"`
+	Parameters map[string]*Parameter `json:"parameters"`
+	Responses  map[string]*Response  `json:"responses"`
+}
+
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+const (
+	schemasPrefix    = "#/components/schemas/"
+	parametersPrefix = "#/components/parameters/"
+	responsesPrefix  = "#/components/responses/"
+)
+
+// Load parses embedded document resolving references of parameters and responses and compiling
+// patterns, schema references are resolved on use.
+func Load() (*Document, error) {
+	var document Document
+	if err := json.Unmarshal(Spec, &document); err != nil {
+		return nil, err
+	}
+	if err := document.compilePatterns(); err != nil {
+		return nil, err
+	}
+	for path, operations := range document.Paths {
+		for method, operation := range operations {
+			for i, parameter := range operation.Parameters {
+				if parameter.Ref == "" {
+					continue
+				}
+				resolved, ok := document.Components.Parameters[strings.TrimPrefix(parameter.Ref, parametersPrefix)]
+				if !ok {
+					return nil, fmt.Errorf("%s %s: unknown parameter %s", method, path, parameter.Ref)
+				}
+				operation.Parameters[i] = resolved
+			}
+			for status, response := range operation.Responses {
+				if response.Ref == "" {
+					continue
+				}
+				resolved, ok := document.Components.Responses[strings.TrimPrefix(response.Ref, responsesPrefix)]
+				if !ok {
+					return nil, fmt.Errorf("%s %s: unknown response %s", method, path, response.Ref)
+				}
+				operation.Responses[status] = resolved
+			}
+		}
+	}
+	return &document, nil
+}
+
+func (d *Document) compilePatterns() error {
+	for name, schema := range d.Components.Schemas {
+		if err := schema.compilePatterns(); err != nil {
+			return fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+	for name, parameter := range d.Components.Parameters {
+		if err := parameter.Schema.compilePatterns(); err != nil {
+			return fmt.Errorf("parameter %s: %w", name, err)
+		}
+	}
+	for name, response := range d.Components.Responses {
+		if err := compileContentPatterns(response.Content); err != nil {
+			return fmt.Errorf("response %s: %w", name, err)
+		}
+	}
+	for path, operations := range d.Paths {
+		for method, operation := range operations {
+			if err := compileOperationPatterns(operation); err != nil {
+				return fmt.Errorf("%s %s: %w", method, path, err)
+			}
+		}
+	}
+	return nil
+}
+
+func compileOperationPatterns(operation *Operation) error {
+	for _, parameter := range operation.Parameters {
+		if err := parameter.Schema.compilePatterns(); err != nil {
+			return err
+		}
+	}
+	if operation.RequestBody != nil {
+		if err := compileContentPatterns(operation.RequestBody.Content); err != nil {
+			return err
+		}
+	}
+	for _, response := range operation.Responses {
+		if err := compileContentPatterns(response.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func MustLoad() *Document {
+	document, err := Load()
+	if err != nil {
+		panic(err)
+	}
+	return document
+}
+
+// Resolve follows schema reference.
+func (d *Document) Resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = d.Components.Schemas[strings.TrimPrefix(schema.Ref, schemasPrefix)]
+	}
+	return schema
+}
+
+// Find returns operation serving request path, its path template and values of path parameters.
+func (d *Document) Find(method string, path string) (*Operation, string, map[string]string) {
+	segments := strings.Split(path, "/")
+	for template, operations := range d.Paths {
+		operation, ok := operations[strings.ToLower(method)]
+		if !ok {
+			continue
+		}
+		if params, ok := matchPath(strings.Split(template, "/"), segments); ok {
+			return operation, template, params
+		}
+	}
+	return nil, "", nil
+}
+
+func matchPath(template []string, segments []string) (map[string]string, bool) {
+	if len(template) != len(segments) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, part := range template {
+		if name, ok := strings.CutPrefix(part, "{"); ok {
+			params[strings.TrimSuffix(name, "}")] = segments[i]
+		} else if part != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func ServeSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(Spec)
+}
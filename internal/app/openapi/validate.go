@@ -0,0 +1,248 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+)
+
+// Validate checks json value decoded with UseNumber against schema, field names of errors are json paths.
+func (d *Document) Validate(schema *Schema, value any, field string) error {
+	validationErr := &validators.ValidationError{}
+	d.validate(schema, value, field, validationErr)
+	return validationErr.OrNil()
+}
+
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return ""
+}
+
+func typeMatches(types SchemaType, actual string) bool {
+	return len(types) == 0 || slices.Contains(types, actual) || (actual == "integer" && slices.Contains(types, "number"))
+}
+
+func formatIsValid(format string, value string) bool {
+	var err error
+	switch format {
+	case "date":
+		_, err = time.Parse("2006-01-02", value)
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, value)
+	case "uri":
+		return strings.Contains(value, "://")
+	}
+	return err == nil
+}
+
+func join(field string, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+func (d *Document) validate(schema *Schema, value any, field string, validationErr *validators.ValidationError) {
+	schema = d.Resolve(schema)
+	if schema == nil {
+		return
+	}
+	if len(schema.AnyOf) > 0 {
+		for _, option := range schema.AnyOf {
+			if d.Validate(option, value, field) == nil {
+				return
+			}
+		}
+		validationErr.Add(field, "does not match any of allowed schemas")
+		return
+	}
+
+	actual := jsonType(value)
+	if !typeMatches(schema.Type, actual) {
+		validationErr.Add(field, "must be "+strings.Join(schema.Type, " or "))
+		return
+	}
+	if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, value) {
+		validationErr.Add(field, fmt.Sprintf("must be one of %v", schema.Enum))
+		return
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			validationErr.Add(field, fmt.Sprintf("must be at least %d characters", *schema.MinLength))
+		} else if schema.MaxLength != nil && length > *schema.MaxLength {
+			validationErr.Add(field, fmt.Sprintf("must be at most %d characters", *schema.MaxLength))
+		} else if schema.pattern != nil && !schema.pattern.MatchString(v) {
+			validationErr.Add(field, "must match "+schema.Pattern)
+		} else if !formatIsValid(schema.Format, v) {
+			validationErr.Add(field, "must be "+schema.Format)
+		}
+	case json.Number:
+		number, err := v.Float64()
+		if err != nil {
+			validationErr.Add(field, "must be a number")
+		} else if schema.Minimum != nil && number < *schema.Minimum {
+			validationErr.Add(field, fmt.Sprintf("must be at least %v", *schema.Minimum))
+		} else if schema.ExclusiveMinimum != nil && number <= *schema.ExclusiveMinimum {
+			validationErr.Add(field, fmt.Sprintf("must be greater than %v", *schema.ExclusiveMinimum))
+		} else if schema.Maximum != nil && number > *schema.Maximum {
+			validationErr.Add(field, fmt.Sprintf("must be at most %v", *schema.Maximum))
+		}
+	case []any:
+		if schema.MinItems != nil && len(v) < *schema.MinItems {
+			validationErr.Add(field, fmt.Sprintf("must contain at least %d items", *schema.MinItems))
+		} else if schema.MaxItems != nil && len(v) > *schema.MaxItems {
+			validationErr.Add(field, fmt.Sprintf("must contain at most %d items", *schema.MaxItems))
+		}
+		for i, item := range v {
+			d.validate(schema.Items, item, fmt.Sprintf("%s[%d]", field, i), validationErr)
+		}
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, ok := v[name]; !ok {
+				validationErr.Add(join(field, name), "is required")
+			}
+		}
+		for name, item := range v {
+			property, ok := schema.Properties[name]
+			if !ok && schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+				validationErr.Add(join(field, name), "unknown field")
+			} else if ok {
+				d.validate(property, item, join(field, name), validationErr)
+			}
+		}
+	}
+}
+
+// parameterValue converts parameter string to json value of schema type.
+func (d *Document) parameterValue(schema *Schema, value string) any {
+	schema = d.Resolve(schema)
+	if schema != nil && (slices.Contains(schema.Type, "integer") || slices.Contains(schema.Type, "number")) {
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return json.Number(value)
+		}
+	}
+	return value
+}
+
+func (d *Document) validateParameters(r *http.Request, operation *Operation, pathParams map[string]string) error {
+	validationErr := &validators.ValidationError{}
+	for _, parameter := range operation.Parameters {
+		var value string
+		var present bool
+		switch parameter.In {
+		case "path":
+			value, present = pathParams[parameter.Name]
+		case "query":
+			present = r.URL.Query().Has(parameter.Name)
+			value = r.URL.Query().Get(parameter.Name)
+		case "header":
+			value = r.Header.Get(parameter.Name)
+			present = value != ""
+		}
+		if !present {
+			if parameter.Required {
+				validationErr.Add(parameter.Name, "is required")
+			}
+			continue
+		}
+		d.validate(parameter.Schema, d.parameterValue(parameter.Schema, value), parameter.Name, validationErr)
+	}
+	return validationErr.OrNil()
+}
+
+// requestMediaType returns documented media type of request, requests without Content-Type
+// are taken for json if it is the only accepted type.
+func requestMediaType(r *http.Request, body *RequestBody) (string, error) {
+	contentTypes := make([]string, 0, len(body.Content))
+	for contentType := range body.Content {
+		contentTypes = append(contentTypes, contentType)
+	}
+	slices.Sort(contentTypes)
+	header := r.Header.Get("Content-Type")
+	if header == "" && len(contentTypes) == 1 && contentTypes[0] == "application/json" {
+		return contentTypes[0], nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil || !slices.Contains(contentTypes, mediaType) {
+		return "", validators.NewFieldError("Content-Type", "must be "+strings.Join(contentTypes, " or "))
+	}
+	return mediaType, nil
+}
+
+func (d *Document) validateBody(r *http.Request, mediaType string, schema *Schema) error {
+	data, err := validators.ReadBody(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if mediaType != "application/json" {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err = decoder.Decode(&value); err != nil {
+		return fmt.Errorf("%w: %s", validators.ErrInvalidJSON, err.Error())
+	}
+	if _, err = decoder.Token(); err != io.EOF {
+		return fmt.Errorf("%w: body must contain a single json value", validators.ErrInvalidJSON)
+	}
+	return d.Validate(schema, value, "")
+}
+
+// ValidateRequest rejects requests to documented operations not matching their parameters and body schemas,
+// undocumented routes are left to router.
+func (d *Document) ValidateRequest(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operation, _, pathParams := d.Find(r.Method, r.URL.Path)
+		if operation == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if err := d.validateParameters(r, operation, pathParams); err != nil {
+			validators.WriteError(w, err, http.StatusBadRequest)
+			return
+		}
+		if operation.RequestBody != nil {
+			mediaType, err := requestMediaType(r, operation.RequestBody)
+			if err != nil {
+				validators.WriteError(w, err, http.StatusUnsupportedMediaType)
+				return
+			}
+			if err = d.validateBody(r, mediaType, operation.RequestBody.Content[mediaType].Schema); err != nil {
+				validators.WriteError(w, err, validators.ErrorStatus(err))
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
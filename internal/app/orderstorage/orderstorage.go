@@ -2,13 +2,14 @@ package orderstorage
 
 import (
 	"context"
-	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
-	"github.com/jackc/pgerrcode"
-	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/pgdb"
 )
 
 type OrderStatus string
@@ -28,119 +29,244 @@ func IsFinal(status OrderStatus) bool {
 type UserOrder struct {
 	Login    string
 	Number   string                          `json:"number"`
+	Program  string                          `json:"program,omitempty"`
 	Status   OrderStatus                     `json:"status"`
 	Balance  currencybalance.CurrencyBalance `json:"accrual"`
 	Uploaded time.Time                       `json:"uploaded_at"`
 }
 
+// Adjustment is a compensating balance change made when accrual system revises a final order.
+type Adjustment struct {
+	Login   string                          `json:"-"`
+	Number  string                          `json:"order"`
+	Program string                          `json:"program"`
+	Amount  currencybalance.CurrencyBalance `json:"amount"`
+	Reason  string                          `json:"reason"`
+	Created time.Time                       `json:"created_at"`
+}
+
 //go:generate mockery --name OrderStorage
 type OrderStorage interface {
 	AddUserOrder(context context.Context, order UserOrder) error
 
+	// AddUserOrders inserts orders with distinct numbers in one statement, result of every order is nil,
+	// ErrAlreadySent or ErrOrderExists in the order of input.
+	AddUserOrders(ctx context.Context, orders []UserOrder) ([]error, error)
+
+	GetOrder(ctx context.Context, number string) (UserOrder, error)
+
+	// GetOrderForUpdate locks order until the end of transaction.
+	GetOrderForUpdate(ctx context.Context, number string) (UserOrder, error)
+
 	GetUserOrders(context context.Context, login string) ([]UserOrder, error)
 
-	UpdateProcessedOrder(ctx context.Context, order UserOrder) error
+	UpdateOrder(ctx context.Context, order UserOrder) error
+
+	AddAdjustment(ctx context.Context, adjustment Adjustment) error
+
+	GetUserAdjustments(ctx context.Context, login string) ([]Adjustment, error)
 }
 
 type DatabaseOrderStorage struct {
-	DB *sql.DB
+	Pool *pgxpool.Pool
 }
 
 func (s *DatabaseOrderStorage) Init() error {
-	tx, err := s.DB.BeginTx(context.Background(), nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-	tx.Exec(`CREATE TYPE status AS ENUM ('PROCESSED', 'INVALID', 'PROCESSING', 'NEW')`)
-	tx.Exec(`CREATE TABLE IF NOT EXISTS orders("login" TEXT, "number" BIGINT, "status" status, "balance" BIGINT, "uploaded" TIMESTAMP DEFAULT CURRENT_TIMESTAMP)`)
-	tx.Exec(`CREATE UNIQUE INDEX orders_index ON orders USING btree(number)`)
-	tx.Exec(`CREATE INDEX user_orders_index ON orders USING btree(login)`)
-	return tx.Commit()
+	return pgdb.ExecBatch(context.Background(), s.Pool,
+		`DO $$ BEGIN
+			CREATE TYPE status AS ENUM ('PROCESSED', 'INVALID', 'PROCESSING', 'NEW');
+		EXCEPTION WHEN duplicate_object THEN NULL;
+		END $$`,
+		`CREATE TABLE IF NOT EXISTS orders("login" TEXT, "number" TEXT, "status" status, "balance" BIGINT, "uploaded" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP)`,
+		pgdb.AlterColumnType("orders", "number", "text"),
+		pgdb.AlterColumnType("orders", "uploaded", "timestamp with time zone"),
+		`CREATE UNIQUE INDEX IF NOT EXISTS orders_index ON orders USING btree(number)`,
+		`CREATE INDEX IF NOT EXISTS user_orders_index ON orders USING btree(login)`,
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS "program" TEXT`,
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS "accrued" TIMESTAMPTZ`,
+		`CREATE TABLE IF NOT EXISTS adjustments("login" TEXT, "number" TEXT, "program" TEXT, "amount" BIGINT, "reason" TEXT, "created" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP)`,
+		`CREATE INDEX IF NOT EXISTS user_adjustments_index ON adjustments USING btree(login)`,
+	)
 }
 
 var ErrOrderExists = errors.New("conflicting order exists")
 var ErrAlreadySent = errors.New("order has been already sent by user")
+var ErrOrderNotFound = errors.New("order not found")
 
 func (s *DatabaseOrderStorage) AddUserOrder(ctx context.Context, order UserOrder) error {
-	tx, err := s.DB.BeginTx(ctx, nil)
-	if err != nil {
+	db := pgdb.Conn(ctx, s.Pool)
+	tag, err := db.Exec(ctx,
+		`INSERT into orders (login,number,program,status,balance,accrued)
+			VALUES ($1,$2,$3,$4,$5,CASE WHEN $4 = 'PROCESSED' THEN CURRENT_TIMESTAMP END) ON CONFLICT (number) DO NOTHING`,
+		order.Login, order.Number, order.Program, order.Status, order.Balance.Balance)
+	if err != nil || tag.RowsAffected() == 1 {
 		return err
 	}
-	defer tx.Rollback()
-	_, err = tx.ExecContext(ctx,
-		`INSERT into orders (login,number,status,balance) VALUES ($1,$2,$3,$4)`,
-		order.Login, order.Number, order.Status, order.Balance.Balance)
-	if e, ok := err.(*pgconn.PgError); ok && e.Code == pgerrcode.UniqueViolation {
-		var login string
-		err = s.DB.QueryRowContext(ctx,
-			"SELECT login FROM orders WHERE number = $1", order.Number).Scan(&login)
-		if err == nil {
-			if login == order.Login {
-				return ErrAlreadySent
-			} else {
-				return ErrOrderExists
-			}
-		}
+	var login string
+	if err = db.QueryRow(ctx, "SELECT login FROM orders WHERE number = $1", order.Number).Scan(&login); err != nil {
+		return err
+	}
+	if login == order.Login {
+		return ErrAlreadySent
 	}
-	if err == nil && order.Status == Processed {
-		_, err = tx.ExecContext(ctx, "UPDATE users SET balance=balance+$1 WHERE login=$2",
-			order.Balance.Balance, order.Login)
+	return ErrOrderExists
+}
+
+func (s *DatabaseOrderStorage) AddUserOrders(ctx context.Context, orders []UserOrder) ([]error, error) {
+	const insertQuery = `
+		INSERT INTO orders (login, number, program, status, balance, accrued)
+		SELECT login, number, program, status::status, balance, CASE WHEN status = 'PROCESSED' THEN CURRENT_TIMESTAMP END
+			FROM unnest($1::TEXT[], $2::TEXT[], $3::TEXT[], $4::TEXT[], $5::BIGINT[]) AS t(login, number, program, status, balance)
+		ON CONFLICT (number) DO NOTHING
+		RETURNING number
+	`
+	logins, numbers, programs, statuses, balances := make([]string, len(orders)), make([]string, len(orders)),
+		make([]string, len(orders)), make([]string, len(orders)), make([]int64, len(orders))
+	for i, order := range orders {
+		logins[i], numbers[i], programs[i], statuses[i], balances[i] = order.Login, order.Number, order.Program, string(order.Status), order.Balance.Balance
 	}
+	db := pgdb.Conn(ctx, s.Pool)
+	rows, err := db.Query(ctx, insertQuery, logins, numbers, programs, statuses, balances)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	inserted, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	results := make([]error, len(orders))
+	if len(inserted) == len(orders) {
+		return results, nil
 	}
-	return tx.Commit()
-}
 
-func (s *DatabaseOrderStorage) GetUserOrders(ctx context.Context, login string) ([]UserOrder, error) {
-	var res []UserOrder
-	rows, err := s.DB.QueryContext(ctx,
-		"SELECT login, number, status, balance, uploaded FROM orders WHERE login = $1", login)
+	rows, err = db.Query(ctx, "SELECT number, login FROM orders WHERE number = ANY($1)", numbers)
 	if err != nil {
 		return nil, err
 	}
-	if rows.Err() != nil {
-		return nil, rows.Err()
+	owners := make(map[string]string, len(orders))
+	var number, login string
+	_, err = pgx.ForEachRow(rows, []any{&number, &login}, func() error {
+		owners[number] = login
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, number := range inserted {
+		delete(owners, number)
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var order UserOrder
-		err = rows.Scan(&order.Login, &order.Number, &order.Status, &order.Balance.Balance, &order.Uploaded)
-		if err != nil {
-			return nil, err
+	for i, order := range orders {
+		if owner, ok := owners[order.Number]; !ok {
+			continue
+		} else if owner == order.Login {
+			results[i] = ErrAlreadySent
+		} else {
+			results[i] = ErrOrderExists
 		}
-
-		res = append(res, order)
 	}
+	return results, nil
+}
 
-	return res, nil
+func scanOrder(row pgx.CollectableRow) (UserOrder, error) {
+	var order UserOrder
+	err := row.Scan(&order.Login, &order.Number, &order.Program, &order.Status, &order.Balance.Balance, &order.Uploaded)
+	return order, err
 }
 
-func (s *DatabaseOrderStorage) UpdateProcessedOrder(ctx context.Context, order UserOrder) error {
-	if order.Status != Processed {
-		return nil
-	}
-	tx, err := s.DB.BeginTx(ctx, nil)
+func (s *DatabaseOrderStorage) GetUserOrders(ctx context.Context, login string) ([]UserOrder, error) {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx,
+		"SELECT login, number, COALESCE(program, ''), status, balance, uploaded FROM orders WHERE login = $1 ORDER BY uploaded DESC", login)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer tx.Rollback()
-	res, err := tx.ExecContext(ctx, "UPDATE orders SET status=$1, balance=$2 WHERE number=$3 and status!='PROCESSED'",
-		order.Status, order.Balance.Balance, order.Number)
+	return pgx.CollectRows(rows, scanOrder)
+}
+
+func (s *DatabaseOrderStorage) GetOrder(ctx context.Context, number string) (UserOrder, error) {
+	return s.getOrder(ctx, "SELECT login, number, COALESCE(program, ''), status, balance, uploaded FROM orders WHERE number = $1", number)
+}
+
+func (s *DatabaseOrderStorage) GetOrderForUpdate(ctx context.Context, number string) (UserOrder, error) {
+	return s.getOrder(ctx, "SELECT login, number, COALESCE(program, ''), status, balance, uploaded FROM orders WHERE number = $1 FOR UPDATE", number)
+}
+
+func (s *DatabaseOrderStorage) getOrder(ctx context.Context, query string, number string) (UserOrder, error) {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx, query, number)
 	if err != nil {
-		return err
+		return UserOrder{}, err
+	}
+	order, err := pgx.CollectExactlyOneRow(rows, scanOrder)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return UserOrder{}, ErrOrderNotFound
 	}
-	rowsUpdated, _ := res.RowsAffected()
-	if rowsUpdated != 0 {
-		tx.ExecContext(ctx, "UPDATE users SET balance=balance+$1 WHERE number=$2",
-			order.Balance, order.Login)
+	return order, err
+}
+
+func credited(status OrderStatus, balance currencybalance.CurrencyBalance) currencybalance.CurrencyBalance {
+	if status != Processed {
+		return currencybalance.CurrencyBalance{}
+	}
+	return balance
+}
+
+// ReviseAccrual returns order to store, balance delta to apply and adjustment reason
+// which is empty unless previously final order is changed.
+func ReviseAccrual(previous UserOrder, order UserOrder) (UserOrder, currencybalance.CurrencyBalance, string, error) {
+	// order keeps program it was first credited to
+	order.Login = previous.Login
+	if previous.Program != "" && IsFinal(previous.Status) {
+		order.Program = previous.Program
+	}
+
+	delta := credited(order.Status, order.Balance)
+	if err := delta.Withdraw(credited(previous.Status, previous.Balance)); err != nil {
+		return UserOrder{}, currencybalance.CurrencyBalance{}, "", err
+	}
+	if delta.Balance == 0 || !IsFinal(previous.Status) {
+		return order, delta, "", nil
+	}
+	if order.Status == Invalid {
+		return order, delta, "order re-marked " + string(Invalid), nil
+	}
+	return order, delta, fmt.Sprintf("accrual changed from %s to %s", previous.Balance.String(), order.Balance.String()), nil
+}
+
+// UpdateOrder keeps time the order was first credited, it dates accrual of the order in balance history.
+func (s *DatabaseOrderStorage) UpdateOrder(ctx context.Context, order UserOrder) error {
+	const updateQuery = `
+		UPDATE orders SET status=$1, balance=$2, program=$3,
+			accrued=COALESCE(accrued, CASE WHEN $1 = 'PROCESSED' THEN CURRENT_TIMESTAMP END)
+		WHERE number=$4
+	`
+	tag, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, updateQuery, order.Status, order.Balance.Balance, order.Program, order.Number)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrOrderNotFound
+	}
+	return err
+}
+
+func (s *DatabaseOrderStorage) AddAdjustment(ctx context.Context, adjustment Adjustment) error {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx,
+		"INSERT INTO adjustments (login, number, program, amount, reason) VALUES ($1, $2, $3, $4, $5)",
+		adjustment.Login, adjustment.Number, adjustment.Program, adjustment.Amount.Balance, adjustment.Reason)
+	return err
+}
+
+func (s *DatabaseOrderStorage) GetUserAdjustments(ctx context.Context, login string) ([]Adjustment, error) {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx,
+		"SELECT login, number, program, amount, reason, created FROM adjustments WHERE login = $1 ORDER BY created DESC", login)
+	if err != nil {
+		return nil, err
 	}
-	return tx.Commit()
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Adjustment, error) {
+		var adjustment Adjustment
+		err := row.Scan(&adjustment.Login, &adjustment.Number, &adjustment.Program, &adjustment.Amount.Balance, &adjustment.Reason, &adjustment.Created)
+		return adjustment, err
+	})
 }
 
-func NewDatabaseOrderStorage(db *sql.DB) *DatabaseOrderStorage {
-	ret := &DatabaseOrderStorage{DB: db}
+func NewDatabaseOrderStorage(pool *pgxpool.Pool) *DatabaseOrderStorage {
+	ret := &DatabaseOrderStorage{Pool: pool}
 	ret.Init()
 	return ret
 }
@@ -0,0 +1,232 @@
+package outbox
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/pgdb"
+)
+
+type EventType string
+
+const (
+	OrderProcessed     EventType = "order.processed"
+	OrderStatusChanged EventType = "order.status_changed"
+	BalanceCredited    EventType = "balance.credited"
+	BalanceDebited     EventType = "balance.debited"
+	WithdrawalCreated  EventType = "withdrawal.created"
+	WithdrawalReversed EventType = "withdrawal.reversed"
+	PointsExpired      EventType = "points.expired"
+	UserLocked         EventType = "user.locked"
+	UserLoginAnomaly   EventType = "user.login_anomaly"
+)
+
+// EventsChannel is notified with user login on commit of every stored event.
+const EventsChannel = "outbox_events"
+
+// Event is a domain event stored in the same transaction as the change it describes.
+type Event struct {
+	ID      int64           `json:"id"`
+	Type    EventType       `json:"type"`
+	Login   string          `json:"login"`
+	Data    json.RawMessage `json:"data"`
+	Created time.Time       `json:"created_at"`
+}
+
+type OrderProcessedData struct {
+	Number  string                          `json:"order"`
+	Program string                          `json:"program"`
+	Accrual currencybalance.CurrencyBalance `json:"accrual"`
+}
+
+type OrderStatusChangedData struct {
+	Number   string                   `json:"order"`
+	Status   orderstorage.OrderStatus `json:"status"`
+	Previous orderstorage.OrderStatus `json:"previous_status,omitempty"`
+}
+
+type BalanceCreditedData struct {
+	Number  string                          `json:"order"`
+	Program string                          `json:"program"`
+	Amount  currencybalance.CurrencyBalance `json:"amount"`
+}
+
+type BalanceDebitedData struct {
+	Number  string                          `json:"order"`
+	Program string                          `json:"program"`
+	Amount  currencybalance.CurrencyBalance `json:"amount"`
+	Reason  string                          `json:"reason"`
+}
+
+type WithdrawalCreatedData struct {
+	Number  string                          `json:"order"`
+	Program string                          `json:"program"`
+	Sum     currencybalance.CurrencyBalance `json:"sum"`
+}
+
+type WithdrawalReversedData struct {
+	Number  string                          `json:"order"`
+	Program string                          `json:"program"`
+	Sum     currencybalance.CurrencyBalance `json:"sum"`
+	Reason  string                          `json:"reason"`
+}
+
+type PointsExpiredData struct {
+	Program string                          `json:"program"`
+	Amount  currencybalance.CurrencyBalance `json:"amount"`
+}
+
+type UserLockedData struct {
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+	IP          string    `json:"ip"`
+}
+
+type UserLoginAnomalyData struct {
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Reason    string `json:"reason"`
+}
+
+func NewEvent(eventType EventType, login string, data any) (Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Type: eventType, Login: login, Data: payload}, nil
+}
+
+//go:generate mockery --name OutboxStorage
+type OutboxStorage interface {
+	// AddEvent stores event in the transaction of the context.
+	AddEvent(ctx context.Context, event Event) error
+
+	// ClaimPendingEvents returns oldest unpublished events not claimed by another relay and claims them for lease,
+	// an event is not claimed while earlier event of the same user is claimed by another relay.
+	ClaimPendingEvents(ctx context.Context, limit int, lease time.Duration) ([]Event, error)
+
+	MarkPublished(ctx context.Context, ids []int64) error
+
+	// ReleaseEvents drops claims of unpublished events so the next claim returns them again.
+	ReleaseEvents(ctx context.Context, ids []int64) error
+}
+
+// EventLog reads stored events of a user regardless of their publishing.
+//
+//go:generate mockery --name EventLog
+type EventLog interface {
+	GetUserEvents(ctx context.Context, login string, afterID int64, limit int) ([]Event, error)
+
+	GetLastUserEventID(ctx context.Context, login string) (int64, error)
+}
+
+type DatabaseOutboxStorage struct {
+	Pool *pgxpool.Pool
+}
+
+func (s *DatabaseOutboxStorage) Init() error {
+	return pgdb.ExecBatch(context.Background(), s.Pool,
+		`CREATE TABLE IF NOT EXISTS outbox("id" BIGSERIAL PRIMARY KEY, "type" TEXT, "login" TEXT, "data" JSONB, "created" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, "published" TIMESTAMPTZ)`,
+		`ALTER TABLE outbox ADD COLUMN IF NOT EXISTS "claimed_until" TIMESTAMPTZ`,
+		`CREATE INDEX IF NOT EXISTS outbox_pending_index ON outbox USING btree(id) WHERE published IS NULL`,
+		`CREATE INDEX IF NOT EXISTS outbox_login_index ON outbox USING btree(login, id)`,
+		`CREATE TABLE IF NOT EXISTS outbox_logins("login" TEXT PRIMARY KEY, "last_id" BIGINT)`,
+	)
+}
+
+// AddEvent stores event and notifies EventsChannel, notification is delivered when transaction commits.
+// Event id is taken holding the row of user in outbox_logins until commit, so events of a user
+// commit in order of their ids and readers resuming after the last seen id miss none of them.
+func (s *DatabaseOutboxStorage) AddEvent(ctx context.Context, event Event) error {
+	const addQuery = `
+		WITH next AS (
+			INSERT INTO outbox_logins (login, last_id) VALUES ($2, nextval('outbox_id_seq'))
+			ON CONFLICT (login) DO UPDATE SET last_id = nextval('outbox_id_seq')
+			RETURNING last_id
+		), added AS (
+			INSERT INTO outbox (id, type, login, data) SELECT last_id, $1, $2, $3 FROM next RETURNING login
+		)
+		SELECT pg_notify($4, login) FROM added
+	`
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, addQuery, event.Type, event.Login, event.Data, EventsChannel)
+	return err
+}
+
+// claims of concurrent relays are serialized so that every relay sees claims of the others
+const claimLockKey = 7460380815
+
+// ClaimPendingEvents must run in a transaction, claims are visible to other relays when it commits.
+func (s *DatabaseOutboxStorage) ClaimPendingEvents(ctx context.Context, limit int, lease time.Duration) ([]Event, error) {
+	const claimQuery = `
+		UPDATE outbox SET claimed_until = CURRENT_TIMESTAMP + $2 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM outbox pending
+			WHERE published IS NULL AND (claimed_until IS NULL OR claimed_until < CURRENT_TIMESTAMP)
+				AND NOT EXISTS (
+					SELECT 1 FROM outbox claimed
+					WHERE claimed.login = pending.login AND claimed.id < pending.id
+						AND claimed.published IS NULL AND claimed.claimed_until >= CURRENT_TIMESTAMP
+				)
+			ORDER BY id LIMIT $1
+		)
+		RETURNING id, type, login, data, created
+	`
+	conn := pgdb.Conn(ctx, s.Pool)
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", claimLockKey); err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, claimQuery, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	events, err := pgx.CollectRows(rows, scanEvent)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(events, func(a, b Event) int { return cmp.Compare(a.ID, b.ID) })
+	return events, nil
+}
+
+func (s *DatabaseOutboxStorage) MarkPublished(ctx context.Context, ids []int64) error {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, "UPDATE outbox SET published=CURRENT_TIMESTAMP WHERE id = ANY($1)", ids)
+	return err
+}
+
+func (s *DatabaseOutboxStorage) ReleaseEvents(ctx context.Context, ids []int64) error {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, "UPDATE outbox SET claimed_until=NULL WHERE id = ANY($1)", ids)
+	return err
+}
+
+func scanEvent(row pgx.CollectableRow) (Event, error) {
+	var event Event
+	err := row.Scan(&event.ID, &event.Type, &event.Login, &event.Data, &event.Created)
+	return event, err
+}
+
+func (s *DatabaseOutboxStorage) GetUserEvents(ctx context.Context, login string, afterID int64, limit int) ([]Event, error) {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx,
+		"SELECT id, type, login, data, created FROM outbox WHERE login=$1 AND id>$2 ORDER BY id LIMIT $3", login, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanEvent)
+}
+
+func (s *DatabaseOutboxStorage) GetLastUserEventID(ctx context.Context, login string) (int64, error) {
+	var id int64
+	err := pgdb.Conn(ctx, s.Pool).QueryRow(ctx, "SELECT COALESCE(MAX(id), 0) FROM outbox WHERE login=$1", login).Scan(&id)
+	return id, err
+}
+
+func NewDatabaseOutboxStorage(pool *pgxpool.Pool) *DatabaseOutboxStorage {
+	ret := &DatabaseOutboxStorage{Pool: pool}
+	ret.Init()
+	return ret
+}
@@ -0,0 +1,95 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/valinurovdenis/gomart/internal/app/logger"
+	"github.com/valinurovdenis/gomart/internal/app/txmanager"
+	"go.uber.org/zap"
+)
+
+// Relay publishes stored events to sink at least once keeping order of events of every user.
+type Relay struct {
+	Storage   OutboxStorage
+	TxManager txmanager.TxManager
+	Sink      Sink
+	BatchSize int
+	Interval  time.Duration
+	// Lease is how long claimed events are kept from other relays, events are claimed again
+	// after it expires if relay did not mark them published.
+	Lease time.Duration
+	Stop  func()
+}
+
+// RelayOnce claims a batch of pending events and publishes it outside of transaction,
+// after a failed delivery later events of the same user are released for the next run.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	var events []Event
+	err := r.TxManager.Do(ctx, func(ctx context.Context) error {
+		var err error
+		events, err = r.Storage.ClaimPendingEvents(ctx, r.BatchSize, r.Lease)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	var published, released []int64
+	var publishErr error
+	blocked := make(map[string]bool)
+	for _, event := range events {
+		if blocked[event.Login] {
+			released = append(released, event.ID)
+			continue
+		}
+		if err = r.Sink.Publish(ctx, event); err != nil {
+			blocked[event.Login] = true
+			released = append(released, event.ID)
+			publishErr = err
+			continue
+		}
+		published = append(published, event.ID)
+	}
+	err = r.TxManager.Do(ctx, func(ctx context.Context) error {
+		if len(published) > 0 {
+			if err := r.Storage.MarkPublished(ctx, published); err != nil {
+				return err
+			}
+		}
+		if len(released) > 0 {
+			return r.Storage.ReleaseEvents(ctx, released)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(published), publishErr
+}
+
+func (r *Relay) runRelay(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		published, err := r.RelayOnce(ctx)
+		if err != nil {
+			logger.Log.Error("failed to relay events", zap.Error(err))
+		}
+		// keep draining while there are full batches
+		if published == r.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func NewRelay(storage OutboxStorage, txManager txmanager.TxManager, sink Sink, batchSize int, interval time.Duration, lease time.Duration) *Relay {
+	ctx, stop := context.WithCancel(context.Background())
+	ret := &Relay{Storage: storage, TxManager: txManager, Sink: sink, BatchSize: batchSize, Interval: interval, Lease: lease, Stop: stop}
+	go ret.runRelay(ctx)
+	return ret
+}
@@ -0,0 +1,53 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"github.com/valinurovdenis/gomart/mocks"
+)
+
+type failingSink struct {
+	failIDs   map[int64]bool
+	published []int64
+}
+
+func (s *failingSink) Publish(ctx context.Context, event outbox.Event) error {
+	if s.failIDs[event.ID] {
+		return errors.New("unavailable")
+	}
+	s.published = append(s.published, event.ID)
+	return nil
+}
+
+func TestRelay_RelayOnce(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := mocks.NewOutboxStorage(t)
+	mockTx := mocks.NewTxManager(t)
+	mockTx.On("Do", ctx, mock.Anything).Return(func(ctx context.Context, fn func(context.Context) error) error {
+		return fn(ctx)
+	})
+	sink := &failingSink{failIDs: map[int64]bool{2: true}}
+	relay := &outbox.Relay{Storage: mockStorage, TxManager: mockTx, Sink: sink, BatchSize: 10, Lease: time.Minute}
+
+	events := []outbox.Event{
+		{ID: 1, Type: outbox.OrderProcessed, Login: "a"},
+		{ID: 2, Type: outbox.OrderProcessed, Login: "b"},
+		{ID: 3, Type: outbox.BalanceCredited, Login: "a"},
+		{ID: 4, Type: outbox.BalanceCredited, Login: "b"},
+	}
+	mockStorage.On("ClaimPendingEvents", ctx, 10, time.Minute).Return(events, nil).Once()
+	mockStorage.On("MarkPublished", ctx, []int64{1, 3}).Return(nil).Once()
+	// event 4 waits for failed event 2 of the same user
+	mockStorage.On("ReleaseEvents", ctx, []int64{2, 4}).Return(nil).Once()
+
+	published, err := relay.RelayOnce(ctx)
+	require.Error(t, err)
+	require.Equal(t, 2, published)
+	require.Equal(t, []int64{1, 3}, sink.published)
+}
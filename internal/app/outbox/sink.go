@@ -0,0 +1,134 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.dataddo.com/pgq"
+	"go.dataddo.com/pgq/x/schema"
+)
+
+// Sink delivers events to other systems, delivery is retried until it succeeds.
+type Sink interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+var ErrUnknownSink = errors.New("unknown outbox sink")
+var ErrDeliveryFailed = errors.New("event delivery failed")
+
+// WriterSink writes events as json lines, used with stdout or a file for testing.
+type WriterSink struct {
+	mu     sync.Mutex
+	Writer io.Writer
+}
+
+func (s *WriterSink) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.Writer.Write(append(data, '\n'))
+	return err
+}
+
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s *WebhookSink) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", fmt.Sprint(event.ID))
+	response, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("%w: webhook responded %s", ErrDeliveryFailed, response.Status)
+	}
+	return nil
+}
+
+// PgqSink publishes events to pgq topic for consumers sharing the database.
+type PgqSink struct {
+	DB    *sql.DB
+	Topic string
+}
+
+func (s *PgqSink) Init() {
+	s.DB.Exec(schema.GenerateCreateTableQuery(s.Topic))
+}
+
+func (s *PgqSink) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	msg := &pgq.MessageOutgoing{Payload: data, Metadata: map[string]string{"type": string(event.Type), "login": event.Login}}
+	_, err = pgq.NewPublisher(s.DB).Publish(ctx, s.Topic, msg)
+	return err
+}
+
+func NewPgqSink(db *sql.DB, topic string) *PgqSink {
+	ret := &PgqSink{DB: db, Topic: topic}
+	ret.Init()
+	return ret
+}
+
+// MultiSink publishes event to every sink, event is retried on all of them if any fails
+// so sinks should tolerate duplicates.
+type MultiSink []Sink
+
+func (s MultiSink) Publish(ctx context.Context, event Event) error {
+	var errs []error
+	for _, sink := range s {
+		if err := sink.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseSink creates sink from "stdout", "file:<path>", "webhook:<url>" or "pgq:<topic>",
+// db is needed for pgq sink only and may be nil.
+func ParseSink(spec string, db *sql.DB) (Sink, error) {
+	kind, target, _ := strings.Cut(spec, ":")
+	switch {
+	case kind == "stdout":
+		return &WriterSink{Writer: os.Stdout}, nil
+	case kind == "file" && target != "":
+		file, err := os.OpenFile(target, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &WriterSink{Writer: file}, nil
+	case kind == "webhook" && target != "":
+		return &WebhookSink{URL: target, Client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case kind == "pgq" && target != "" && db != nil:
+		return NewPgqSink(db, target), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSink, spec)
+	}
+}
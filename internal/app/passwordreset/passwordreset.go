@@ -0,0 +1,67 @@
+// Package passwordreset lets users set new password without the old one by single-use
+// tokens sent to them by notifier, only hashes of tokens are stored.
+package passwordreset
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valinurovdenis/gomart/internal/app/pgdb"
+)
+
+type ResetToken struct {
+	Login string
+	// Hash is SHA-256 hash of the token sent to user.
+	Hash      string
+	ExpiresAt time.Time
+}
+
+var ErrInvalidToken = errors.New("invalid or expired reset token")
+
+//go:generate mockery --name ResetTokenStorage
+type ResetTokenStorage interface {
+	// AddResetToken replaces unused token of user.
+	AddResetToken(ctx context.Context, token ResetToken) error
+
+	// UseResetToken deletes token by its hash and returns its login,
+	// ErrInvalidToken if there is no such token or it expired before now.
+	UseResetToken(ctx context.Context, hash string, now time.Time) (string, error)
+}
+
+type DatabaseResetTokenStorage struct {
+	Pool *pgxpool.Pool
+}
+
+func (s *DatabaseResetTokenStorage) Init() error {
+	return pgdb.ExecBatch(context.Background(), s.Pool,
+		`CREATE TABLE IF NOT EXISTS password_resets("login" TEXT PRIMARY KEY, "hash" TEXT UNIQUE, "expires_at" TIMESTAMPTZ)`,
+	)
+}
+
+func (s *DatabaseResetTokenStorage) AddResetToken(ctx context.Context, token ResetToken) error {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx,
+		`INSERT INTO password_resets (login, hash, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (login) DO UPDATE SET hash=EXCLUDED.hash, expires_at=EXCLUDED.expires_at`,
+		token.Login, token.Hash, token.ExpiresAt)
+	return err
+}
+
+func (s *DatabaseResetTokenStorage) UseResetToken(ctx context.Context, hash string, now time.Time) (string, error) {
+	var login string
+	var expiresAt time.Time
+	err := pgdb.Conn(ctx, s.Pool).QueryRow(ctx,
+		"DELETE FROM password_resets WHERE hash=$1 RETURNING login, expires_at", hash).Scan(&login, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && !now.Before(expiresAt) {
+		return "", ErrInvalidToken
+	}
+	return login, err
+}
+
+func NewDatabaseResetTokenStorage(pool *pgxpool.Pool) *DatabaseResetTokenStorage {
+	ret := &DatabaseResetTokenStorage{Pool: pool}
+	ret.Init()
+	return ret
+}
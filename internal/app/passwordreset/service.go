@@ -0,0 +1,81 @@
+package passwordreset
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/notify"
+	"github.com/valinurovdenis/gomart/internal/app/txmanager"
+	"github.com/valinurovdenis/gomart/internal/app/userstorage"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+)
+
+const tokenBytes = 32
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ResetService issues reset tokens valid for Expiration and sets new passwords by them.
+type ResetService struct {
+	Storage    ResetTokenStorage
+	Users      userstorage.UserStorage
+	Notifier   notify.Notifier
+	TxManager  txmanager.TxManager
+	Clock      clock.Clock
+	Expiration time.Duration
+}
+
+// Request sends new reset token to user, unknown logins are ignored so that they are not told apart.
+func (s *ResetService) Request(ctx context.Context, login string) error {
+	_, err := s.Users.GetUserPassword(ctx, login)
+	if errors.Is(err, userstorage.ErrUserNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	random := make([]byte, tokenBytes)
+	if _, err = rand.Read(random); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+	expiresAt := s.Clock.Now().Add(s.Expiration)
+	if err = s.Storage.AddResetToken(ctx, ResetToken{Login: login, Hash: hashToken(token), ExpiresAt: expiresAt}); err != nil {
+		return err
+	}
+	return s.Notifier.Notify(ctx, notify.Message{
+		Login:   login,
+		Subject: "Password reset",
+		Text:    fmt.Sprintf("Use token %s to set new password before %s.", token, expiresAt.UTC().Format(time.RFC3339)),
+	})
+}
+
+// Reset sets new password of user the token was issued to and revokes the user's sessions.
+func (s *ResetService) Reset(ctx context.Context, token string, password string) (string, error) {
+	if err := validators.PasswordIsValid("new_password", password); err != nil {
+		return "", err
+	}
+	var login string
+	err := s.TxManager.Do(ctx, func(ctx context.Context) error {
+		var err error
+		login, err = s.Storage.UseResetToken(ctx, hashToken(token), s.Clock.Now())
+		if err != nil {
+			return err
+		}
+		return s.Users.SetPassword(ctx, login, password)
+	})
+	return login, err
+}
+
+func NewResetService(storage ResetTokenStorage, users userstorage.UserStorage, notifier notify.Notifier,
+	txManager txmanager.TxManager, clock clock.Clock, expiration time.Duration) *ResetService {
+	return &ResetService{Storage: storage, Users: users, Notifier: notifier, TxManager: txManager, Clock: clock, Expiration: expiration}
+}
@@ -0,0 +1,70 @@
+package passwordreset_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/memstorage"
+	"github.com/valinurovdenis/gomart/internal/app/notify"
+	"github.com/valinurovdenis/gomart/internal/app/passwordreset"
+	"github.com/valinurovdenis/gomart/internal/app/userstorage"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+)
+
+func TestResetService(t *testing.T) {
+	ctx := context.Background()
+	testClock := &clock.FixedClock{Time: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	storage := memstorage.NewMemoryStorage(testClock)
+	require.NoError(t, storage.AddUser(ctx, userstorage.LoginPassword{Login: "user", Password: "Passw0rd!"}))
+	var sent bytes.Buffer
+	service := passwordreset.NewResetService(storage, storage, &notify.WriterNotifier{Writer: &sent}, storage, testClock, 30*time.Minute)
+	request := func() string {
+		sent.Reset()
+		require.NoError(t, service.Request(ctx, "user"))
+		var message notify.Message
+		require.NoError(t, json.Unmarshal(sent.Bytes(), &message))
+		require.Equal(t, "user", message.Login)
+		require.Contains(t, message.Text, "2024-03-01T10:30:00Z")
+		return strings.Fields(message.Text)[2]
+	}
+
+	// unknown logins are not told apart but get nothing
+	require.NoError(t, service.Request(ctx, "nobody"))
+	require.Zero(t, sent.Len())
+
+	// new token replaces unused one, invalid password does not use token
+	replaced := request()
+	token := request()
+	_, err := service.Reset(ctx, replaced, "N3w-Passw0rd")
+	require.ErrorIs(t, err, passwordreset.ErrInvalidToken)
+	var validationErr *validators.ValidationError
+	_, err = service.Reset(ctx, token, "short")
+	require.ErrorAs(t, err, &validationErr)
+
+	version, err := storage.GetTokenVersion(ctx, "user")
+	require.NoError(t, err)
+	login, err := service.Reset(ctx, token, "N3w-Passw0rd")
+	require.NoError(t, err)
+	require.Equal(t, "user", login)
+	password, err := storage.GetUserPassword(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, "N3w-Passw0rd", password)
+	revoked, err := storage.GetTokenVersion(ctx, "user")
+	require.NoError(t, err)
+	require.NotEqual(t, version, revoked)
+
+	// tokens are single-use and expire
+	_, err = service.Reset(ctx, token, "An0ther-Passw0rd")
+	require.ErrorIs(t, err, passwordreset.ErrInvalidToken)
+	token = request()
+	testClock.Advance(30 * time.Minute)
+	_, err = service.Reset(ctx, token, "An0ther-Passw0rd")
+	require.ErrorIs(t, err, passwordreset.ErrInvalidToken)
+}
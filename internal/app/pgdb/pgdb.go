@@ -0,0 +1,155 @@
+package pgdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Querier is implemented by both *pgxpool.Pool and pgx.Tx.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+type PoolSettings struct {
+	URI             string
+	MaxConns        int
+	MinConns        int
+	MaxConnLifetime time.Duration
+}
+
+// NewPool connects pool caching prepared statements for every query it runs.
+func NewPool(ctx context.Context, settings PoolSettings) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(settings.URI)
+	if err != nil {
+		return nil, err
+	}
+	config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	if settings.MaxConns > 0 {
+		config.MaxConns = int32(settings.MaxConns)
+	}
+	if settings.MinConns > 0 {
+		config.MinConns = int32(settings.MinConns)
+	}
+	if settings.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = settings.MaxConnLifetime
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if err = pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+type txKey struct{}
+
+// Conn returns transaction started by WithTx or TxManager for the context or pool otherwise.
+func Conn(ctx context.Context, pool *pgxpool.Pool) Querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return pool
+}
+
+// WithTx runs fn in a transaction available to storages through Conn,
+// nested calls join the outer transaction.
+func WithTx(ctx context.Context, pool *pgxpool.Pool, fn func(ctx context.Context) error) error {
+	return beginTx(ctx, pool, pgx.TxOptions{}, fn)
+}
+
+func beginTx(ctx context.Context, pool *pgxpool.Pool, options pgx.TxOptions, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+	return pgx.BeginTxFunc(ctx, pool, options, func(tx pgx.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+var ErrUnknownIsolation = errors.New("unknown transaction isolation level")
+
+// ParseIsolation accepts isolation level as written in SQL, case insensitive.
+func ParseIsolation(level string) (pgx.TxIsoLevel, error) {
+	switch isolation := pgx.TxIsoLevel(strings.ToLower(strings.TrimSpace(level))); isolation {
+	case pgx.ReadCommitted, pgx.RepeatableRead, pgx.Serializable:
+		return isolation, nil
+	case "":
+		return pgx.ReadCommitted, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownIsolation, level)
+	}
+}
+
+const retryDelay = 10 * time.Millisecond
+
+// TxManager runs units of work at configured isolation retrying serialization failures and deadlocks.
+type TxManager struct {
+	Pool      *pgxpool.Pool
+	Isolation pgx.TxIsoLevel
+	Retries   int
+}
+
+func (m *TxManager) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	// only the outermost unit of work can be retried
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+	for attempt := 0; ; attempt++ {
+		err := beginTx(ctx, m.Pool, pgx.TxOptions{IsoLevel: m.Isolation}, fn)
+		if err == nil || attempt >= m.Retries || !isRetryable(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt+1) * retryDelay):
+		}
+	}
+}
+
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) &&
+		(pgErr.Code == pgerrcode.SerializationFailure || pgErr.Code == pgerrcode.DeadlockDetected)
+}
+
+func NewTxManager(pool *pgxpool.Pool, isolation pgx.TxIsoLevel, retries int) *TxManager {
+	return &TxManager{Pool: pool, Isolation: isolation, Retries: retries}
+}
+
+// ExecBatch queues all queries in one round trip and returns the first error.
+func ExecBatch(ctx context.Context, db Querier, queries ...string) error {
+	batch := &pgx.Batch{}
+	for _, query := range queries {
+		batch.Queue(query)
+	}
+	return db.SendBatch(ctx, batch).Close()
+}
+
+// AlterColumnType returns migration changing column to dataType unless it already has it,
+// dataType is spelled as in information_schema, e.g. "timestamp with time zone".
+func AlterColumnType(table string, column string, dataType string) string {
+	return fmt.Sprintf(`DO $$ BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_name='%[1]s' AND column_name='%[2]s' AND data_type <> '%[3]s') THEN
+			ALTER TABLE %[1]s ALTER COLUMN %[2]s TYPE %[3]s;
+		END IF;
+	END $$`, table, column, dataType)
+}
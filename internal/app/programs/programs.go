@@ -0,0 +1,149 @@
+package programs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+)
+
+const DefaultCode = "points"
+
+var ErrUnknownProgram = errors.New("unknown loyalty program")
+var ErrTooPrecise = errors.New("amount is more precise than loyalty program allows")
+var ErrInvalidSpec = errors.New("invalid loyalty programs spec")
+
+type ExpiryPolicy struct {
+	// Months after accrual when points expire, zero means points never expire.
+	Months int `json:"months,omitempty"`
+}
+
+func (p ExpiryPolicy) Expires() bool {
+	return p.Months > 0
+}
+
+func (p ExpiryPolicy) ExpiresAt(accrued time.Time) time.Time {
+	return accrued.AddDate(0, p.Months, 0)
+}
+
+// Cutoff returns the time before which accrued points are expired at now.
+func (p ExpiryPolicy) Cutoff(now time.Time) time.Time {
+	return now.AddDate(0, -p.Months, 0)
+}
+
+type Program struct {
+	Code      string       `json:"code"`
+	Name      string       `json:"name"`
+	Precision int          `json:"precision"`
+	Expiry    ExpiryPolicy `json:"expiry"`
+}
+
+func (p Program) step() int64 {
+	step := int64(1)
+	for range currencybalance.Precision - p.Precision {
+		step *= 10
+	}
+	return step
+}
+
+func (p Program) CheckPrecision(amount currencybalance.CurrencyBalance) error {
+	if amount.Balance%p.step() != 0 {
+		return fmt.Errorf("%w: %s allows %d decimal places", ErrTooPrecise, p.Code, p.Precision)
+	}
+	return nil
+}
+
+// Round truncates amount to program precision.
+func (p Program) Round(amount currencybalance.CurrencyBalance) currencybalance.CurrencyBalance {
+	return currencybalance.CurrencyBalance{Balance: amount.Balance - amount.Balance%p.step()}
+}
+
+type Registry struct {
+	programs    map[string]Program
+	defaultCode string
+}
+
+func NewRegistry(defaultCode string, programs ...Program) (*Registry, error) {
+	ret := &Registry{programs: make(map[string]Program, len(programs)), defaultCode: defaultCode}
+	for _, program := range programs {
+		if program.Code == "" || program.Precision < 0 || program.Precision > currencybalance.Precision {
+			return nil, fmt.Errorf("%w: program %q", ErrInvalidSpec, program.Code)
+		}
+		if program.Name == "" {
+			program.Name = program.Code
+		}
+		ret.programs[program.Code] = program
+	}
+	if _, ok := ret.programs[defaultCode]; !ok {
+		return nil, fmt.Errorf("%w: default program %q is not registered", ErrInvalidSpec, defaultCode)
+	}
+	return ret, nil
+}
+
+// ParseRegistry builds registry from spec "code:name:precision[:expiry months];..."
+// where the first program is the default one.
+func ParseRegistry(spec string) (*Registry, error) {
+	var programs []Program
+	for _, item := range strings.Split(spec, ";") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) < 3 || len(parts) > 4 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSpec, item)
+		}
+		precision, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSpec, item)
+		}
+		program := Program{Code: strings.TrimSpace(parts[0]), Name: parts[1], Precision: precision}
+		if len(parts) == 4 {
+			if program.Expiry.Months, err = strconv.Atoi(parts[3]); err != nil || program.Expiry.Months < 0 {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidSpec, item)
+			}
+		}
+		programs = append(programs, program)
+	}
+	if len(programs) == 0 {
+		return nil, fmt.Errorf("%w: no programs", ErrInvalidSpec)
+	}
+	return NewRegistry(programs[0].Code, programs...)
+}
+
+func (r *Registry) Get(code string) (Program, error) {
+	program, ok := r.programs[code]
+	if !ok {
+		return Program{}, fmt.Errorf("%w: %q", ErrUnknownProgram, code)
+	}
+	return program, nil
+}
+
+// Resolve returns program by code falling back to the default program for empty code.
+func (r *Registry) Resolve(code string) (Program, error) {
+	if code == "" {
+		code = r.defaultCode
+	}
+	return r.Get(code)
+}
+
+func (r *Registry) Default() Program {
+	return r.programs[r.defaultCode]
+}
+
+func (r *Registry) List() []Program {
+	res := make([]Program, 0, len(r.programs))
+	for _, program := range r.programs {
+		res = append(res, program)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if (res[i].Code == r.defaultCode) != (res[j].Code == r.defaultCode) {
+			return res[i].Code == r.defaultCode
+		}
+		return res[i].Code < res[j].Code
+	})
+	return res
+}
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valinurovdenis/gomart/internal/app/pgdb"
+)
+
+// DatabaseStore shares counters between replicas, windows of a key replace each other in single row.
+type DatabaseStore struct {
+	Pool *pgxpool.Pool
+	// takes since the last deletion of expired windows
+	takes atomic.Int64
+}
+
+func (s *DatabaseStore) Init() error {
+	return pgdb.ExecBatch(context.Background(), s.Pool,
+		`CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits("key" TEXT PRIMARY KEY, "window_start" TIMESTAMPTZ, "window_end" TIMESTAMPTZ, "count" INT)`,
+		`CREATE INDEX IF NOT EXISTS rate_limits_end_index ON rate_limits USING btree(window_end)`,
+	)
+}
+
+func (s *DatabaseStore) Take(ctx context.Context, key string, windowStart time.Time, period time.Duration) (int, error) {
+	if s.takes.Add(1)%sweepEvery == 0 {
+		if err := s.DeleteExpired(ctx, windowStart); err != nil {
+			return 0, err
+		}
+	}
+	var count int
+	err := pgdb.Conn(ctx, s.Pool).QueryRow(ctx,
+		`INSERT INTO rate_limits (key, window_start, window_end, count) VALUES ($1, $2, $3, 1)
+		ON CONFLICT (key) DO UPDATE SET
+			count = CASE WHEN rate_limits.window_start = EXCLUDED.window_start THEN rate_limits.count + 1 ELSE 1 END,
+			window_start = EXCLUDED.window_start, window_end = EXCLUDED.window_end
+		RETURNING count`,
+		key, windowStart, windowStart.Add(period)).Scan(&count)
+	return count, err
+}
+
+// DeleteExpired removes counters of windows ended before time.
+func (s *DatabaseStore) DeleteExpired(ctx context.Context, before time.Time) error {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, "DELETE FROM rate_limits WHERE window_end < $1", before)
+	return err
+}
+
+func NewDatabaseStore(pool *pgxpool.Pool) *DatabaseStore {
+	ret := &DatabaseStore{Pool: pool}
+	ret.Init()
+	return ret
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type window struct {
+	start time.Time
+	end   time.Time
+	count int
+}
+
+// MemoryStore counts requests of a single replica.
+type MemoryStore struct {
+	mu      sync.Mutex
+	windows map[string]window
+	// takes since the last sweep of expired windows
+	takes int
+}
+
+const sweepEvery = 1000
+
+func (s *MemoryStore) Take(ctx context.Context, key string, windowStart time.Time, period time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.takes++; s.takes >= sweepEvery {
+		s.takes = 0
+		for k, w := range s.windows {
+			if w.end.Before(windowStart) {
+				delete(s.windows, k)
+			}
+		}
+	}
+	w := s.windows[key]
+	if !w.start.Equal(windowStart) {
+		w = window{start: windowStart, end: windowStart.Add(period)}
+	}
+	w.count++
+	s.windows[key] = w
+	return w.count, nil
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{windows: map[string]window{}}
+}
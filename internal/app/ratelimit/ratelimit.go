@@ -0,0 +1,130 @@
+// Package ratelimit limits requests of every client to a route in fixed time windows.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/valinurovdenis/gomart/internal/app/auth"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/logger"
+)
+
+// Limit allows Requests in every Period.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+var ErrInvalidRule = errors.New("invalid rate limit rule")
+
+type Store interface {
+	// Take counts request of key in window started at windowStart and returns number of requests in the window.
+	Take(ctx context.Context, key string, windowStart time.Time, period time.Duration) (int, error)
+}
+
+// ParseRules parses rules as "<METHOD> <route>=<requests>/<period>" separated by ';',
+// e.g. "POST /api/user/login=10/1m", route "*" limits routes without own rule.
+func ParseRules(rules string) (map[string]Limit, error) {
+	res := map[string]Limit{}
+	for _, rule := range strings.Split(rules, ";") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		route, value, ok := strings.Cut(rule, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRule, rule)
+		}
+		requests, period, ok := strings.Cut(value, "/")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRule, rule)
+		}
+		limit := Limit{}
+		var err error
+		if limit.Requests, err = strconv.Atoi(strings.TrimSpace(requests)); err != nil || limit.Requests < 1 {
+			return nil, fmt.Errorf("%w: %q: requests must be a positive integer", ErrInvalidRule, rule)
+		}
+		if limit.Period, err = time.ParseDuration(strings.TrimSpace(period)); err != nil || limit.Period < time.Second {
+			return nil, fmt.Errorf("%w: %q: period must be a duration of at least 1s", ErrInvalidRule, rule)
+		}
+		res[strings.Join(strings.Fields(route), " ")] = limit
+	}
+	return res, nil
+}
+
+// Limiter rejects requests over limit of their route with 429. Authenticated requests are counted
+// by login and the others by client IP. Requests are let through if store fails.
+type Limiter struct {
+	Store Store
+	Rules map[string]Limit
+	Clock clock.Clock
+}
+
+// clientKey is login of authenticated request or IP of the connection.
+func clientKey(r *http.Request) string {
+	if login, ok := auth.LoginFromContext(r.Context()); ok {
+		return "login:" + login
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func (l *Limiter) rule(route string) (Limit, bool) {
+	if limit, ok := l.Rules[route]; ok {
+		return limit, true
+	}
+	limit, ok := l.Rules["*"]
+	return limit, ok
+}
+
+// Allow counts request of client to route and returns time to wait before the next one if limit is exceeded.
+func (l *Limiter) Allow(ctx context.Context, route string, client string) (time.Duration, error) {
+	limit, ok := l.rule(route)
+	if !ok {
+		return 0, nil
+	}
+	now := l.Clock.Now()
+	windowStart := now.Truncate(limit.Period)
+	count, err := l.Store.Take(ctx, route+" "+client, windowStart, limit.Period)
+	if err != nil {
+		return 0, err
+	}
+	if count <= limit.Requests {
+		return 0, nil
+	}
+	return windowStart.Add(limit.Period).Sub(now), nil
+}
+
+// Middleware limits requests of route returned by route function.
+func (l *Limiter) Middleware(route func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wait, err := l.Allow(r.Context(), route(r), clientKey(r))
+			if err != nil {
+				logger.Log.Error("rate limit store failed", zap.Error(err))
+			} else if wait > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func NewLimiter(store Store, rules map[string]Limit, clock clock.Clock) *Limiter {
+	return &Limiter{Store: store, Rules: rules, Clock: clock}
+}
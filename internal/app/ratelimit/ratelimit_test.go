@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/valinurovdenis/gomart/internal/app/auth"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("POST  /api/user/login=5/1m; *=100/10s;")
+	require.NoError(t, err)
+	require.Equal(t, map[string]Limit{
+		"POST /api/user/login": {Requests: 5, Period: time.Minute},
+		"*":                    {Requests: 100, Period: 10 * time.Second},
+	}, rules)
+
+	for _, invalid := range []string{"POST /login", "POST /login=5", "POST /login=0/1m", "POST /login=5/1ms", "POST /login=five/1m"} {
+		_, err = ParseRules(invalid)
+		require.ErrorIs(t, err, ErrInvalidRule, invalid)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	fixedClock := &clock.FixedClock{Time: time.Date(2024, 3, 1, 10, 0, 15, 0, time.UTC)}
+	limiter := NewLimiter(NewMemoryStore(), map[string]Limit{"login": {Requests: 2, Period: time.Minute}}, fixedClock)
+	handler := limiter.Middleware(func(r *http.Request) string { return r.URL.Path[1:] })(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	send := func(path string, remoteAddr string, login string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		r.RemoteAddr = remoteAddr
+		if login != "" {
+			r = r.WithContext(auth.ContextWithLogin(r.Context(), login))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, send("/login", "10.0.0.1:1000", "").Code)
+	// port is not a part of client
+	require.Equal(t, http.StatusOK, send("/login", "10.0.0.1:2000", "").Code)
+	w := send("/login", "10.0.0.1:3000", "")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "45", w.Header().Get("Retry-After"))
+
+	// other clients and routes without rule are not affected
+	require.Equal(t, http.StatusOK, send("/login", "10.0.0.2:1000", "").Code)
+	require.Equal(t, http.StatusOK, send("/orders", "10.0.0.1:1000", "").Code)
+
+	// authenticated requests are counted by login, not by address
+	require.Equal(t, http.StatusOK, send("/login", "10.0.0.1:1000", "user1").Code)
+	require.Equal(t, http.StatusOK, send("/login", "10.0.0.3:1000", "user1").Code)
+	require.Equal(t, http.StatusTooManyRequests, send("/login", "10.0.0.4:1000", "user1").Code)
+
+	// limit resets with the next window
+	fixedClock.Advance(45 * time.Second)
+	require.Equal(t, http.StatusOK, send("/login", "10.0.0.1:1000", "").Code)
+	require.Equal(t, http.StatusOK, send("/login", "10.0.0.1:1000", "user1").Code)
+}
@@ -0,0 +1,53 @@
+// Package rbac defines roles of users and service accounts and permissions routes require.
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+type Role string
+
+const (
+	User    Role = "user"
+	Support Role = "support"
+	Admin   Role = "admin"
+	// Service is role of service accounts only, it is not assigned to users.
+	Service Role = "service"
+)
+
+type Permission string
+
+const (
+	// OwnAccount lets identity use its own loyalty account.
+	OwnAccount         Permission = "account"
+	RecheckOrders      Permission = "orders:recheck"
+	ReverseWithdrawals Permission = "withdrawals:reverse"
+	UnlockUsers        Permission = "users:unlock"
+	// ManageAccess lets identity assign roles and manage service accounts.
+	ManageAccess Permission = "access:manage"
+)
+
+var permissions = map[Role][]Permission{
+	User:    {OwnAccount},
+	Support: {OwnAccount, RecheckOrders, UnlockUsers},
+	Admin:   {OwnAccount, RecheckOrders, ReverseWithdrawals, UnlockUsers, ManageAccess},
+	Service: {RecheckOrders, ReverseWithdrawals},
+}
+
+var ErrUnknownRole = errors.New("unknown role")
+
+func (r Role) Can(permission Permission) bool {
+	return slices.Contains(permissions[r], permission)
+}
+
+// ParseUserRole accepts roles assignable to users.
+func ParseUserRole(role string) (Role, error) {
+	switch parsed := Role(role); parsed {
+	case User, Support, Admin:
+		return parsed, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownRole, role)
+	}
+}
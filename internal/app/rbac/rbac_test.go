@@ -0,0 +1,58 @@
+package rbac_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/memstorage"
+	"github.com/valinurovdenis/gomart/internal/app/rbac"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+)
+
+func TestRole_Can(t *testing.T) {
+	require.True(t, rbac.User.Can(rbac.OwnAccount))
+	require.False(t, rbac.User.Can(rbac.UnlockUsers))
+	require.True(t, rbac.Support.Can(rbac.UnlockUsers))
+	require.False(t, rbac.Support.Can(rbac.ReverseWithdrawals))
+	require.True(t, rbac.Admin.Can(rbac.ManageAccess))
+	require.True(t, rbac.Service.Can(rbac.RecheckOrders))
+	require.False(t, rbac.Service.Can(rbac.OwnAccount))
+	require.False(t, rbac.Role("").Can(rbac.OwnAccount))
+
+	role, err := rbac.ParseUserRole("support")
+	require.NoError(t, err)
+	require.Equal(t, rbac.Support, role)
+	_, err = rbac.ParseUserRole("service")
+	require.ErrorIs(t, err, rbac.ErrUnknownRole)
+}
+
+func TestServiceAccountService(t *testing.T) {
+	ctx := context.Background()
+	testClock := &clock.FixedClock{Time: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	service := rbac.NewServiceAccountService(memstorage.NewMemoryStorage(testClock), testClock)
+
+	_, _, err := service.Create(ctx, "ab")
+	var validationErr *validators.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	account, key, err := service.Create(ctx, "reconciler")
+	require.NoError(t, err)
+	require.Equal(t, testClock.Now(), account.Created)
+	require.NotContains(t, account.KeyHash, key)
+	_, _, err = service.Create(ctx, "reconciler")
+	require.ErrorIs(t, err, rbac.ErrServiceAccountExists)
+
+	authenticated, err := service.Authenticate(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, "reconciler", authenticated.Name)
+	_, err = service.Authenticate(ctx, key+"x")
+	require.ErrorIs(t, err, rbac.ErrServiceAccountNotFound)
+
+	require.NoError(t, service.Delete(ctx, "reconciler"))
+	require.ErrorIs(t, service.Delete(ctx, "reconciler"), rbac.ErrServiceAccountNotFound)
+	_, err = service.Authenticate(ctx, key)
+	require.ErrorIs(t, err, rbac.ErrServiceAccountNotFound)
+}
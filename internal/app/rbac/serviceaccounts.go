@@ -0,0 +1,149 @@
+package rbac
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/pgdb"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+)
+
+const (
+	keyPrefix = "gms_"
+	keyBytes  = 32
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{2,31}$`)
+
+// ServiceAccount authenticates machine clients by API key with Service role, only hash of the key is stored.
+type ServiceAccount struct {
+	Name    string    `json:"name"`
+	KeyHash string    `json:"-"`
+	Created time.Time `json:"created_at"`
+}
+
+var ErrServiceAccountExists = errors.New("service account exists")
+var ErrServiceAccountNotFound = errors.New("service account not found")
+
+//go:generate mockery --name ServiceAccountStorage
+type ServiceAccountStorage interface {
+	// AddServiceAccount returns ErrServiceAccountExists if account of the name exists.
+	AddServiceAccount(ctx context.Context, account ServiceAccount) error
+
+	GetServiceAccountByKey(ctx context.Context, keyHash string) (ServiceAccount, error)
+
+	GetServiceAccounts(ctx context.Context) ([]ServiceAccount, error)
+
+	DeleteServiceAccount(ctx context.Context, name string) error
+}
+
+type DatabaseServiceAccountStorage struct {
+	Pool *pgxpool.Pool
+}
+
+func (s *DatabaseServiceAccountStorage) Init() error {
+	return pgdb.ExecBatch(context.Background(), s.Pool,
+		`CREATE TABLE IF NOT EXISTS service_accounts("name" TEXT PRIMARY KEY, "key_hash" TEXT UNIQUE, "created" TIMESTAMPTZ)`,
+	)
+}
+
+func (s *DatabaseServiceAccountStorage) AddServiceAccount(ctx context.Context, account ServiceAccount) error {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, "INSERT INTO service_accounts (name, key_hash, created) VALUES ($1, $2, $3)",
+		account.Name, account.KeyHash, account.Created)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		err = ErrServiceAccountExists
+	}
+	return err
+}
+
+func (s *DatabaseServiceAccountStorage) GetServiceAccountByKey(ctx context.Context, keyHash string) (ServiceAccount, error) {
+	account := ServiceAccount{KeyHash: keyHash}
+	err := pgdb.Conn(ctx, s.Pool).QueryRow(ctx, "SELECT name, created FROM service_accounts WHERE key_hash=$1", keyHash).
+		Scan(&account.Name, &account.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ServiceAccount{}, ErrServiceAccountNotFound
+	}
+	return account, err
+}
+
+func (s *DatabaseServiceAccountStorage) GetServiceAccounts(ctx context.Context) ([]ServiceAccount, error) {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx, "SELECT name, key_hash, created FROM service_accounts ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (ServiceAccount, error) {
+		var account ServiceAccount
+		err := row.Scan(&account.Name, &account.KeyHash, &account.Created)
+		return account, err
+	})
+}
+
+func (s *DatabaseServiceAccountStorage) DeleteServiceAccount(ctx context.Context, name string) error {
+	tag, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, "DELETE FROM service_accounts WHERE name=$1", name)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrServiceAccountNotFound
+	}
+	return err
+}
+
+func NewDatabaseServiceAccountStorage(pool *pgxpool.Pool) *DatabaseServiceAccountStorage {
+	ret := &DatabaseServiceAccountStorage{Pool: pool}
+	ret.Init()
+	return ret
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+type ServiceAccountService struct {
+	Storage ServiceAccountStorage
+	Clock   clock.Clock
+}
+
+// Create adds service account and returns its API key, the key is shown only once.
+func (s *ServiceAccountService) Create(ctx context.Context, name string) (ServiceAccount, string, error) {
+	if !namePattern.MatchString(name) {
+		return ServiceAccount{}, "", validators.NewFieldError("name", "must be 3 to 32 lowercase letters, digits or dashes")
+	}
+	random := make([]byte, keyBytes)
+	if _, err := rand.Read(random); err != nil {
+		return ServiceAccount{}, "", err
+	}
+	key := keyPrefix + base64.RawURLEncoding.EncodeToString(random)
+	account := ServiceAccount{Name: name, KeyHash: hashKey(key), Created: s.Clock.Now()}
+	if err := s.Storage.AddServiceAccount(ctx, account); err != nil {
+		return ServiceAccount{}, "", err
+	}
+	return account, key, nil
+}
+
+// Authenticate returns service account of API key.
+func (s *ServiceAccountService) Authenticate(ctx context.Context, key string) (ServiceAccount, error) {
+	return s.Storage.GetServiceAccountByKey(ctx, hashKey(key))
+}
+
+func (s *ServiceAccountService) List(ctx context.Context) ([]ServiceAccount, error) {
+	return s.Storage.GetServiceAccounts(ctx)
+}
+
+func (s *ServiceAccountService) Delete(ctx context.Context, name string) error {
+	return s.Storage.DeleteServiceAccount(ctx, name)
+}
+
+func NewServiceAccountService(storage ServiceAccountStorage, clock clock.Clock) *ServiceAccountService {
+	return &ServiceAccountService{Storage: storage, Clock: clock}
+}
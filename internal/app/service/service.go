@@ -3,18 +3,64 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/valinurovdenis/gomart/internal/app/accrualorder"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
 	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
 	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/programs"
+	"github.com/valinurovdenis/gomart/internal/app/statement"
+	"github.com/valinurovdenis/gomart/internal/app/twofactor"
 	"github.com/valinurovdenis/gomart/internal/app/userstorage"
 	"github.com/valinurovdenis/gomart/internal/app/validators"
 	"github.com/valinurovdenis/gomart/internal/app/withdrawstorage"
 )
 
+type Settings struct {
+	Programs *programs.Registry
+	Clock    clock.Clock
+	// ExpiringSoon is how far ahead expiring points are reported in balance.
+	ExpiringSoon time.Duration
+	History      statement.HistoryStorage
+	// TwoFactor requires fresh confirmation of withdrawals above ConfirmWithdrawAbove hundredths of points, optional
+	TwoFactor            *twofactor.TwoFactorService
+	ConfirmWithdrawAbove int64
+}
+
 type OrderService struct {
-	AccrualOrderService accrualorder.AccrualOrderService
-	OrderServiceStorage ServiceStorage
+	AccrualOrderService  accrualorder.AccrualOrderService
+	OrderServiceStorage  ServiceStorage
+	Programs             *programs.Registry
+	Clock                clock.Clock
+	ExpiringSoon         time.Duration
+	History              statement.HistoryStorage
+	TwoFactor            *twofactor.TwoFactorService
+	ConfirmWithdrawAbove int64
+}
+
+type ProgramBalance struct {
+	Program   string                          `json:"program"`
+	Name      string                          `json:"name"`
+	Current   currencybalance.CurrencyBalance `json:"current"`
+	Withdrawn currencybalance.CurrencyBalance `json:"withdrawn"`
+}
+
+type ExpiringPoints struct {
+	Program   string                          `json:"program"`
+	Amount    currencybalance.CurrencyBalance `json:"amount"`
+	ExpiresAt time.Time                       `json:"expires_at"`
+}
+
+// UserBalances keeps default program balance on top level for clients unaware of programs.
+type UserBalances struct {
+	Current      currencybalance.CurrencyBalance `json:"current"`
+	Withdrawn    currencybalance.CurrencyBalance `json:"withdrawn"`
+	Programs     []ProgramBalance                `json:"programs"`
+	ExpiringSoon []ExpiringPoints                `json:"expiring_soon"`
 }
 
 func (s *OrderService) AddUserOrder(context context.Context, login string, number string) error {
@@ -25,9 +71,11 @@ func (s *OrderService) AddUserOrder(context context.Context, login string, numbe
 	if err != nil {
 		return err
 	}
-	var balance currencybalance.CurrencyBalance
-	balance.SetFloat(order.Accrual)
-	userOrder := orderstorage.UserOrder{Login: login, Number: number, Status: order.Status, Balance: balance}
+	balance, err := order.AccrualBalance()
+	if err != nil {
+		return err
+	}
+	userOrder := orderstorage.UserOrder{Login: login, Number: number, Program: order.Program, Status: order.Status, Balance: balance}
 	err = s.OrderServiceStorage.AddUserOrder(context, userOrder)
 	if err == nil && !orderstorage.IsFinal(userOrder.Status) {
 		err = s.AccrualOrderService.EnqueueOrderUpdate(context, login, number)
@@ -35,40 +83,223 @@ func (s *OrderService) AddUserOrder(context context.Context, login string, numbe
 	return err
 }
 
+type BatchStatus string
+
+const (
+	BatchAccepted    BatchStatus = "accepted"
+	BatchAlreadySent BatchStatus = "already_sent"
+	BatchConflict    BatchStatus = "conflict"
+	BatchInvalid     BatchStatus = "invalid"
+)
+
+type BatchOrderResult struct {
+	Number string      `json:"number"`
+	Status BatchStatus `json:"status"`
+}
+
+// AddUserOrders stores valid orders as new without asking accrual service, which checks them
+// from the queue, and returns result of every number in the order of input. Orders are stored
+// only if their checks are queued so that a failed upload can be retried.
+func (s *OrderService) AddUserOrders(ctx context.Context, login string, numbers []string) ([]BatchOrderResult, error) {
+	results := make([]BatchOrderResult, len(numbers))
+	var orders []orderstorage.UserOrder
+	var indexes []int
+	seen := make(map[string]bool, len(numbers))
+	for i, number := range numbers {
+		results[i].Number = number
+		if validators.OrderIsValid(number) != nil {
+			results[i].Status = BatchInvalid
+		} else if seen[number] {
+			results[i].Status = BatchAlreadySent
+		} else {
+			seen[number] = true
+			orders = append(orders, orderstorage.UserOrder{Login: login, Number: number, Status: orderstorage.New})
+			indexes = append(indexes, i)
+		}
+	}
+	if len(orders) == 0 {
+		return results, nil
+	}
+
+	stored, err := s.OrderServiceStorage.AddUserOrders(ctx, orders, func(ctx context.Context, numbers []string) error {
+		return s.AccrualOrderService.EnqueueNewOrders(ctx, login, numbers)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for j, err := range stored {
+		i := indexes[j]
+		if errors.Is(err, orderstorage.ErrAlreadySent) {
+			results[i].Status = BatchAlreadySent
+		} else if errors.Is(err, orderstorage.ErrOrderExists) {
+			results[i].Status = BatchConflict
+		} else {
+			results[i].Status = BatchAccepted
+		}
+	}
+	return results, nil
+}
+
 func (s *OrderService) GetUserOrders(context context.Context, login string) ([]orderstorage.UserOrder, error) {
 	return s.OrderServiceStorage.GetUserOrders(context, login)
 }
 
-func (s *OrderService) GetUserBalance(context context.Context, login string) (userstorage.UserBalance, error) {
-	return s.OrderServiceStorage.GetBalance(context, login)
+func (s *OrderService) GetUserBalance(context context.Context, login string) (UserBalances, error) {
+	balances, err := s.OrderServiceStorage.GetBalances(context, login)
+	if err != nil {
+		return UserBalances{}, err
+	}
+	res := s.userBalances(balances)
+	res.ExpiringSoon, err = s.getExpiringSoon(context, login)
+	return res, err
+}
+
+// GetUserBalanceAt returns balance as of time computed from history, expiring points are not reported.
+func (s *OrderService) GetUserBalanceAt(ctx context.Context, login string, at time.Time) (UserBalances, error) {
+	balances, err := s.History.GetBalancesAt(ctx, login, at)
+	if err != nil {
+		return UserBalances{}, err
+	}
+	res := s.userBalances(balances)
+	res.ExpiringSoon = []ExpiringPoints{}
+	return res, nil
+}
+
+const maxHistoryDays = 366
+
+// GetBalanceHistory returns daily balances from first to last day inclusive.
+func (s *OrderService) GetBalanceHistory(ctx context.Context, login string, first time.Time, last time.Time) ([]statement.BalancePoint, error) {
+	if last.Before(first) {
+		return nil, validators.NewFieldError("to", "must not be before from")
+	}
+	if last.Sub(first) >= maxHistoryDays*24*time.Hour {
+		return nil, validators.NewFieldError("from", fmt.Sprintf("period must not exceed %d days", maxHistoryDays))
+	}
+	return s.History.GetDailyBalances(ctx, login, first, last)
+}
+
+func (s *OrderService) userBalances(balances []userstorage.UserBalance) UserBalances {
+	byProgram := make(map[string]userstorage.UserBalance, len(balances))
+	for _, balance := range balances {
+		byProgram[balance.Program] = balance
+	}
+
+	var res UserBalances
+	for _, program := range s.Programs.List() {
+		balance := byProgram[program.Code]
+		res.Programs = append(res.Programs, ProgramBalance{
+			Program:   program.Code,
+			Name:      program.Name,
+			Current:   balance.Current,
+			Withdrawn: balance.Withdrawn,
+		})
+	}
+	defaultBalance := byProgram[s.Programs.Default().Code]
+	res.Current, res.Withdrawn = defaultBalance.Current, defaultBalance.Withdrawn
+	return res
+}
+
+func (s *OrderService) getExpiringSoon(context context.Context, login string) ([]ExpiringPoints, error) {
+	res := []ExpiringPoints{}
+	horizon := s.Clock.Now().Add(s.ExpiringSoon)
+	for _, program := range s.Programs.List() {
+		if !program.Expiry.Expires() {
+			continue
+		}
+		lots, err := s.OrderServiceStorage.GetActiveLots(context, login, program.Code, program.Expiry.Cutoff(horizon))
+		if err != nil {
+			return nil, err
+		}
+		for _, lot := range lots {
+			res = append(res, ExpiringPoints{
+				Program:   program.Code,
+				Amount:    lot.Remaining,
+				ExpiresAt: program.Expiry.ExpiresAt(lot.Accrued),
+			})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].ExpiresAt.Before(res[j].ExpiresAt) })
+	return res, nil
 }
 
 var ErrNotEnoughBalance = errors.New("not enough balance for withdraw")
+var ErrNegativeBalance = errors.New("withdrawals are blocked until clawed back balance is positive")
+var ErrOrderNotFinal = errors.New("order accrual is not final yet")
 
 func (s *OrderService) AddUserWithdraw(context context.Context, withdraw withdrawstorage.UserWithdraw) error {
 	if err := validators.OrderIsValid(withdraw.Number); err != nil {
 		return err
 	}
-	userBalance, err := s.OrderServiceStorage.GetBalance(context, withdraw.Login)
+	program, err := s.Programs.Resolve(withdraw.Program)
 	if err != nil {
 		return err
 	}
-	if userBalance.Current.Less(withdraw.Withdraw) {
-		return ErrNotEnoughBalance
+	if err = program.CheckPrecision(withdraw.Withdraw); err != nil {
+		return err
+	}
+	withdraw.Program = program.Code
+	if s.TwoFactor != nil && s.ConfirmWithdrawAbove > 0 && withdraw.Withdraw.Balance > s.ConfirmWithdrawAbove {
+		if err = s.TwoFactor.RequireConfirmation(context, withdraw.Login); err != nil {
+			return err
+		}
 	}
-	err = s.OrderServiceStorage.AddUserWithdraw(context, withdraw)
-	return err
+	return s.OrderServiceStorage.AddUserWithdraw(context, withdraw)
 }
 
 func (s *OrderService) GetUserWithdrawals(context context.Context, login string) ([]withdrawstorage.UserWithdraw, error) {
 	return s.OrderServiceStorage.GetUserWithdrawals(context, login)
 }
 
-func NewOrderService(serviceStorage ServiceStorage, accrualOrderService accrualorder.AccrualOrderService) *OrderService {
+// RecheckOrder fetches order from accrual system again and applies corrections of final accrual.
+func (s *OrderService) RecheckOrder(context context.Context, number string) (orderstorage.UserOrder, error) {
+	userOrder, err := s.OrderServiceStorage.GetOrder(context, number)
+	if err != nil {
+		return orderstorage.UserOrder{}, err
+	}
+	order, err := s.AccrualOrderService.GetOrder(context, number)
+	if err != nil {
+		return orderstorage.UserOrder{}, err
+	}
+	if !orderstorage.IsFinal(order.Status) {
+		return orderstorage.UserOrder{}, ErrOrderNotFinal
+	}
+	balance, err := order.AccrualBalance()
+	if err != nil {
+		return orderstorage.UserOrder{}, err
+	}
+	userOrder.Program, userOrder.Status, userOrder.Balance = order.Program, order.Status, balance
+	if err = s.OrderServiceStorage.UpdateOrderAccrual(context, userOrder); err != nil {
+		return orderstorage.UserOrder{}, err
+	}
+	return s.OrderServiceStorage.GetOrder(context, number)
+}
+
+func (s *OrderService) GetUserAdjustments(context context.Context, login string) ([]orderstorage.Adjustment, error) {
+	return s.OrderServiceStorage.GetUserAdjustments(context, login)
+}
+
+const maxReverseReasonLength = 512
+
+// ReverseWithdraw refunds withdrawn points when the shop cancels the order paid with them.
+func (s *OrderService) ReverseWithdraw(context context.Context, id int64, reason string) (withdrawstorage.UserWithdraw, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len(reason) > maxReverseReasonLength {
+		return withdrawstorage.UserWithdraw{}, validators.NewFieldError("reason", fmt.Sprintf("must be between 1 and %d characters", maxReverseReasonLength))
+	}
+	return s.OrderServiceStorage.ReverseUserWithdraw(context, id, reason, s.Programs.Default().Code)
+}
+
+func NewOrderService(serviceStorage ServiceStorage, accrualOrderService accrualorder.AccrualOrderService, settings Settings) *OrderService {
 
 	ret := &OrderService{
-		OrderServiceStorage: serviceStorage,
-		AccrualOrderService: accrualOrderService,
+		OrderServiceStorage:  serviceStorage,
+		AccrualOrderService:  accrualOrderService,
+		Programs:             settings.Programs,
+		Clock:                settings.Clock,
+		ExpiringSoon:         settings.ExpiringSoon,
+		History:              settings.History,
+		TwoFactor:            settings.TwoFactor,
+		ConfirmWithdrawAbove: settings.ConfirmWithdrawAbove,
 	}
 	return ret
 }
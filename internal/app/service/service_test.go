@@ -5,14 +5,26 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/valinurovdenis/gomart/internal/app/accrualorder"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
 	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/lotstorage"
 	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/programs"
+	"github.com/valinurovdenis/gomart/internal/app/userstorage"
 	"github.com/valinurovdenis/gomart/internal/app/validators"
+	"github.com/valinurovdenis/gomart/internal/app/withdrawstorage"
 	"github.com/valinurovdenis/gomart/mocks"
 )
 
+func testRegistry(t *testing.T) *programs.Registry {
+	registry, err := programs.ParseRegistry("points:Gophermart points:2;miles:Gopher miles:0")
+	require.NoError(t, err)
+	return registry
+}
+
 func TestOrderService_AddUserOrder(t *testing.T) {
 	ctx := context.Background()
 	mockStorage := mocks.NewServiceStorage(t)
@@ -23,22 +35,22 @@ func TestOrderService_AddUserOrder(t *testing.T) {
 	mockService.On("GetOrder", ctx, "79927398705").Return(accrualorder.AccrualOrder{}, accrualorder.ErrNoAnswer).Once()
 
 	// invalid order
-	invalidAccrualOrder := accrualorder.AccrualOrder{Order: "79927398721", Status: orderstorage.Invalid, Accrual: 5.}
+	invalidAccrualOrder := accrualorder.AccrualOrder{Order: "79927398721", Status: orderstorage.Invalid, Accrual: "5"}
 	mockService.On("GetOrder", ctx, "79927398721").Return(invalidAccrualOrder, nil).Once()
-	mockStorage.On("AddUserOrder", ctx, orderstorage.UserOrder{"a", "79927398721", orderstorage.Invalid, currencybalance.CurrencyBalance{500}, time.Time{}}).Return(nil).Once()
+	mockStorage.On("AddUserOrder", ctx, orderstorage.UserOrder{Login: "a", Number: "79927398721", Status: orderstorage.Invalid, Balance: currencybalance.CurrencyBalance{Balance: 500}}).Return(nil).Once()
 
 	// processed order
-	processedAccrualOrder := accrualorder.AccrualOrder{Order: "79927398739", Status: orderstorage.Processed, Accrual: 5}
+	processedAccrualOrder := accrualorder.AccrualOrder{Order: "79927398739", Status: orderstorage.Processed, Accrual: "5"}
 	mockService.On("GetOrder", ctx, "79927398739").Return(processedAccrualOrder, nil).Once()
-	mockStorage.On("AddUserOrder", ctx, orderstorage.UserOrder{"a", "79927398739", orderstorage.Processed, currencybalance.CurrencyBalance{500}, time.Time{}}).Return(nil).Once()
+	mockStorage.On("AddUserOrder", ctx, orderstorage.UserOrder{Login: "a", Number: "79927398739", Status: orderstorage.Processed, Balance: currencybalance.CurrencyBalance{Balance: 500}}).Return(nil).Once()
 
 	// processing order
-	processingAccrualOrder := accrualorder.AccrualOrder{Order: "79927398747", Status: orderstorage.Processing, Accrual: 5}
+	processingAccrualOrder := accrualorder.AccrualOrder{Order: "79927398747", Status: orderstorage.Processing, Accrual: "5"}
 	mockService.On("GetOrder", ctx, "79927398747").Return(processingAccrualOrder, nil).Once()
-	mockStorage.On("AddUserOrder", ctx, orderstorage.UserOrder{"a", "79927398747", orderstorage.Processing, currencybalance.CurrencyBalance{500}, time.Time{}}).Return(nil).Once()
+	mockStorage.On("AddUserOrder", ctx, orderstorage.UserOrder{Login: "a", Number: "79927398747", Status: orderstorage.Processing, Balance: currencybalance.CurrencyBalance{Balance: 500}}).Return(nil).Once()
 	mockService.On("EnqueueOrderUpdate", ctx, "a", "79927398747").Return(nil).Once()
 
-	service := NewOrderService(mockStorage, mockService)
+	service := NewOrderService(mockStorage, mockService, Settings{Programs: testRegistry(t), Clock: &clock.FixedClock{}})
 	tests := []struct {
 		name   string
 		login  string
@@ -61,3 +73,175 @@ func TestOrderService_AddUserOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestOrderService_AddUserOrders(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := mocks.NewServiceStorage(t)
+	mockService := mocks.NewAccrualOrderService(t)
+
+	newOrder := func(number string) orderstorage.UserOrder {
+		return orderstorage.UserOrder{Login: "a", Number: number, Status: orderstorage.New}
+	}
+	mockStorage.On("AddUserOrders", ctx, []orderstorage.UserOrder{newOrder("79927398713"), newOrder("79927398721"), newOrder("79927398739")}, mock.Anything).
+		Run(func(args mock.Arguments) {
+			enqueue := args.Get(2).(func(context.Context, []string) error)
+			require.NoError(t, enqueue(ctx, []string{"79927398713"}))
+		}).
+		Return([]error{nil, orderstorage.ErrAlreadySent, orderstorage.ErrOrderExists}, nil).Once()
+	mockService.On("EnqueueNewOrders", ctx, "a", []string{"79927398713"}).Return(nil).Once()
+
+	service := NewOrderService(mockStorage, mockService, Settings{Programs: testRegistry(t), Clock: &clock.FixedClock{}})
+	results, err := service.AddUserOrders(ctx, "a", []string{"79927398713", "79927398712", "79927398721", "79927398739", "79927398713"})
+	require.NoError(t, err)
+	require.Equal(t, []BatchOrderResult{
+		{Number: "79927398713", Status: BatchAccepted},
+		{Number: "79927398712", Status: BatchInvalid},
+		{Number: "79927398721", Status: BatchAlreadySent},
+		{Number: "79927398739", Status: BatchConflict},
+		{Number: "79927398713", Status: BatchAlreadySent},
+	}, results)
+}
+
+func TestOrderService_GetUserBalance(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := mocks.NewServiceStorage(t)
+	mockService := mocks.NewAccrualOrderService(t)
+
+	mockStorage.On("GetBalances", ctx, "a").Return([]userstorage.UserBalance{
+		{Program: "miles", Current: currencybalance.CurrencyBalance{Balance: 300}},
+		{Program: "points", Current: currencybalance.CurrencyBalance{Balance: 50050}, Withdrawn: currencybalance.CurrencyBalance{Balance: 4200}},
+	}, nil).Once()
+
+	service := NewOrderService(mockStorage, mockService, Settings{Programs: testRegistry(t), Clock: &clock.FixedClock{}})
+	balance, err := service.GetUserBalance(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, int64(50050), balance.Current.Balance)
+	require.Equal(t, int64(4200), balance.Withdrawn.Balance)
+	require.Equal(t, []ProgramBalance{
+		{Program: "points", Name: "Gophermart points", Current: currencybalance.CurrencyBalance{Balance: 50050}, Withdrawn: currencybalance.CurrencyBalance{Balance: 4200}},
+		{Program: "miles", Name: "Gopher miles", Current: currencybalance.CurrencyBalance{Balance: 300}},
+	}, balance.Programs)
+	require.Empty(t, balance.ExpiringSoon)
+}
+
+func TestOrderService_GetUserBalanceExpiringSoon(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := mocks.NewServiceStorage(t)
+	mockService := mocks.NewAccrualOrderService(t)
+	registry, err := programs.ParseRegistry("points:Gophermart points:2:12;miles:Gopher miles:0")
+	require.NoError(t, err)
+	now := time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+	mockStorage.On("GetBalances", ctx, "a").Return([]userstorage.UserBalance{
+		{Program: "points", Current: currencybalance.CurrencyBalance{Balance: 1000}},
+	}, nil).Once()
+	// lots accrued before June 15 2023 + 30 days expire within the window
+	accruedBefore := time.Date(2023, time.July, 15, 12, 0, 0, 0, time.UTC)
+	mockStorage.On("GetActiveLots", ctx, "a", "points", accruedBefore).Return([]lotstorage.AccrualLot{
+		{Program: "points", Remaining: currencybalance.CurrencyBalance{Balance: 300}, Accrued: time.Date(2023, time.June, 20, 0, 0, 0, 0, time.UTC)},
+		{Program: "points", Remaining: currencybalance.CurrencyBalance{Balance: 200}, Accrued: time.Date(2023, time.July, 1, 0, 0, 0, 0, time.UTC)},
+	}, nil).Once()
+
+	service := NewOrderService(mockStorage, mockService, Settings{Programs: registry, Clock: &clock.FixedClock{Time: now}, ExpiringSoon: 30 * 24 * time.Hour})
+	balance, err := service.GetUserBalance(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, []ExpiringPoints{
+		{Program: "points", Amount: currencybalance.CurrencyBalance{Balance: 300}, ExpiresAt: time.Date(2024, time.June, 20, 0, 0, 0, 0, time.UTC)},
+		{Program: "points", Amount: currencybalance.CurrencyBalance{Balance: 200}, ExpiresAt: time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC)},
+	}, balance.ExpiringSoon)
+}
+
+func TestOrderService_AddUserWithdraw(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := mocks.NewServiceStorage(t)
+	mockService := mocks.NewAccrualOrderService(t)
+
+	mockStorage.On("AddUserWithdraw", ctx, withdrawstorage.UserWithdraw{Login: "a", Number: "79927398713", Program: "points", Withdraw: currencybalance.CurrencyBalance{Balance: 550}}).Return(nil).Once()
+	mockStorage.On("AddUserWithdraw", ctx, withdrawstorage.UserWithdraw{Login: "a", Number: "79927398713", Program: "miles", Withdraw: currencybalance.CurrencyBalance{Balance: 500}}).Return(nil).Once()
+	mockStorage.On("AddUserWithdraw", ctx, withdrawstorage.UserWithdraw{Login: "b", Number: "79927398713", Program: "points", Withdraw: currencybalance.CurrencyBalance{Balance: 1}}).Return(ErrNegativeBalance).Once()
+	mockStorage.On("AddUserWithdraw", ctx, withdrawstorage.UserWithdraw{Login: "a", Number: "79927398713", Program: "points", Withdraw: currencybalance.CurrencyBalance{Balance: 1001}}).Return(ErrNotEnoughBalance).Once()
+
+	service := NewOrderService(mockStorage, mockService, Settings{Programs: testRegistry(t), Clock: &clock.FixedClock{}})
+	tests := []struct {
+		name    string
+		login   string
+		program string
+		sum     int64
+		err     error
+	}{
+		{name: "default program", program: "", sum: 550, err: nil},
+		{name: "negative balance after clawback", login: "b", program: "points", sum: 1, err: ErrNegativeBalance},
+		{name: "explicit program", program: "miles", sum: 500, err: nil},
+		{name: "not enough balance", program: "points", sum: 1001, err: ErrNotEnoughBalance},
+		{name: "unknown program", program: "stars", sum: 100, err: programs.ErrUnknownProgram},
+		{name: "too precise for program", program: "miles", sum: 550, err: programs.ErrTooPrecise},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login := tt.login
+			if login == "" {
+				login = "a"
+			}
+			withdraw := withdrawstorage.UserWithdraw{Login: login, Number: "79927398713", Program: tt.program, Withdraw: currencybalance.CurrencyBalance{Balance: tt.sum}}
+			err := service.AddUserWithdraw(ctx, withdraw)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestOrderService_ReverseWithdraw(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := mocks.NewServiceStorage(t)
+	mockService := mocks.NewAccrualOrderService(t)
+
+	reversed := withdrawstorage.UserWithdraw{ID: 1, Login: "a", Status: withdrawstorage.Reversed, ReverseReason: "order cancelled"}
+	mockStorage.On("ReverseUserWithdraw", ctx, int64(1), "order cancelled", "points").Return(reversed, nil).Once()
+	mockStorage.On("ReverseUserWithdraw", ctx, int64(2), "order cancelled", "points").Return(withdrawstorage.UserWithdraw{}, withdrawstorage.ErrAlreadyReversed).Once()
+
+	service := NewOrderService(mockStorage, mockService, Settings{Programs: testRegistry(t), Clock: &clock.FixedClock{}})
+
+	withdraw, err := service.ReverseWithdraw(ctx, 1, "  order cancelled ")
+	require.NoError(t, err)
+	require.Equal(t, reversed, withdraw)
+
+	_, err = service.ReverseWithdraw(ctx, 2, "order cancelled")
+	require.ErrorIs(t, err, withdrawstorage.ErrAlreadyReversed)
+
+	var validationErr *validators.ValidationError
+	_, err = service.ReverseWithdraw(ctx, 3, " ")
+	require.ErrorAs(t, err, &validationErr)
+}
+
+func TestOrderService_RecheckOrder(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := mocks.NewServiceStorage(t)
+	mockService := mocks.NewAccrualOrderService(t)
+
+	stored := orderstorage.UserOrder{Login: "a", Number: "79927398739", Program: "points", Status: orderstorage.Processed, Balance: currencybalance.CurrencyBalance{Balance: 500}}
+	invalidated := orderstorage.UserOrder{Login: "a", Number: "79927398739", Program: "points", Status: orderstorage.Invalid}
+	mockStorage.On("GetOrder", ctx, "79927398739").Return(stored, nil).Once()
+	mockService.On("GetOrder", ctx, "79927398739").Return(accrualorder.AccrualOrder{Order: "79927398739", Status: orderstorage.Invalid, Program: "points"}, nil).Once()
+	mockStorage.On("UpdateOrderAccrual", ctx, invalidated).Return(nil).Once()
+	mockStorage.On("GetOrder", ctx, "79927398739").Return(invalidated, nil).Once()
+
+	mockStorage.On("GetOrder", ctx, "79927398747").Return(orderstorage.UserOrder{Login: "a", Number: "79927398747"}, nil).Once()
+	mockService.On("GetOrder", ctx, "79927398747").Return(accrualorder.AccrualOrder{Order: "79927398747", Status: orderstorage.Processing}, nil).Once()
+
+	mockStorage.On("GetOrder", ctx, "79927398713").Return(orderstorage.UserOrder{}, orderstorage.ErrOrderNotFound).Once()
+
+	service := NewOrderService(mockStorage, mockService, Settings{Programs: testRegistry(t), Clock: &clock.FixedClock{}})
+
+	order, err := service.RecheckOrder(ctx, "79927398739")
+	require.NoError(t, err)
+	require.Equal(t, invalidated, order)
+
+	_, err = service.RecheckOrder(ctx, "79927398747")
+	require.ErrorIs(t, err, ErrOrderNotFinal)
+
+	_, err = service.RecheckOrder(ctx, "79927398713")
+	require.ErrorIs(t, err, orderstorage.ErrOrderNotFound)
+}
@@ -2,8 +2,13 @@ package service
 
 import (
 	"context"
+	"time"
 
+	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/lotstorage"
 	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"github.com/valinurovdenis/gomart/internal/app/txmanager"
 	"github.com/valinurovdenis/gomart/internal/app/userstorage"
 	"github.com/valinurovdenis/gomart/internal/app/withdrawstorage"
 )
@@ -14,47 +19,266 @@ type ServiceStorage interface {
 
 	AddUserOrder(context context.Context, order orderstorage.UserOrder) error
 
-	GetBalance(context context.Context, login string) (userstorage.UserBalance, error)
+	// AddUserOrders stores new orders returning per-order result as orderstorage.AddUserOrders,
+	// stored orders are passed to enqueue in the same unit of work and are not kept if it fails.
+	AddUserOrders(ctx context.Context, orders []orderstorage.UserOrder, enqueue func(ctx context.Context, numbers []string) error) ([]error, error)
+
+	GetOrder(ctx context.Context, number string) (orderstorage.UserOrder, error)
+
+	UpdateOrderAccrual(ctx context.Context, order orderstorage.UserOrder) error
+
+	GetUserAdjustments(ctx context.Context, login string) ([]orderstorage.Adjustment, error)
+
+	GetBalance(context context.Context, login string, program string) (userstorage.UserBalance, error)
+
+	GetBalances(context context.Context, login string) ([]userstorage.UserBalance, error)
 
 	AddUserWithdraw(ctx context.Context, order withdrawstorage.UserWithdraw) error
 
 	GetUserWithdrawals(ctx context.Context, login string) ([]withdrawstorage.UserWithdraw, error)
+
+	// ReverseUserWithdraw refunds withdrawals made before programs to defaultProgram.
+	ReverseUserWithdraw(ctx context.Context, id int64, reason string, defaultProgram string) (withdrawstorage.UserWithdraw, error)
+
+	GetActiveLots(ctx context.Context, login string, program string, accruedBefore time.Time) ([]lotstorage.AccrualLot, error)
 }
 
+// ServiceStorageImpl composes storages, writes touching several of them run as one unit of work.
 type ServiceStorageImpl struct {
 	UserBalanceStorage userstorage.BalanceStorage
 	WithdrawStorage    withdrawstorage.WithdrawRepository
 	OrderStorage       orderstorage.OrderStorage
+	LotStorage         lotstorage.LotStorage
+	TxManager          txmanager.TxManager
+	Outbox             outbox.OutboxStorage
 }
 
 func (s *ServiceStorageImpl) GetUserOrders(context context.Context, login string) ([]orderstorage.UserOrder, error) {
 	return s.OrderStorage.GetUserOrders(context, login)
 }
 
-func (s *ServiceStorageImpl) AddUserOrder(context context.Context, order orderstorage.UserOrder) error {
-	return s.OrderStorage.AddUserOrder(context, order)
+func (s *ServiceStorageImpl) AddUserOrder(ctx context.Context, order orderstorage.UserOrder) error {
+	return s.TxManager.Do(ctx, func(ctx context.Context) error {
+		if err := s.OrderStorage.AddUserOrder(ctx, order); err != nil {
+			return err
+		}
+		var credit currencybalance.CurrencyBalance
+		if order.Status == orderstorage.Processed {
+			credit = order.Balance
+		}
+		if err := s.credit(ctx, order, credit); err != nil {
+			return err
+		}
+		return s.addOrderEvents(ctx, "", order, credit, "")
+	})
+}
+
+func (s *ServiceStorageImpl) AddUserOrders(ctx context.Context, orders []orderstorage.UserOrder,
+	enqueue func(ctx context.Context, numbers []string) error) ([]error, error) {
+	var results []error
+	err := s.TxManager.Do(ctx, func(ctx context.Context) error {
+		var err error
+		results, err = s.OrderStorage.AddUserOrders(ctx, orders)
+		if err != nil {
+			return err
+		}
+		var stored []string
+		for i, order := range orders {
+			if results[i] != nil {
+				continue
+			}
+			if err = s.addOrderEvents(ctx, "", order, currencybalance.CurrencyBalance{}, ""); err != nil {
+				return err
+			}
+			stored = append(stored, order.Number)
+		}
+		if len(stored) == 0 {
+			return nil
+		}
+		// queue is not part of the transaction, checks published before a failed commit find no order
+		return enqueue(ctx, stored)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
 }
 
-func (s *ServiceStorageImpl) GetBalance(context context.Context, login string) (userstorage.UserBalance, error) {
-	return s.UserBalanceStorage.GetBalance(context, login)
+func (s *ServiceStorageImpl) GetOrder(ctx context.Context, number string) (orderstorage.UserOrder, error) {
+	return s.OrderStorage.GetOrder(ctx, number)
 }
 
+// UpdateOrderAccrual applies accrual status, crediting or clawing back the difference with the previous accrual.
+func (s *ServiceStorageImpl) UpdateOrderAccrual(ctx context.Context, order orderstorage.UserOrder) error {
+	return s.TxManager.Do(ctx, func(ctx context.Context) error {
+		previous, err := s.OrderStorage.GetOrderForUpdate(ctx, order.Number)
+		if err != nil {
+			return err
+		}
+		order, delta, reason, err := orderstorage.ReviseAccrual(previous, order)
+		if err != nil {
+			return err
+		}
+		if err = s.OrderStorage.UpdateOrder(ctx, order); err != nil {
+			return err
+		}
+		if err = s.credit(ctx, order, delta); err != nil {
+			return err
+		}
+		if err = s.addOrderEvents(ctx, previous.Status, order, delta, reason); err != nil {
+			return err
+		}
+		if reason == "" {
+			return nil
+		}
+		return s.OrderStorage.AddAdjustment(ctx, orderstorage.Adjustment{
+			Login:   order.Login,
+			Number:  order.Number,
+			Program: order.Program,
+			Amount:  delta,
+			Reason:  reason,
+		})
+	})
+}
+
+// addOrderEvents records order status change, processing and balance credit or clawback in the outbox.
+func (s *ServiceStorageImpl) addOrderEvents(ctx context.Context, previousStatus orderstorage.OrderStatus, order orderstorage.UserOrder,
+	delta currencybalance.CurrencyBalance, reason string) error {
+	if order.Status != previousStatus {
+		data := outbox.OrderStatusChangedData{Number: order.Number, Status: order.Status, Previous: previousStatus}
+		if err := s.addEvent(ctx, outbox.OrderStatusChanged, order.Login, data); err != nil {
+			return err
+		}
+	}
+	if order.Status == orderstorage.Processed && previousStatus != orderstorage.Processed {
+		data := outbox.OrderProcessedData{Number: order.Number, Program: order.Program, Accrual: order.Balance}
+		if err := s.addEvent(ctx, outbox.OrderProcessed, order.Login, data); err != nil {
+			return err
+		}
+	}
+	if delta.IsNegative() {
+		data := outbox.BalanceDebitedData{Number: order.Number, Program: order.Program, Amount: currencybalance.CurrencyBalance{Balance: -delta.Balance}, Reason: reason}
+		return s.addEvent(ctx, outbox.BalanceDebited, order.Login, data)
+	}
+	if delta.Balance == 0 {
+		return nil
+	}
+	data := outbox.BalanceCreditedData{Number: order.Number, Program: order.Program, Amount: delta}
+	return s.addEvent(ctx, outbox.BalanceCredited, order.Login, data)
+}
+
+func (s *ServiceStorageImpl) addEvent(ctx context.Context, eventType outbox.EventType, login string, data any) error {
+	event, err := outbox.NewEvent(eventType, login, data)
+	if err != nil {
+		return err
+	}
+	return s.Outbox.AddEvent(ctx, event)
+}
+
+// credit credits positive or claws back negative delta, clawback may leave balance negative.
+func (s *ServiceStorageImpl) credit(ctx context.Context, order orderstorage.UserOrder, delta currencybalance.CurrencyBalance) error {
+	if delta.Balance == 0 {
+		return nil
+	}
+	if err := s.UserBalanceStorage.AddBalance(ctx, order.Login, order.Program, delta); err != nil {
+		return err
+	}
+	if delta.IsNegative() {
+		return s.LotStorage.ConsumeLots(ctx, order.Login, order.Program, currencybalance.CurrencyBalance{Balance: -delta.Balance})
+	}
+	return s.LotStorage.AddLot(ctx, order.Login, order.Program, order.Number, delta)
+}
+
+func (s *ServiceStorageImpl) GetUserAdjustments(ctx context.Context, login string) ([]orderstorage.Adjustment, error) {
+	return s.OrderStorage.GetUserAdjustments(ctx, login)
+}
+
+func (s *ServiceStorageImpl) GetBalance(context context.Context, login string, program string) (userstorage.UserBalance, error) {
+	return s.UserBalanceStorage.GetBalance(context, login, program)
+}
+
+func (s *ServiceStorageImpl) GetBalances(context context.Context, login string) ([]userstorage.UserBalance, error) {
+	return s.UserBalanceStorage.GetBalances(context, login)
+}
+
+// AddUserWithdraw checks balance and debits it in one unit of work, so that concurrent withdrawals
+// do not overdraw it.
 func (s *ServiceStorageImpl) AddUserWithdraw(ctx context.Context, order withdrawstorage.UserWithdraw) error {
-	return s.WithdrawStorage.AddUserWithdraw(ctx, order)
+	return s.TxManager.Do(ctx, func(ctx context.Context) error {
+		balance, err := s.UserBalanceStorage.LockBalance(ctx, order.Login, order.Program)
+		if err != nil {
+			return err
+		}
+		if balance.Current.IsNegative() {
+			return ErrNegativeBalance
+		}
+		if balance.Current.Less(order.Withdraw) {
+			return ErrNotEnoughBalance
+		}
+		if err = s.WithdrawStorage.AddUserWithdraw(ctx, order); err != nil {
+			return err
+		}
+		if err = s.UserBalanceStorage.AddWithdrawn(ctx, order.Login, order.Program, order.Withdraw); err != nil {
+			return err
+		}
+		if err = s.LotStorage.ConsumeLots(ctx, order.Login, order.Program, order.Withdraw); err != nil {
+			return err
+		}
+		data := outbox.WithdrawalCreatedData{Number: order.Number, Program: order.Program, Sum: order.Withdraw}
+		return s.addEvent(ctx, outbox.WithdrawalCreated, order.Login, data)
+	})
 }
 
 func (s *ServiceStorageImpl) GetUserWithdrawals(ctx context.Context, login string) ([]withdrawstorage.UserWithdraw, error) {
 	return s.WithdrawStorage.GetUserWithdrawals(ctx, login)
 }
 
+// ReverseUserWithdraw marks withdraw reversed and credits its sum back to user balance.
+func (s *ServiceStorageImpl) ReverseUserWithdraw(ctx context.Context, id int64, reason string, defaultProgram string) (withdrawstorage.UserWithdraw, error) {
+	var withdraw withdrawstorage.UserWithdraw
+	err := s.TxManager.Do(ctx, func(ctx context.Context) error {
+		var err error
+		withdraw, err = s.WithdrawStorage.ReverseUserWithdraw(ctx, id, reason)
+		if err != nil {
+			return err
+		}
+		if withdraw.Program == "" {
+			withdraw.Program = defaultProgram
+		}
+		refund := currencybalance.CurrencyBalance{Balance: -withdraw.Withdraw.Balance}
+		if err = s.UserBalanceStorage.AddWithdrawn(ctx, withdraw.Login, withdraw.Program, refund); err != nil {
+			return err
+		}
+		if err = s.LotStorage.AddLot(ctx, withdraw.Login, withdraw.Program, withdraw.Number, withdraw.Withdraw); err != nil {
+			return err
+		}
+		data := outbox.WithdrawalReversedData{Number: withdraw.Number, Program: withdraw.Program, Sum: withdraw.Withdraw, Reason: reason}
+		return s.addEvent(ctx, outbox.WithdrawalReversed, withdraw.Login, data)
+	})
+	if err != nil {
+		return withdrawstorage.UserWithdraw{}, err
+	}
+	return withdraw, nil
+}
+
+func (s *ServiceStorageImpl) GetActiveLots(ctx context.Context, login string, program string, accruedBefore time.Time) ([]lotstorage.AccrualLot, error) {
+	return s.LotStorage.GetActiveLots(ctx, login, program, accruedBefore)
+}
+
 func NewServiceStorage(userBalanceStorage userstorage.BalanceStorage,
 	withdrawStorage withdrawstorage.WithdrawRepository,
-	orderStorage orderstorage.OrderStorage) *ServiceStorageImpl {
+	orderStorage orderstorage.OrderStorage,
+	lotStorage lotstorage.LotStorage,
+	txManager txmanager.TxManager,
+	outboxStorage outbox.OutboxStorage) *ServiceStorageImpl {
 
 	ret := &ServiceStorageImpl{
 		UserBalanceStorage: userBalanceStorage,
 		WithdrawStorage:    withdrawStorage,
 		OrderStorage:       orderStorage,
+		LotStorage:         lotStorage,
+		TxManager:          txManager,
+		Outbox:             outboxStorage,
 	}
 	return ret
 }
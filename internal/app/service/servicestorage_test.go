@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/memstorage"
+	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/userstorage"
+	"github.com/valinurovdenis/gomart/internal/app/withdrawstorage"
+	"github.com/valinurovdenis/gomart/mocks"
+)
+
+func TestServiceStorage_ReverseLegacyWithdraw(t *testing.T) {
+	ctx := context.Background()
+	testClock := &clock.FixedClock{Time: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	storage := memstorage.NewMemoryStorage(testClock)
+	sum := currencybalance.CurrencyBalance{Balance: 100}
+	require.NoError(t, storage.AddBalance(ctx, "a", "points", sum))
+	require.NoError(t, storage.AddWithdrawn(ctx, "a", "points", sum))
+
+	// withdrawals made before programs have none
+	withdrawals := mocks.NewWithdrawRepository(t)
+	legacy := withdrawstorage.UserWithdraw{ID: 1, Login: "a", Number: "2377225624", Withdraw: sum, Status: withdrawstorage.Reversed}
+	withdrawals.On("ReverseUserWithdraw", mock.Anything, int64(1), "cancelled").Return(legacy, nil).Once()
+	serviceStorage := NewServiceStorage(storage, withdrawals, storage, storage, storage, storage)
+
+	reversed, err := serviceStorage.ReverseUserWithdraw(ctx, 1, "cancelled", "points")
+	require.NoError(t, err)
+	require.Equal(t, "points", reversed.Program)
+	balance, err := storage.GetBalance(ctx, "a", "points")
+	require.NoError(t, err)
+	require.Equal(t, sum, balance.Current)
+	require.Zero(t, balance.Withdrawn.Balance)
+	lots, err := storage.GetActiveLots(ctx, "a", "points", testClock.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, lots, 1)
+}
+
+// racingBalances lets every withdrawal read balance without lock before any of them writes.
+type racingBalances struct {
+	*memstorage.MemoryStorage
+	reads sync.WaitGroup
+}
+
+func (s *racingBalances) GetBalance(ctx context.Context, login string, program string) (userstorage.UserBalance, error) {
+	s.reads.Done()
+	s.reads.Wait()
+	return s.MemoryStorage.GetBalance(ctx, login, program)
+}
+
+func TestOrderService_ConcurrentWithdrawals(t *testing.T) {
+	const withdrawals = 10
+	ctx := context.Background()
+	storage := memstorage.NewMemoryStorage(clock.RealClock{})
+	require.NoError(t, storage.AddBalance(ctx, "a", "points", currencybalance.CurrencyBalance{Balance: 100}))
+	balances := &racingBalances{MemoryStorage: storage}
+	balances.reads.Add(withdrawals)
+	serviceStorage := NewServiceStorage(balances, storage, storage, storage, storage, storage)
+	service := NewOrderService(serviceStorage, mocks.NewAccrualOrderService(t), Settings{Programs: testRegistry(t), Clock: clock.RealClock{}})
+
+	var wg sync.WaitGroup
+	var succeeded atomic.Int32
+	for i := 0; i < withdrawals; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			withdraw := withdrawstorage.UserWithdraw{Login: "a", Number: "79927398713", Program: "points", Withdraw: currencybalance.CurrencyBalance{Balance: 30}}
+			err := service.AddUserWithdraw(ctx, withdraw)
+			if err == nil {
+				succeeded.Add(1)
+			} else {
+				require.ErrorIs(t, err, ErrNotEnoughBalance)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(3), succeeded.Load())
+	balance, err := storage.GetBalance(ctx, "a", "points")
+	require.NoError(t, err)
+	require.Equal(t, int64(10), balance.Current.Balance)
+}
+
+func TestOrderService_AddUserOrdersEnqueueFailed(t *testing.T) {
+	ctx := context.Background()
+	storage := memstorage.NewMemoryStorage(clock.RealClock{})
+	accrual := mocks.NewAccrualOrderService(t)
+	serviceStorage := NewServiceStorage(storage, storage, storage, storage, storage, storage)
+	service := NewOrderService(serviceStorage, accrual, Settings{Programs: testRegistry(t), Clock: clock.RealClock{}})
+
+	accrual.On("EnqueueNewOrders", mock.Anything, "a", []string{"79927398713"}).Return(errors.New("queue is down")).Once()
+	_, err := service.AddUserOrders(ctx, "a", []string{"79927398713"})
+	require.Error(t, err)
+	_, err = storage.GetOrder(ctx, "79927398713")
+	require.ErrorIs(t, err, orderstorage.ErrOrderNotFound)
+
+	// retried upload is accepted and queued again
+	accrual.On("EnqueueNewOrders", mock.Anything, "a", []string{"79927398713"}).Return(nil).Once()
+	results, err := service.AddUserOrders(ctx, "a", []string{"79927398713"})
+	require.NoError(t, err)
+	require.Equal(t, []BatchOrderResult{{Number: "79927398713", Status: BatchAccepted}}, results)
+}
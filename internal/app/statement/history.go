@@ -0,0 +1,145 @@
+package statement
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/pgdb"
+	"github.com/valinurovdenis/gomart/internal/app/userstorage"
+)
+
+const DateLayout = "2006-01-02"
+
+// BalancePoint is balance of program at the end of day in UTC.
+type BalancePoint struct {
+	Date    string                          `json:"date"`
+	Program string                          `json:"program"`
+	Balance currencybalance.CurrencyBalance `json:"balance"`
+}
+
+//go:generate mockery --name HistoryStorage
+type HistoryStorage interface {
+	// GetDailyBalances returns balance of every program the user has at the end of every day from first to last day.
+	GetDailyBalances(ctx context.Context, login string, first time.Time, last time.Time) ([]BalancePoint, error)
+
+	// GetBalancesAt returns current and withdrawn sums of every program of user as of time.
+	GetBalancesAt(ctx context.Context, login string, at time.Time) ([]userstorage.UserBalance, error)
+}
+
+func withdrawn(entry Entry) int64 {
+	if entry.Type == WithdrawalEntry || entry.Type == ReversalEntry {
+		return -entry.Amount.Balance
+	}
+	return 0
+}
+
+// DailyBalances computes GetDailyBalances from complete history of user.
+func DailyBalances(entries []Entry, first time.Time, last time.Time) []BalancePoint {
+	sort.SliceStable(entries, func(i, j int) bool { return less(entries[i], entries[j]) })
+	programs := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Program != "" {
+			programs[entry.Program] = true
+		}
+	}
+	codes := make([]string, 0, len(programs))
+	for code := range programs {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	var res []BalancePoint
+	balances := make(map[string]int64)
+	i := 0
+	for day := first.UTC().Truncate(24 * time.Hour); !day.After(last); day = day.AddDate(0, 0, 1) {
+		end := day.AddDate(0, 0, 1)
+		for ; i < len(entries) && entries[i].Time.Before(end); i++ {
+			balances[entries[i].Program] += entries[i].Amount.Balance
+		}
+		for _, code := range codes {
+			res = append(res, BalancePoint{Date: day.Format(DateLayout), Program: code,
+				Balance: currencybalance.CurrencyBalance{Balance: balances[code]}})
+		}
+	}
+	return res
+}
+
+// BalancesAt computes GetBalancesAt from complete history of user.
+func BalancesAt(entries []Entry, at time.Time) []userstorage.UserBalance {
+	byProgram := make(map[string]*userstorage.UserBalance)
+	var res []userstorage.UserBalance
+	for _, entry := range entries {
+		if entry.Program == "" || entry.Time.After(at) {
+			continue
+		}
+		balance, ok := byProgram[entry.Program]
+		if !ok {
+			balance = &userstorage.UserBalance{Program: entry.Program}
+			byProgram[entry.Program] = balance
+		}
+		balance.Current.Balance += entry.Amount.Balance
+		balance.Withdrawn.Balance += withdrawn(entry)
+	}
+	for _, balance := range byProgram {
+		res = append(res, *balance)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Program < res[j].Program })
+	return res
+}
+
+const dailyBalancesQuery = `
+	WITH entries AS (` + entriesQuery + `),
+	daily AS (
+		SELECT program, (time AT TIME ZONE 'UTC')::DATE AS day, SUM(amount) AS amount FROM entries
+			WHERE program <> '' GROUP BY program, day
+	),
+	opening AS (
+		SELECT program, SUM(amount) AS amount FROM daily WHERE day < $2::DATE GROUP BY program
+	),
+	days AS (
+		SELECT generate_series($2::DATE, $3::DATE, INTERVAL '1 day')::DATE AS day
+	)
+	SELECT to_char(d.day, 'YYYY-MM-DD'), p.program,
+		(COALESCE(o.amount, 0) + SUM(COALESCE(dl.amount, 0)) OVER (PARTITION BY p.program ORDER BY d.day))::BIGINT
+		FROM days d
+		CROSS JOIN (SELECT DISTINCT program FROM daily) p
+		LEFT JOIN daily dl ON dl.program = p.program AND dl.day = d.day
+		LEFT JOIN opening o ON o.program = p.program
+		ORDER BY d.day, p.program
+`
+
+func (s *DatabaseStatementStorage) GetDailyBalances(ctx context.Context, login string, first time.Time, last time.Time) ([]BalancePoint, error) {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx, dailyBalancesQuery,
+		login, first.UTC().Truncate(24*time.Hour), last.UTC().Truncate(24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (BalancePoint, error) {
+		var point BalancePoint
+		err := row.Scan(&point.Date, &point.Program, &point.Balance.Balance)
+		return point, err
+	})
+}
+
+const balancesAtQuery = `
+	WITH entries AS (` + entriesQuery + `)
+	SELECT program, SUM(amount)::BIGINT, SUM(withdrawn)::BIGINT FROM entries
+		WHERE program <> '' AND time <= $2
+		GROUP BY program
+		ORDER BY program
+`
+
+func (s *DatabaseStatementStorage) GetBalancesAt(ctx context.Context, login string, at time.Time) ([]userstorage.UserBalance, error) {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx, balancesAtQuery, login, at)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (userstorage.UserBalance, error) {
+		var balance userstorage.UserBalance
+		err := row.Scan(&balance.Program, &balance.Current.Balance, &balance.Withdrawn.Balance)
+		return balance, err
+	})
+}
@@ -0,0 +1,126 @@
+package statement
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/pgdb"
+)
+
+type EntryType string
+
+const (
+	OrderEntry      EntryType = "order"
+	AdjustmentEntry EntryType = "adjustment"
+	WithdrawalEntry EntryType = "withdrawal"
+	ReversalEntry   EntryType = "reversal"
+	ExpirationEntry EntryType = "expiration"
+)
+
+// Entry is a single line of statement, Amount changes balance of Program
+// and Balance is the running balance of Program after the entry.
+type Entry struct {
+	Time    time.Time                       `json:"time"`
+	Type    EntryType                       `json:"type"`
+	Number  string                          `json:"order,omitempty"`
+	Program string                          `json:"program"`
+	Status  string                          `json:"status,omitempty"`
+	Amount  currencybalance.CurrencyBalance `json:"amount"`
+	Balance currencybalance.CurrencyBalance `json:"balance"`
+	Details string                          `json:"details,omitempty"`
+}
+
+func less(a Entry, b Entry) bool {
+	if !a.Time.Equal(b.Time) {
+		return a.Time.Before(b.Time)
+	}
+	if a.Type != b.Type {
+		return a.Type < b.Type
+	}
+	return a.Number < b.Number
+}
+
+// WithRunningBalance sorts complete history of user and fills running balances,
+// entries outside of [from, to) are dropped after counting them.
+func WithRunningBalance(entries []Entry, from time.Time, to time.Time) []Entry {
+	sort.SliceStable(entries, func(i, j int) bool { return less(entries[i], entries[j]) })
+	balances := make(map[string]int64)
+	res := entries[:0]
+	for _, entry := range entries {
+		balances[entry.Program] += entry.Amount.Balance
+		entry.Balance.Balance = balances[entry.Program]
+		if !entry.Time.Before(from) && entry.Time.Before(to) {
+			res = append(res, entry)
+		}
+	}
+	return res
+}
+
+//go:generate mockery --name StatementStorage
+type StatementStorage interface {
+	// StreamStatement calls fn for every entry of user in [from, to) in chronological order
+	// without loading the whole statement into memory.
+	StreamStatement(ctx context.Context, login string, from time.Time, to time.Time, fn func(Entry) error) error
+}
+
+type DatabaseStatementStorage struct {
+	Pool *pgxpool.Pool
+}
+
+// entriesQuery selects balance changes of user $1 with changes of withdrawn sum,
+// orders are listed with their original accrual and later revisions as adjustments.
+// Orders are dated by their first crediting, orders credited before it was recorded by their upload.
+const entriesQuery = `
+	SELECT COALESCE(o.accrued, o.uploaded) AS time, 'order' AS type, o.number, COALESCE(o.program, '') AS program, o.status::TEXT AS status,
+		(CASE WHEN o.status = 'PROCESSED' THEN o.balance ELSE 0 END - COALESCE(a.amount, 0))::BIGINT AS amount, 0 AS withdrawn, '' AS details
+		FROM orders o
+		LEFT JOIN (SELECT number, SUM(amount) AS amount FROM adjustments WHERE login=$1 GROUP BY number) a ON a.number = o.number
+		WHERE o.login=$1
+	UNION ALL
+	SELECT created, 'adjustment', number, program, '', amount, 0, reason FROM adjustments WHERE login=$1
+	UNION ALL
+	SELECT processed, 'withdrawal', number, COALESCE(program, ''), '', -withdraw, withdraw, '' FROM withdraw WHERE login=$1
+	UNION ALL
+	SELECT reversed, 'reversal', number, COALESCE(program, ''), '', withdraw, -withdraw, COALESCE(reverse_reason, '')
+		FROM withdraw WHERE login=$1 AND reversed IS NOT NULL
+	UNION ALL
+	SELECT expired, 'expiration', '', program, '', (-SUM(amount))::BIGINT, 0, '' FROM expirations WHERE login=$1 GROUP BY program, expired
+`
+
+const statementQuery = `
+	WITH entries AS (` + entriesQuery + `),
+	running AS (
+		SELECT *, (SUM(amount) OVER (PARTITION BY program ORDER BY time, type, number ROWS UNBOUNDED PRECEDING))::BIGINT AS balance
+			FROM entries
+	)
+	SELECT time, type, number, program, status, amount, balance, details FROM running
+		WHERE time >= $2 AND time < $3
+		ORDER BY time, type, number
+`
+
+func (s *DatabaseStatementStorage) StreamStatement(ctx context.Context, login string, from time.Time, to time.Time, fn func(Entry) error) error {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx, statementQuery, login, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry Entry
+		err = rows.Scan(&entry.Time, &entry.Type, &entry.Number, &entry.Program, &entry.Status,
+			&entry.Amount.Balance, &entry.Balance.Balance, &entry.Details)
+		if err != nil {
+			return err
+		}
+		if err = fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func NewDatabaseStatementStorage(pool *pgxpool.Pool) *DatabaseStatementStorage {
+	return &DatabaseStatementStorage{Pool: pool}
+}
@@ -0,0 +1,92 @@
+package statement
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+)
+
+func TestWithRunningBalance(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	amount := func(value int64) currencybalance.CurrencyBalance {
+		return currencybalance.CurrencyBalance{Balance: value}
+	}
+	entries := []Entry{
+		{Time: day.Add(48 * time.Hour), Type: WithdrawalEntry, Number: "2", Program: "points", Amount: amount(-300)},
+		{Time: day, Type: OrderEntry, Number: "1", Program: "points", Amount: amount(1000)},
+		{Time: day.Add(24 * time.Hour), Type: OrderEntry, Number: "3", Program: "miles", Amount: amount(7)},
+		{Time: day.Add(72 * time.Hour), Type: AdjustmentEntry, Number: "1", Program: "points", Amount: amount(-600)},
+	}
+	got := WithRunningBalance(entries, day.Add(time.Hour), day.Add(72*time.Hour))
+	require.Len(t, got, 2)
+	require.Equal(t, "3", got[0].Number)
+	require.Equal(t, int64(7), got[0].Balance.Balance)
+	require.Equal(t, "2", got[1].Number)
+	// running balance counts entries before the period
+	require.Equal(t, int64(700), got[1].Balance.Balance)
+}
+
+func TestWriters(t *testing.T) {
+	entry := Entry{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Type: OrderEntry, Number: "1", Program: "points",
+		Status: "PROCESSED", Amount: currencybalance.CurrencyBalance{Balance: 1050}, Balance: currencybalance.CurrencyBalance{Balance: 1050}}
+	tests := []struct {
+		format  string
+		entries []Entry
+		want    string
+	}{
+		{format: "csv", entries: []Entry{entry}, want: "time,type,order,program,status,amount,balance,details\n" +
+			"2024-01-01T00:00:00Z,order,1,points,PROCESSED,10.5,10.5,\n"},
+		{format: "json", want: "[]\n"},
+		{format: "json", entries: []Entry{entry, entry}, want: "[\n" +
+			`{"time":"2024-01-01T00:00:00Z","type":"order","order":"1","program":"points","status":"PROCESSED","amount":10.5,"balance":10.5},` + "\n" +
+			`{"time":"2024-01-01T00:00:00Z","type":"order","order":"1","program":"points","status":"PROCESSED","amount":10.5,"balance":10.5}` + "\n]\n"},
+		{format: "ndjson", entries: []Entry{entry}, want: `{"time":"2024-01-01T00:00:00Z","type":"order","order":"1","program":"points","status":"PROCESSED","amount":10.5,"balance":10.5}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewWriter(tt.format, &buf)
+			require.NoError(t, err)
+			for _, entry := range tt.entries {
+				require.NoError(t, writer.Write(entry))
+			}
+			require.NoError(t, writer.Close())
+			require.Equal(t, tt.want, buf.String())
+		})
+	}
+
+	_, err := NewWriter("xml", &bytes.Buffer{})
+	require.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestDailyBalancesAndBalancesAt(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Time: day.Add(-time.Hour), Type: OrderEntry, Number: "1", Program: "points", Amount: currencybalance.CurrencyBalance{Balance: 1000}},
+		{Time: day.Add(36 * time.Hour), Type: WithdrawalEntry, Number: "2", Program: "points", Amount: currencybalance.CurrencyBalance{Balance: -300}},
+		{Time: day.Add(60 * time.Hour), Type: ReversalEntry, Number: "2", Program: "points", Amount: currencybalance.CurrencyBalance{Balance: 300}},
+		{Time: day.Add(12 * time.Hour), Type: OrderEntry, Number: "3", Program: "miles", Amount: currencybalance.CurrencyBalance{Balance: 700}},
+		{Time: day, Type: OrderEntry, Number: "4", Status: "NEW"},
+	}
+
+	points := DailyBalances(entries, day, day.AddDate(0, 0, 2))
+	var got []string
+	for _, point := range points {
+		got = append(got, point.Date+" "+point.Program+" "+point.Balance.String())
+	}
+	require.Equal(t, []string{
+		"2024-01-01 miles 7", "2024-01-01 points 10",
+		"2024-01-02 miles 7", "2024-01-02 points 7",
+		"2024-01-03 miles 7", "2024-01-03 points 10",
+	}, got)
+
+	balances := BalancesAt(entries, day.Add(48*time.Hour))
+	require.Len(t, balances, 2)
+	require.Equal(t, "miles", balances[0].Program)
+	require.Equal(t, "points", balances[1].Program)
+	require.Equal(t, int64(700), balances[1].Current.Balance)
+	require.Equal(t, int64(300), balances[1].Withdrawn.Balance)
+}
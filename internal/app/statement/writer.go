@@ -0,0 +1,110 @@
+package statement
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrUnknownFormat = errors.New("unknown statement format")
+
+// Writer encodes entries one by one, Close completes the document.
+type Writer interface {
+	Write(entry Entry) error
+	Close() error
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+var csvHeader = []string{"time", "type", "order", "program", "status", "amount", "balance", "details"}
+
+func (w *csvWriter) Write(entry Entry) error {
+	return w.writer.Write([]string{
+		entry.Time.Format(time.RFC3339), string(entry.Type), entry.Number, entry.Program, entry.Status,
+		entry.Amount.String(), entry.Balance.String(), entry.Details,
+	})
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(entry Entry) error {
+	return w.encoder.Encode(entry)
+}
+
+func (w *ndjsonWriter) Close() error {
+	return nil
+}
+
+// jsonWriter writes a json array without holding its elements.
+type jsonWriter struct {
+	writer  io.Writer
+	written bool
+}
+
+func (w *jsonWriter) Write(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	separator := ",\n"
+	if !w.written {
+		separator = "[\n"
+		w.written = true
+	}
+	if _, err = io.WriteString(w.writer, separator); err != nil {
+		return err
+	}
+	_, err = w.writer.Write(data)
+	return err
+}
+
+func (w *jsonWriter) Close() error {
+	end := "\n]\n"
+	if !w.written {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(w.writer, end)
+	return err
+}
+
+// ContentType returns media type of format or ErrUnknownFormat.
+func ContentType(format string) (string, error) {
+	switch format {
+	case "csv":
+		return "text/csv", nil
+	case "json":
+		return "application/json", nil
+	case "ndjson":
+		return "application/x-ndjson", nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return nil, err
+		}
+		return &csvWriter{writer: writer}, nil
+	case "json":
+		return &jsonWriter{writer: w}, nil
+	case "ndjson":
+		return &ndjsonWriter{encoder: json.NewEncoder(w)}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
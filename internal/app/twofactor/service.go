@@ -0,0 +1,161 @@
+package twofactor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+)
+
+const (
+	recoveryCodes     = 10
+	recoveryCodeBytes = 5
+)
+
+var ErrConfirmationRequired = errors.New("fresh two-factor confirmation is required")
+
+// Enrollment is a new secret of user waiting for verification of its first code.
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type confirmedKey struct{}
+
+// ContextWithConfirmation stores time the caller last confirmed second factor.
+func ContextWithConfirmation(ctx context.Context, confirmed time.Time) context.Context {
+	return context.WithValue(ctx, confirmedKey{}, confirmed)
+}
+
+func ConfirmedAt(ctx context.Context) time.Time {
+	confirmed, _ := ctx.Value(confirmedKey{}).(time.Time)
+	return confirmed
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodes)
+	hashes := make([]string, recoveryCodes)
+	for i := range codes {
+		random := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(random))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// TwoFactorService enrolls users and checks their codes, Fresh is how long confirmation
+// of second factor allows sensitive operations.
+type TwoFactorService struct {
+	Storage TwoFactorStorage
+	Clock   clock.Clock
+	Issuer  string
+	Fresh   time.Duration
+}
+
+// Enroll generates new secret of user replacing unverified one.
+func (s *TwoFactorService) Enroll(ctx context.Context, login string) (Enrollment, error) {
+	existing, err := s.Storage.GetTwoFactor(ctx, login)
+	if err == nil && existing.Enabled {
+		return Enrollment{}, ErrAlreadyEnabled
+	} else if err != nil && !errors.Is(err, ErrNotEnrolled) {
+		return Enrollment{}, err
+	}
+	secret, err := GenerateSecret()
+	if err != nil {
+		return Enrollment{}, err
+	}
+	if err = s.Storage.SetTwoFactor(ctx, TwoFactor{Login: login, Secret: secret}); err != nil {
+		return Enrollment{}, err
+	}
+	return Enrollment{Secret: secret, URI: URI(s.Issuer, login, secret)}, nil
+}
+
+// Enable verifies the first code of enrollment and returns recovery codes, they are shown only once.
+func (s *TwoFactorService) Enable(ctx context.Context, login string, code string) ([]string, error) {
+	twoFactor, err := s.Storage.GetTwoFactor(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor.Enabled {
+		return nil, ErrAlreadyEnabled
+	}
+	step, ok := match(twoFactor.Secret, code, s.Clock.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	twoFactor.Enabled, twoFactor.RecoveryCodes, twoFactor.LastStep = true, hashes, step
+	return codes, s.Storage.SetTwoFactor(ctx, twoFactor)
+}
+
+func (s *TwoFactorService) IsEnabled(ctx context.Context, login string) (bool, error) {
+	twoFactor, err := s.Storage.GetTwoFactor(ctx, login)
+	if errors.Is(err, ErrNotEnrolled) {
+		return false, nil
+	}
+	return twoFactor.Enabled, err
+}
+
+// Verify accepts unused code of authenticator or recovery code of user with enabled second factor.
+func (s *TwoFactorService) Verify(ctx context.Context, login string, code string) error {
+	twoFactor, err := s.Storage.GetTwoFactor(ctx, login)
+	if err != nil {
+		return err
+	}
+	if !twoFactor.Enabled {
+		return ErrNotEnrolled
+	}
+	var used bool
+	if step, ok := match(twoFactor.Secret, code, s.Clock.Now()); ok {
+		used, err = s.Storage.UseStep(ctx, login, step)
+	} else if len(code) > digits {
+		used, err = s.Storage.UseRecoveryCode(ctx, login, hashRecoveryCode(code))
+	}
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// Disable turns second factor off, caller verifies its code first.
+func (s *TwoFactorService) Disable(ctx context.Context, login string) error {
+	return s.Storage.DeleteTwoFactor(ctx, login)
+}
+
+// RequireConfirmation rejects sensitive operation of user with enabled second factor
+// if it was not confirmed within Fresh.
+func (s *TwoFactorService) RequireConfirmation(ctx context.Context, login string) error {
+	enabled, err := s.IsEnabled(ctx, login)
+	if err != nil || !enabled {
+		return err
+	}
+	if s.Clock.Now().Sub(ConfirmedAt(ctx)) > s.Fresh {
+		return ErrConfirmationRequired
+	}
+	return nil
+}
+
+func NewTwoFactorService(storage TwoFactorStorage, clock clock.Clock, issuer string, fresh time.Duration) *TwoFactorService {
+	return &TwoFactorService{Storage: storage, Clock: clock, Issuer: issuer, Fresh: fresh}
+}
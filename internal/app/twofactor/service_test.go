@@ -0,0 +1,68 @@
+package twofactor_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/memstorage"
+	"github.com/valinurovdenis/gomart/internal/app/twofactor"
+)
+
+func TestTwoFactorService(t *testing.T) {
+	ctx := context.Background()
+	testClock := &clock.FixedClock{Time: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	storage := memstorage.NewMemoryStorage(testClock)
+	service := twofactor.NewTwoFactorService(storage, testClock, "Gophermart", time.Minute)
+	code := func(secret string) string {
+		code, err := twofactor.Code(secret, testClock.Now().Unix()/30)
+		require.NoError(t, err)
+		return code
+	}
+
+	require.ErrorIs(t, service.Verify(ctx, "user", "123456"), twofactor.ErrNotEnrolled)
+	enrollment, err := service.Enroll(ctx, "user")
+	require.NoError(t, err)
+	// pending enrollment neither protects logins nor accepts codes
+	enabled, err := service.IsEnabled(ctx, "user")
+	require.NoError(t, err)
+	require.False(t, enabled)
+	require.ErrorIs(t, service.Verify(ctx, "user", code(enrollment.Secret)), twofactor.ErrNotEnrolled)
+
+	_, err = service.Enable(ctx, "user", "000000x")
+	require.ErrorIs(t, err, twofactor.ErrInvalidCode)
+	recoveryCodes, err := service.Enable(ctx, "user", code(enrollment.Secret))
+	require.NoError(t, err)
+	require.Len(t, recoveryCodes, 10)
+	_, err = service.Enroll(ctx, "user")
+	require.ErrorIs(t, err, twofactor.ErrAlreadyEnabled)
+	stored, err := storage.GetTwoFactor(ctx, "user")
+	require.NoError(t, err)
+	require.NotContains(t, stored.RecoveryCodes, recoveryCodes[0])
+
+	// code used for enabling is not accepted again, the next one is once
+	require.ErrorIs(t, service.Verify(ctx, "user", code(enrollment.Secret)), twofactor.ErrInvalidCode)
+	testClock.Advance(30 * time.Second)
+	require.NoError(t, service.Verify(ctx, "user", code(enrollment.Secret)))
+	require.ErrorIs(t, service.Verify(ctx, "user", code(enrollment.Secret)), twofactor.ErrInvalidCode)
+
+	// recovery codes are single use and tolerate formatting
+	require.NoError(t, service.Verify(ctx, "user", recoveryCodes[0]))
+	require.ErrorIs(t, service.Verify(ctx, "user", recoveryCodes[0]), twofactor.ErrInvalidCode)
+	require.NoError(t, service.Verify(ctx, "user", " "+strings.ToUpper(strings.ReplaceAll(recoveryCodes[1], "-", ""))))
+
+	// fresh confirmation is required only from users with enabled second factor
+	require.ErrorIs(t, service.RequireConfirmation(ctx, "user"), twofactor.ErrConfirmationRequired)
+	confirmed := twofactor.ContextWithConfirmation(ctx, testClock.Now())
+	require.NoError(t, service.RequireConfirmation(confirmed, "user"))
+	testClock.Advance(time.Minute + time.Second)
+	require.ErrorIs(t, service.RequireConfirmation(confirmed, "user"), twofactor.ErrConfirmationRequired)
+	require.NoError(t, service.RequireConfirmation(ctx, "other"))
+
+	require.NoError(t, service.Disable(ctx, "user"))
+	require.NoError(t, service.RequireConfirmation(ctx, "user"))
+}
@@ -0,0 +1,38 @@
+package twofactor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// secret of RFC 6238 test vectors, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	for unix, expected := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"} {
+		code, err := Code(rfcSecret, timeStep(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		require.Equal(t, expected, code, unix)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	step, ok := match(rfcSecret, "081804", now)
+	require.True(t, ok)
+	require.Equal(t, timeStep(now), step)
+	// authenticator clock may drift by one step
+	_, ok = match(rfcSecret, "081804", now.Add(period))
+	require.True(t, ok)
+	_, ok = match(rfcSecret, "081804", now.Add(2*period))
+	require.False(t, ok)
+	_, ok = match(rfcSecret, "81804", now)
+	require.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	require.Equal(t, "otpauth://totp/Gopher%20mart:user1?algorithm=SHA1&digits=6&issuer=Gopher+mart&period=30&secret="+rfcSecret,
+		URI("Gopher mart", "user1", rfcSecret))
+}
@@ -0,0 +1,95 @@
+package twofactor
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valinurovdenis/gomart/internal/app/pgdb"
+)
+
+// TwoFactor is TOTP secret of user, it protects logins only after enrollment is verified.
+type TwoFactor struct {
+	Login   string
+	Secret  string
+	Enabled bool
+	// RecoveryCodes are SHA-256 hashes of unused recovery codes.
+	RecoveryCodes []string
+	// LastStep is time step of the last accepted code, codes are not accepted twice.
+	LastStep int64
+}
+
+var ErrNotEnrolled = errors.New("two-factor authentication is not enabled")
+var ErrAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+var ErrInvalidCode = errors.New("invalid two-factor code")
+
+//go:generate mockery --name TwoFactorStorage
+type TwoFactorStorage interface {
+	// GetTwoFactor returns ErrNotEnrolled if user has not started enrollment.
+	GetTwoFactor(ctx context.Context, login string) (TwoFactor, error)
+
+	// SetTwoFactor replaces two-factor settings of user.
+	SetTwoFactor(ctx context.Context, twoFactor TwoFactor) error
+
+	DeleteTwoFactor(ctx context.Context, login string) error
+
+	// UseStep accepts code of time step later than the last accepted one and reports if it was accepted.
+	UseStep(ctx context.Context, login string, step int64) (bool, error)
+
+	// UseRecoveryCode removes hash of recovery code and reports if it was unused.
+	UseRecoveryCode(ctx context.Context, login string, hash string) (bool, error)
+}
+
+type DatabaseTwoFactorStorage struct {
+	Pool *pgxpool.Pool
+}
+
+func (s *DatabaseTwoFactorStorage) Init() error {
+	return pgdb.ExecBatch(context.Background(), s.Pool,
+		`CREATE TABLE IF NOT EXISTS two_factor("login" TEXT PRIMARY KEY, "secret" TEXT, "enabled" BOOLEAN DEFAULT FALSE, "recovery_codes" TEXT[], "last_step" BIGINT DEFAULT 0)`,
+	)
+}
+
+func (s *DatabaseTwoFactorStorage) GetTwoFactor(ctx context.Context, login string) (TwoFactor, error) {
+	twoFactor := TwoFactor{Login: login}
+	err := pgdb.Conn(ctx, s.Pool).QueryRow(ctx,
+		"SELECT secret, enabled, recovery_codes, last_step FROM two_factor WHERE login=$1", login).
+		Scan(&twoFactor.Secret, &twoFactor.Enabled, &twoFactor.RecoveryCodes, &twoFactor.LastStep)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return TwoFactor{}, ErrNotEnrolled
+	}
+	return twoFactor, err
+}
+
+func (s *DatabaseTwoFactorStorage) SetTwoFactor(ctx context.Context, twoFactor TwoFactor) error {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx,
+		`INSERT INTO two_factor (login, secret, enabled, recovery_codes, last_step) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (login) DO UPDATE SET secret=EXCLUDED.secret, enabled=EXCLUDED.enabled,
+			recovery_codes=EXCLUDED.recovery_codes, last_step=EXCLUDED.last_step`,
+		twoFactor.Login, twoFactor.Secret, twoFactor.Enabled, twoFactor.RecoveryCodes, twoFactor.LastStep)
+	return err
+}
+
+func (s *DatabaseTwoFactorStorage) DeleteTwoFactor(ctx context.Context, login string) error {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, "DELETE FROM two_factor WHERE login=$1", login)
+	return err
+}
+
+func (s *DatabaseTwoFactorStorage) UseStep(ctx context.Context, login string, step int64) (bool, error) {
+	tag, err := pgdb.Conn(ctx, s.Pool).Exec(ctx,
+		"UPDATE two_factor SET last_step=$2 WHERE login=$1 AND last_step < $2", login, step)
+	return err == nil && tag.RowsAffected() == 1, err
+}
+
+func (s *DatabaseTwoFactorStorage) UseRecoveryCode(ctx context.Context, login string, hash string) (bool, error) {
+	tag, err := pgdb.Conn(ctx, s.Pool).Exec(ctx,
+		"UPDATE two_factor SET recovery_codes=array_remove(recovery_codes, $2) WHERE login=$1 AND $2=ANY(recovery_codes)", login, hash)
+	return err == nil && tag.RowsAffected() == 1, err
+}
+
+func NewDatabaseTwoFactorStorage(pool *pgxpool.Pool) *DatabaseTwoFactorStorage {
+	ret := &DatabaseTwoFactorStorage{Pool: pool}
+	ret.Init()
+	return ret
+}
@@ -0,0 +1,12 @@
+package txmanager
+
+import "context"
+
+// TxManager runs a unit of work spanning several storages in one transaction,
+// storages join the transaction through the context passed to fn.
+//
+//go:generate mockery --name TxManager
+type TxManager interface {
+	// Do commits when fn succeeds and rolls back otherwise, fn may run again on serialization failure.
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
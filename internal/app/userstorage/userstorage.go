@@ -2,12 +2,15 @@ package userstorage
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/pgdb"
+	"github.com/valinurovdenis/gomart/internal/app/rbac"
 )
 
 type LoginPassword struct {
@@ -20,72 +23,160 @@ type UserStorage interface {
 	AddUser(context context.Context, user LoginPassword) error
 
 	GetUserPassword(context context.Context, login string) (string, error)
+
+	// SetPassword replaces password of user and gives the user new token version revoking issued tokens.
+	SetPassword(context context.Context, login string, password string) error
+
+	// GetTokenVersion returns version tokens of user must have to be accepted, versions are unique
+	// among all users so that tokens of deleted user are not accepted for new user of the same login.
+	GetTokenVersion(context context.Context, login string) (int, error)
+
+	GetRole(context context.Context, login string) (rbac.Role, error)
+
+	// SetRole changes role of user and gives the user new token version, so that tokens with the old role are revoked.
+	SetRole(context context.Context, login string, role rbac.Role) error
 }
 
 type UserBalance struct {
+	Program   string                          `json:"program"`
 	Current   currencybalance.CurrencyBalance `json:"current"`
 	Withdrawn currencybalance.CurrencyBalance `json:"withdrawn"`
 }
 
 //go:generate mockery --name BalanceStorage
 type BalanceStorage interface {
-	GetBalance(context context.Context, login string) (UserBalance, error)
+	GetBalance(context context.Context, login string, program string) (UserBalance, error)
+
+	// LockBalance returns balance and locks it until the end of the surrounding transaction.
+	LockBalance(context context.Context, login string, program string) (UserBalance, error)
 
-	AddBalance(context context.Context, login string, addBalance currencybalance.CurrencyBalance) error
+	GetBalances(context context.Context, login string) ([]UserBalance, error)
+
+	AddBalance(context context.Context, login string, program string, addBalance currencybalance.CurrencyBalance) error
 
 	SetBalance(context context.Context, login string, newBalance UserBalance) error
+
+	// AddWithdrawn moves amount from current balance to withdrawn, negative amount moves it back.
+	AddWithdrawn(context context.Context, login string, program string, amount currencybalance.CurrencyBalance) error
 }
 
 type DatabaseUserStorage struct {
-	DB *sql.DB
+	Pool *pgxpool.Pool
 }
 
 func (s *DatabaseUserStorage) Init() error {
-	tx, err := s.DB.BeginTx(context.Background(), nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-	tx.Exec(`CREATE TABLE IF NOT EXISTS users("login" TEXT, "password" TEXT, "balance" BIGINT DEFAULT 0, "withdrawn" BIGINT DEFAULT 0)`)
-	tx.Exec(`CREATE UNIQUE INDEX users_index ON users USING btree(login)`)
-	return tx.Commit()
+	return pgdb.ExecBatch(context.Background(), s.Pool,
+		`CREATE TABLE IF NOT EXISTS users("login" TEXT, "password" TEXT, "balance" BIGINT DEFAULT 0, "withdrawn" BIGINT DEFAULT 0)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS users_index ON users USING btree(login)`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS "token_version" INT DEFAULT 0`,
+		`CREATE SEQUENCE IF NOT EXISTS token_versions AS INT`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS "role" TEXT DEFAULT 'user'`,
+		`CREATE TABLE IF NOT EXISTS balances("login" TEXT, "program" TEXT, "balance" BIGINT DEFAULT 0, "withdrawn" BIGINT DEFAULT 0, PRIMARY KEY("login", "program"))`,
+	)
 }
 
 var ErrLoginExists = errors.New("conflicting login")
+var ErrUserNotFound = errors.New("user not found")
 
 func (s *DatabaseUserStorage) AddUser(ctx context.Context, user LoginPassword) error {
-	_, err := s.DB.ExecContext(ctx, "INSERT into users (login, password, balance) VALUES ($1, $2, $3)", user.Login, user.Password, 0)
-	if e, ok := err.(*pgconn.PgError); ok && e.Code == pgerrcode.UniqueViolation {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, "INSERT into users (login, password, balance, token_version) VALUES ($1, $2, $3, nextval('token_versions'))", user.Login, user.Password, 0)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
 		err = ErrLoginExists
 	}
 	return err
 }
 
 func (s *DatabaseUserStorage) GetUserPassword(ctx context.Context, login string) (string, error) {
-	row := s.DB.QueryRowContext(ctx,
+	row := pgdb.Conn(ctx, s.Pool).QueryRow(ctx,
 		"SELECT password FROM users WHERE login = $1", login)
 	var password string
 	err := row.Scan(&password)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
 	if err != nil {
 		return "", err
 	}
 	return password, nil
 }
 
-func (s *DatabaseUserStorage) GetBalance(ctx context.Context, login string) (UserBalance, error) {
-	row := s.DB.QueryRowContext(ctx,
-		"SELECT balance, withdrawn FROM users WHERE login = $1", login)
-	var balance UserBalance
+func (s *DatabaseUserStorage) SetPassword(ctx context.Context, login string, password string) error {
+	tag, err := pgdb.Conn(ctx, s.Pool).Exec(ctx,
+		"UPDATE users SET password=$2, token_version=nextval('token_versions') WHERE login=$1", login, password)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func (s *DatabaseUserStorage) GetTokenVersion(ctx context.Context, login string) (int, error) {
+	var version int
+	err := pgdb.Conn(ctx, s.Pool).QueryRow(ctx,
+		"SELECT token_version FROM users WHERE login = $1", login).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrUserNotFound
+	}
+	return version, err
+}
+
+func (s *DatabaseUserStorage) GetRole(ctx context.Context, login string) (rbac.Role, error) {
+	var role rbac.Role
+	err := pgdb.Conn(ctx, s.Pool).QueryRow(ctx,
+		"SELECT role FROM users WHERE login = $1", login).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	return role, err
+}
+
+func (s *DatabaseUserStorage) SetRole(ctx context.Context, login string, role rbac.Role) error {
+	tag, err := pgdb.Conn(ctx, s.Pool).Exec(ctx,
+		"UPDATE users SET role=$2, token_version=nextval('token_versions') WHERE login=$1", login, role)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func (s *DatabaseUserStorage) GetBalance(ctx context.Context, login string, program string) (UserBalance, error) {
+	return s.getBalance(ctx, "SELECT balance, withdrawn FROM balances WHERE login = $1 AND program = $2", login, program)
+}
+
+func (s *DatabaseUserStorage) LockBalance(ctx context.Context, login string, program string) (UserBalance, error) {
+	return s.getBalance(ctx, "SELECT balance, withdrawn FROM balances WHERE login = $1 AND program = $2 FOR UPDATE", login, program)
+}
+
+func (s *DatabaseUserStorage) getBalance(ctx context.Context, query string, login string, program string) (UserBalance, error) {
+	row := pgdb.Conn(ctx, s.Pool).QueryRow(ctx, query, login, program)
+	balance := UserBalance{Program: program}
 	err := row.Scan(&balance.Current.Balance, &balance.Withdrawn.Balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return balance, nil
+	}
 	if err != nil {
 		return UserBalance{}, err
 	}
 	return balance, nil
 }
 
-func (s *DatabaseUserStorage) AddBalance(ctx context.Context, login string, addBalance currencybalance.CurrencyBalance) error {
-	_, err := s.DB.ExecContext(ctx, "UPDATE users SET balance=balance+$1 WHERE login=$2",
-		addBalance.Balance, login)
+func (s *DatabaseUserStorage) GetBalances(ctx context.Context, login string) ([]UserBalance, error) {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx,
+		"SELECT program, balance, withdrawn FROM balances WHERE login = $1 ORDER BY program", login)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (UserBalance, error) {
+		var balance UserBalance
+		err := row.Scan(&balance.Program, &balance.Current.Balance, &balance.Withdrawn.Balance)
+		return balance, err
+	})
+}
+
+func (s *DatabaseUserStorage) AddBalance(ctx context.Context, login string, program string, addBalance currencybalance.CurrencyBalance) error {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, `INSERT INTO balances (login, program, balance) VALUES ($1, $2, $3)
+		ON CONFLICT (login, program) DO UPDATE SET balance=balances.balance+EXCLUDED.balance`,
+		login, program, addBalance.Balance)
 	if err != nil {
 		return err
 	}
@@ -93,16 +184,44 @@ func (s *DatabaseUserStorage) AddBalance(ctx context.Context, login string, addB
 }
 
 func (s *DatabaseUserStorage) SetBalance(ctx context.Context, login string, newBalance UserBalance) error {
-	_, err := s.DB.ExecContext(ctx, "UPDATE users SET balance=$1, withdrawn=$2 WHERE login=$3",
-		newBalance.Current.Balance, newBalance.Withdrawn.Balance, login)
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, `INSERT INTO balances (login, program, balance, withdrawn) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (login, program) DO UPDATE SET balance=EXCLUDED.balance, withdrawn=EXCLUDED.withdrawn`,
+		login, newBalance.Program, newBalance.Current.Balance, newBalance.Withdrawn.Balance)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func NewDatabaseUserStorage(db *sql.DB) *DatabaseUserStorage {
-	ret := &DatabaseUserStorage{DB: db}
+func (s *DatabaseUserStorage) AddWithdrawn(ctx context.Context, login string, program string, amount currencybalance.CurrencyBalance) error {
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, `INSERT INTO balances (login, program, balance, withdrawn) VALUES ($1, $2, -$3::BIGINT, $3)
+		ON CONFLICT (login, program) DO UPDATE SET balance=balances.balance-EXCLUDED.withdrawn, withdrawn=balances.withdrawn+EXCLUDED.withdrawn`,
+		login, program, amount.Balance)
+	return err
+}
+
+// MigrateLegacyBalances moves balances kept in users table into program balances and assigns
+// the program to orders processed and withdrawals made before programs, it runs after orders
+// and withdraw tables are created.
+func (s *DatabaseUserStorage) MigrateLegacyBalances(ctx context.Context, program string) error {
+	return pgdb.WithTx(ctx, s.Pool, func(ctx context.Context) error {
+		tx := pgdb.Conn(ctx, s.Pool)
+		if _, err := tx.Exec(ctx, `INSERT INTO balances (login, program, balance, withdrawn)
+			SELECT login, $1, balance, withdrawn FROM users WHERE balance != 0 OR withdrawn != 0
+			ON CONFLICT (login, program) DO UPDATE SET balance=balances.balance+EXCLUDED.balance, withdrawn=balances.withdrawn+EXCLUDED.withdrawn`,
+			program); err != nil {
+			return err
+		}
+		batch := &pgx.Batch{}
+		batch.Queue("UPDATE users SET balance=0, withdrawn=0 WHERE balance != 0 OR withdrawn != 0")
+		batch.Queue("UPDATE orders SET program=$1 WHERE program IS NULL AND status='PROCESSED'", program)
+		batch.Queue("UPDATE withdraw SET program=$1 WHERE program IS NULL", program)
+		return tx.SendBatch(ctx, batch).Close()
+	})
+}
+
+func NewDatabaseUserStorage(pool *pgxpool.Pool) *DatabaseUserStorage {
+	ret := &DatabaseUserStorage{Pool: pool}
 	ret.Init()
 	return ret
 }
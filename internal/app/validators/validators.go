@@ -1,13 +1,71 @@
 package validators
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
+	"unicode"
 
 	"github.com/phedde/luhn-algorithm"
+	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
 )
 
 var ErrInvalidOrder = errors.New("invalid order")
+var ErrInvalidJSON = errors.New("invalid json body")
+var ErrBodyTooLarge = errors.New("request body too large")
+
+const (
+	minLoginLength    = 3
+	maxLoginLength    = 64
+	minPasswordLength = 8
+	maxPasswordLength = 128
+	minPasswordKinds  = 2
+)
+
+var loginRegexp = regexp.MustCompile(`^[a-zA-Z0-9._@-]+$`)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fieldErr := range e.Errors {
+		messages = append(messages, fmt.Sprintf("%s: %s", fieldErr.Field, fieldErr.Message))
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Add(field string, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: message})
+}
+
+func (e *ValidationError) OrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+func NewFieldError(field string, message string) *ValidationError {
+	return &ValidationError{Errors: []FieldError{{Field: field, Message: message}}}
+}
+
+type Limits struct {
+	MaxWithdraw    int64
+	MaxBodySize    int64
+	MaxBatchOrders int
+}
 
 func OrderIsValid(number string) error {
 	numberInt, err := strconv.ParseInt(string(number), 10, 64)
@@ -16,3 +74,186 @@ func OrderIsValid(number string) error {
 	}
 	return nil
 }
+
+// ParseOrderNumbers reads order numbers from a json array of strings or numbers,
+// or from a newline separated list if mediaType is not json. Numbers are not validated.
+func ParseOrderNumbers(mediaType string, body []byte, max int) ([]string, error) {
+	var numbers []string
+	if mediaType == "application/json" {
+		var values []json.RawMessage
+		if err := json.Unmarshal(body, &values); err != nil {
+			return nil, NewFieldError("orders", "must be an array of order numbers")
+		}
+		for _, value := range values {
+			var number string
+			if err := json.Unmarshal(value, &number); err != nil {
+				var numeric json.Number
+				if err = json.Unmarshal(value, &numeric); err != nil {
+					return nil, NewFieldError("orders", "must be an array of order numbers")
+				}
+				number = numeric.String()
+			}
+			numbers = append(numbers, number)
+		}
+	} else {
+		for _, line := range strings.Split(string(body), "\n") {
+			if number := strings.TrimSpace(line); number != "" {
+				numbers = append(numbers, number)
+			}
+		}
+	}
+	if len(numbers) == 0 {
+		return nil, NewFieldError("orders", "must not be empty")
+	}
+	if max > 0 && len(numbers) > max {
+		return nil, NewFieldError("orders", fmt.Sprintf("must contain at most %d numbers", max))
+	}
+	return numbers, nil
+}
+
+func loginIsValid(login string) string {
+	if len(login) < minLoginLength || len(login) > maxLoginLength {
+		return fmt.Sprintf("must be between %d and %d characters", minLoginLength, maxLoginLength)
+	}
+	if !loginRegexp.MatchString(login) {
+		return "may contain only latin letters, digits and . _ @ -"
+	}
+	return ""
+}
+
+func passwordIsValid(password string) string {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return fmt.Sprintf("must be between %d and %d characters", minPasswordLength, maxPasswordLength)
+	}
+	var lower, upper, digit, other bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	kinds := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			kinds++
+		}
+	}
+	if kinds < minPasswordKinds {
+		return fmt.Sprintf("must contain at least %d of: lowercase, uppercase, digits, symbols", minPasswordKinds)
+	}
+	return ""
+}
+
+// PasswordIsValid checks new password sent in field other than "password".
+func PasswordIsValid(field string, password string) error {
+	if msg := passwordIsValid(password); msg != "" {
+		return NewFieldError(field, msg)
+	}
+	return nil
+}
+
+func CredentialsAreValid(login string, password string) error {
+	validationErr := &ValidationError{}
+	if msg := loginIsValid(login); msg != "" {
+		validationErr.Add("login", msg)
+	}
+	if msg := passwordIsValid(password); msg != "" {
+		validationErr.Add("password", msg)
+	}
+	return validationErr.OrNil()
+}
+
+// ParseAmount converts a json number to minor units checking it is positive,
+// has at most two decimals and does not exceed max (if max is positive).
+func ParseAmount(field string, amount json.Number, max int64) (int64, error) {
+	value, err := currencybalance.Parse(amount.String(), currencybalance.RoundExact)
+	if errors.Is(err, currencybalance.ErrTooPrecise) {
+		return 0, NewFieldError(field, fmt.Sprintf("must have at most %d decimal places", currencybalance.Precision))
+	} else if errors.Is(err, currencybalance.ErrOverflow) {
+		return 0, NewFieldError(field, "is too large")
+	} else if err != nil {
+		return 0, NewFieldError(field, "must be a number")
+	}
+	if value.Balance <= 0 {
+		return 0, NewFieldError(field, "must be greater than zero")
+	}
+	maxBalance := currencybalance.CurrencyBalance{Balance: max}
+	if max > 0 && maxBalance.Less(value) {
+		return 0, NewFieldError(field, "must not exceed "+maxBalance.String())
+	}
+	return value.Balance, nil
+}
+
+// DecodeJSON strictly decodes a single json object from body into v.
+func DecodeJSON(body io.Reader, v any) error {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return decodeError(err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("%w: body must contain a single json object", ErrInvalidJSON)
+	}
+	return nil
+}
+
+func decodeError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return ErrBodyTooLarge
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return NewFieldError(typeErr.Field, "has invalid type "+typeErr.Value)
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return NewFieldError(strings.Trim(field, `"`), "unknown field")
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidJSON, err.Error())
+}
+
+// ReadBody reads the whole body translating body size overflow into ErrBodyTooLarge.
+func ReadBody(body io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, decodeError(err)
+	}
+	return data, nil
+}
+
+func WriteError(w http.ResponseWriter, err error, status int) {
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(validationErr)
+}
+
+// ErrorStatus returns status for request decoding and validation errors.
+func ErrorStatus(err error) int {
+	if errors.Is(err, ErrBodyTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func LimitBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maxBytes > 0 && r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package validators
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialsAreValid(t *testing.T) {
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		fields   []string
+	}{
+		{name: "valid", login: "user.name", password: "Passw0rdA", fields: nil},
+		{name: "empty", login: "", password: "", fields: []string{"login", "password"}},
+		{name: "bad login chars", login: "us er", password: "Passw0rdA", fields: []string{"login"}},
+		{name: "short password", login: "user", password: "Pa0", fields: []string{"password"}},
+		{name: "weak password", login: "user", password: "aaaaaaaaaa", fields: []string{"password"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CredentialsAreValid(tt.login, tt.password)
+			if tt.fields == nil {
+				require.NoError(t, err)
+				return
+			}
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			var fields []string
+			for _, fieldErr := range validationErr.Errors {
+				fields = append(fields, fieldErr.Field)
+			}
+			require.Equal(t, tt.fields, fields)
+		})
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount string
+		max    int64
+		want   int64
+		err    bool
+	}{
+		{name: "integer", amount: "751", want: 75100},
+		{name: "cents", amount: "0.29", want: 29},
+		{name: "one decimal", amount: "1.5", want: 150},
+		{name: "zero", amount: "0", err: true},
+		{name: "negative", amount: "-5", err: true},
+		{name: "fractional cents", amount: "1.005", err: true},
+		{name: "exponent", amount: "1e3", want: 100000},
+		{name: "not a number", amount: "abc", err: true},
+		{name: "above max", amount: "100.01", max: 10000, err: true},
+		{name: "equals max", amount: "100", max: 10000, want: 10000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAmount("sum", json.Number(tt.amount), tt.max)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	type payload struct {
+		Login string `json:"login"`
+	}
+	tests := []struct {
+		name string
+		body string
+		err  bool
+	}{
+		{name: "valid", body: `{"login":"a"}`},
+		{name: "unknown field", body: `{"login":"a","admin":true}`, err: true},
+		{name: "two objects", body: `{"login":"a"}{"login":"b"}`, err: true},
+		{name: "wrong type", body: `{"login":1}`, err: true},
+		{name: "malformed", body: `{"login":`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p payload
+			err := DecodeJSON(strings.NewReader(tt.body), &p)
+			if tt.err {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestParseOrderNumbers(t *testing.T) {
+	tests := []struct {
+		name      string
+		mediaType string
+		body      string
+		max       int
+		want      []string
+		err       bool
+	}{
+		{name: "json strings", mediaType: "application/json", body: `["12345678903", "79927398713"]`, want: []string{"12345678903", "79927398713"}},
+		{name: "json numbers", mediaType: "application/json", body: `[12345678903]`, want: []string{"12345678903"}},
+		{name: "json object", mediaType: "application/json", body: `{"order":"1"}`, err: true},
+		{name: "json nested", mediaType: "application/json", body: `[["1"]]`, err: true},
+		{name: "lines", mediaType: "text/plain", body: "12345678903\r\n\n 79927398713 \n", want: []string{"12345678903", "79927398713"}},
+		{name: "empty", mediaType: "text/plain", body: "\n", err: true},
+		{name: "too many", mediaType: "text/plain", body: "1\n2\n3", max: 2, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOrderNumbers(tt.mediaType, []byte(tt.body), tt.max)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+const dialTimeout = 30 * time.Second
+
+// reservedPrefixes are special purpose networks not reported by the net.IP helpers.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// checkAddress rejects addresses of the host and its networks so webhooks cannot reach internal services,
+// IPv4 addresses mapped to IPv6 are checked as IPv4 ones.
+func checkAddress(ip net.IP) error {
+	address, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return ErrPrivateAddress
+	}
+	address = address.Unmap()
+	if address.IsUnspecified() || address.IsLoopback() || address.IsPrivate() || address.IsLinkLocalUnicast() ||
+		address.IsLinkLocalMulticast() || address.IsInterfaceLocalMulticast() || address.IsMulticast() {
+		return ErrPrivateAddress
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(address) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// checkHost resolves host and rejects it if any of its addresses is not public.
+func checkHost(ctx context.Context, host string) error {
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		if err = checkAddress(address.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewClient returns client delivering webhooks only to public addresses, the address is checked
+// after resolution on every dial so that changed DNS records are caught too. Redirects are not followed.
+func NewClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: dialTimeout,
+		Control: func(network string, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			return checkAddress(net.ParseIP(host))
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
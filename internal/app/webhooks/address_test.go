@@ -0,0 +1,29 @@
+package webhooks_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/memstorage"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+	"github.com/valinurovdenis/gomart/internal/app/webhooks"
+)
+
+func TestSubscribeRejectsNonPublicAddresses(t *testing.T) {
+	ctx := context.Background()
+	service := webhooks.NewWebhookService(memstorage.NewMemoryStorage(clock.RealClock{}))
+
+	for _, host := range []string{
+		"127.0.0.1", "10.0.0.1", "169.254.169.254", "0.1.2.3", "100.64.0.1", "192.0.0.8", "198.18.0.1",
+		"[::1]", "[fd00::1]", "[::ffff:10.0.0.1]", "[::ffff:127.0.0.1]", "[64:ff9b::a00:1]",
+	} {
+		_, err := service.Subscribe(ctx, "user", "http://"+host+"/hook", nil)
+		var validationErr *validators.ValidationError
+		require.ErrorAs(t, err, &validationErr, host)
+	}
+
+	_, err := service.Subscribe(ctx, "user", "http://203.0.113.10/hook", nil)
+	require.NoError(t, err)
+}
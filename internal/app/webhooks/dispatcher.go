@@ -0,0 +1,192 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/jobqueue"
+	"github.com/valinurovdenis/gomart/internal/app/logger"
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"go.uber.org/zap"
+)
+
+const queueName = "webhook_deliveries"
+
+const (
+	SignatureHeader = "X-Gophermart-Signature"
+	TimestampHeader = "X-Gophermart-Timestamp"
+	EventHeader     = "X-Gophermart-Event"
+	DeliveryHeader  = "X-Gophermart-Delivery"
+)
+
+type DeliveryJob struct {
+	SubscriptionID int64        `json:"subscription_id"`
+	Event          outbox.Event `json:"event"`
+	Attempt        int          `json:"attempt"`
+}
+
+func (j DeliveryJob) Metadata() map[string]string {
+	return map[string]string{"subscription": strconv.FormatInt(j.SubscriptionID, 10), "event": strconv.FormatInt(j.Event.ID, 10)}
+}
+
+type DeliveryQueue = jobqueue.Queue[DeliveryJob]
+
+func NewPgqDeliveryQueue(db *sql.DB) *jobqueue.PgqQueue[DeliveryJob] {
+	return jobqueue.NewPgqQueue[DeliveryJob](db, queueName)
+}
+
+func NewMemoryDeliveryQueue() *jobqueue.MemoryQueue[DeliveryJob] {
+	return jobqueue.NewMemoryQueue[DeliveryJob]()
+}
+
+type DispatcherSettings struct {
+	Timeout time.Duration
+	// MaxAttempts is the number of delivery attempts of a single event.
+	MaxAttempts int
+	// Backoff is the delay before the second attempt, doubled for every next one.
+	Backoff time.Duration
+	// DisableAfter consecutive failed attempts subscription is disabled.
+	DisableAfter int
+}
+
+// Dispatcher is an outbox sink fanning events out to subscribed endpoints through delivery queue.
+type Dispatcher struct {
+	Storage  WebhookStorage
+	Queue    DeliveryQueue
+	Client   *http.Client
+	Clock    clock.Clock
+	Settings DispatcherSettings
+	Stop     func()
+}
+
+func (d *Dispatcher) Publish(ctx context.Context, event outbox.Event) error {
+	subscriptions, err := d.Storage.GetActiveSubscriptions(ctx, event.Login, event.Type)
+	if err != nil {
+		return err
+	}
+	for _, subscription := range subscriptions {
+		job := DeliveryJob{SubscriptionID: subscription.ID, Event: event, Attempt: 1}
+		if err = d.Queue.Publish(ctx, job, d.Clock.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sign returns hex encoded HMAC-SHA256 of timestamp and body joined with a dot.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Dispatcher) send(ctx context.Context, subscription Subscription, event outbox.Event) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.Settings.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(d.Clock.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(event.Type))
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(event.ID, 10))
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(subscription.Secret, timestamp, body))
+	response, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	return response.StatusCode, nil
+}
+
+// HandleDelivery makes one delivery attempt scheduling the next one with backoff on failure.
+func (d *Dispatcher) HandleDelivery(ctx context.Context, job DeliveryJob) (bool, error) {
+	subscription, err := d.Storage.GetSubscription(ctx, job.SubscriptionID)
+	if errors.Is(err, ErrSubscriptionNotFound) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !subscription.Active {
+		return true, nil
+	}
+
+	started := d.Clock.Now()
+	statusCode, err := d.send(ctx, subscription, job.Event)
+	delivery := Delivery{
+		SubscriptionID: subscription.ID,
+		EventID:        job.Event.ID,
+		EventType:      job.Event.Type,
+		Attempt:        job.Attempt,
+		StatusCode:     statusCode,
+		DurationMs:     d.Clock.Now().Sub(started).Milliseconds(),
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	} else if !delivery.Succeeded() {
+		delivery.Error = "unexpected status " + strconv.Itoa(statusCode)
+	}
+	failures, err := d.Storage.RecordDelivery(ctx, delivery)
+	if err != nil {
+		return false, err
+	}
+	if delivery.Succeeded() {
+		return true, nil
+	}
+
+	if d.Settings.DisableAfter > 0 && failures >= d.Settings.DisableAfter {
+		logger.Log.Warn("disabling failing webhook", zap.Int64("subscription", subscription.ID), zap.Int("failures", failures))
+		return true, d.Storage.SetActive(ctx, subscription.ID, false)
+	}
+	if job.Attempt >= d.Settings.MaxAttempts {
+		return true, nil
+	}
+	next := job
+	next.Attempt++
+	backoff := d.Settings.Backoff << (job.Attempt - 1)
+	return true, d.Queue.Publish(ctx, next, d.Clock.Now().Add(backoff))
+}
+
+func (d *Dispatcher) runDeliveries(ctx context.Context, threads int) {
+	for i := 0; i < threads; i++ {
+		go func() {
+			if err := d.Queue.Consume(ctx, d.HandleDelivery); err != nil && ctx.Err() == nil {
+				logger.Log.Error("webhook delivery consumer stopped", zap.Error(err))
+			}
+		}()
+	}
+}
+
+func NewDispatcher(storage WebhookStorage, queue DeliveryQueue, clock clock.Clock, settings DispatcherSettings, threads int) *Dispatcher {
+	ctx, stop := context.WithCancel(context.Background())
+	ret := &Dispatcher{
+		Storage:  storage,
+		Queue:    queue,
+		Client:   NewClient(),
+		Clock:    clock,
+		Settings: settings,
+		Stop:     stop,
+	}
+	ret.runDeliveries(ctx, threads)
+	return ret
+}
@@ -0,0 +1,154 @@
+package webhooks_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/jobqueue"
+	"github.com/valinurovdenis/gomart/internal/app/memstorage"
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"github.com/valinurovdenis/gomart/internal/app/webhooks"
+)
+
+type scheduledJob struct {
+	job          webhooks.DeliveryJob
+	scheduledFor time.Time
+}
+
+type recordingQueue struct {
+	jobs []scheduledJob
+}
+
+func (q *recordingQueue) Publish(ctx context.Context, job webhooks.DeliveryJob, scheduledFor time.Time) error {
+	q.jobs = append(q.jobs, scheduledJob{job: job, scheduledFor: scheduledFor})
+	return nil
+}
+
+func (q *recordingQueue) PublishBatch(ctx context.Context, jobs []webhooks.DeliveryJob, scheduledFor time.Time) error {
+	for _, job := range jobs {
+		q.Publish(ctx, job, scheduledFor)
+	}
+	return nil
+}
+
+func (q *recordingQueue) Consume(ctx context.Context, handler jobqueue.Handler[webhooks.DeliveryJob]) error {
+	return nil
+}
+
+func newDispatcher(storage webhooks.WebhookStorage, queue *recordingQueue, now time.Time) *webhooks.Dispatcher {
+	return &webhooks.Dispatcher{
+		Storage:  storage,
+		Queue:    queue,
+		Client:   &http.Client{},
+		Clock:    &clock.FixedClock{Time: now},
+		Settings: webhooks.DispatcherSettings{Timeout: time.Second, MaxAttempts: 3, Backoff: time.Minute, DisableAfter: 4},
+	}
+}
+
+func TestDeliverySigned(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+	}))
+	defer server.Close()
+
+	storage := memstorage.NewMemoryStorage(&clock.FixedClock{Time: now})
+	subscription, err := storage.AddSubscription(ctx, webhooks.Subscription{Login: "user", URL: server.URL, Secret: "secret"})
+	require.NoError(t, err)
+	queue := &recordingQueue{}
+	dispatcher := newDispatcher(storage, queue, now)
+
+	event := outbox.Event{ID: 7, Type: outbox.OrderProcessed, Login: "user"}
+	require.NoError(t, dispatcher.Publish(ctx, event))
+	require.NoError(t, dispatcher.Publish(ctx, outbox.Event{ID: 8, Type: outbox.OrderProcessed, Login: "other"}))
+	require.Len(t, queue.jobs, 1)
+
+	done, err := dispatcher.HandleDelivery(ctx, queue.jobs[0].job)
+	require.NoError(t, err)
+	assert.True(t, done)
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	assert.Equal(t, timestamp, header.Get(webhooks.TimestampHeader))
+	assert.Equal(t, "sha256="+webhooks.Sign("secret", timestamp, body), header.Get(webhooks.SignatureHeader))
+	assert.Equal(t, "7", header.Get(webhooks.DeliveryHeader))
+
+	deliveries, err := storage.GetDeliveries(ctx, subscription.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.True(t, deliveries[0].Succeeded())
+}
+
+func TestDeliveryRetriesAndDisables(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	storage := memstorage.NewMemoryStorage(&clock.FixedClock{Time: now})
+	subscription, err := storage.AddSubscription(ctx, webhooks.Subscription{Login: "user", URL: server.URL, Secret: "secret"})
+	require.NoError(t, err)
+	queue := &recordingQueue{}
+	dispatcher := newDispatcher(storage, queue, now)
+
+	job := webhooks.DeliveryJob{SubscriptionID: subscription.ID, Event: outbox.Event{ID: 1, Type: outbox.BalanceCredited, Login: "user"}, Attempt: 1}
+	for attempt := 1; attempt <= 3; attempt++ {
+		job.Attempt = attempt
+		_, err = dispatcher.HandleDelivery(ctx, job)
+		require.NoError(t, err)
+	}
+	// the last attempt is not retried
+	require.Len(t, queue.jobs, 2)
+	assert.Equal(t, now.Add(time.Minute), queue.jobs[0].scheduledFor)
+	assert.Equal(t, 2, queue.jobs[0].job.Attempt)
+	assert.Equal(t, now.Add(2*time.Minute), queue.jobs[1].scheduledFor)
+
+	_, err = dispatcher.HandleDelivery(ctx, job)
+	require.NoError(t, err)
+	subscription, err = storage.GetSubscription(ctx, subscription.ID)
+	require.NoError(t, err)
+	assert.False(t, subscription.Active)
+
+	active, err := storage.GetActiveSubscriptions(ctx, "user", outbox.BalanceCredited)
+	require.NoError(t, err)
+	assert.Empty(t, active)
+}
+
+func TestDeliveryToPrivateAddress(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	storage := memstorage.NewMemoryStorage(&clock.FixedClock{Time: now})
+	subscription, err := storage.AddSubscription(ctx, webhooks.Subscription{Login: "user", URL: server.URL, Secret: "secret"})
+	require.NoError(t, err)
+	dispatcher := newDispatcher(storage, &recordingQueue{}, now)
+	dispatcher.Client = webhooks.NewClient()
+
+	job := webhooks.DeliveryJob{SubscriptionID: subscription.ID, Event: outbox.Event{ID: 1, Type: outbox.BalanceCredited, Login: "user"}, Attempt: 1}
+	_, err = dispatcher.HandleDelivery(ctx, job)
+	require.NoError(t, err)
+	assert.False(t, called)
+
+	deliveries, err := storage.GetDeliveries(ctx, subscription.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.False(t, deliveries[0].Succeeded())
+}
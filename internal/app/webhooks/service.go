@@ -0,0 +1,112 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+)
+
+const (
+	maxSubscriptions = 10
+	deliveriesLimit  = 100
+	secretBytes      = 32
+)
+
+var knownEvents = []outbox.EventType{
+	outbox.OrderProcessed, outbox.OrderStatusChanged, outbox.BalanceCredited, outbox.BalanceDebited,
+	outbox.WithdrawalCreated, outbox.WithdrawalReversed, outbox.PointsExpired,
+	outbox.UserLocked, outbox.UserLoginAnomaly,
+}
+
+// WebhookService manages subscriptions of a user, the secret is shown only on creation.
+type WebhookService struct {
+	Storage WebhookStorage
+}
+
+func validateSubscription(ctx context.Context, endpoint string, events []outbox.EventType) error {
+	validationErr := &validators.ValidationError{}
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		validationErr.Add("url", "must be an absolute http or https url")
+	} else if err = checkHost(ctx, parsed.Hostname()); errors.Is(err, ErrPrivateAddress) {
+		validationErr.Add("url", "must not point to a private network")
+	} else if err != nil {
+		validationErr.Add("url", "host cannot be resolved")
+	}
+	for _, event := range events {
+		known := false
+		for _, knownEvent := range knownEvents {
+			known = known || event == knownEvent
+		}
+		if !known {
+			validationErr.Add("events", "unknown event type "+string(event))
+		}
+	}
+	return validationErr.OrNil()
+}
+
+func (s *WebhookService) Subscribe(ctx context.Context, login string, endpoint string, events []outbox.EventType) (Subscription, error) {
+	if err := validateSubscription(ctx, endpoint, events); err != nil {
+		return Subscription{}, err
+	}
+	existing, err := s.Storage.GetSubscriptions(ctx, login)
+	if err != nil {
+		return Subscription{}, err
+	}
+	if len(existing) >= maxSubscriptions {
+		return Subscription{}, validators.NewFieldError("url", "too many webhook subscriptions")
+	}
+	secret := make([]byte, secretBytes)
+	if _, err = rand.Read(secret); err != nil {
+		return Subscription{}, err
+	}
+	subscription := Subscription{Login: login, URL: endpoint, Secret: hex.EncodeToString(secret), Events: events}
+	return s.Storage.AddSubscription(ctx, subscription)
+}
+
+func (s *WebhookService) GetSubscriptions(ctx context.Context, login string) ([]Subscription, error) {
+	subscriptions, err := s.Storage.GetSubscriptions(ctx, login)
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	return subscriptions, err
+}
+
+func (s *WebhookService) Unsubscribe(ctx context.Context, login string, id int64) error {
+	return s.Storage.DeleteSubscription(ctx, login, id)
+}
+
+func (s *WebhookService) getOwnSubscription(ctx context.Context, login string, id int64) (Subscription, error) {
+	subscription, err := s.Storage.GetSubscription(ctx, id)
+	if err != nil {
+		return Subscription{}, err
+	}
+	if subscription.Login != login {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	return subscription, nil
+}
+
+// Enable reactivates subscription disabled after failing deliveries.
+func (s *WebhookService) Enable(ctx context.Context, login string, id int64) error {
+	if _, err := s.getOwnSubscription(ctx, login, id); err != nil {
+		return err
+	}
+	return s.Storage.SetActive(ctx, id, true)
+}
+
+func (s *WebhookService) GetDeliveries(ctx context.Context, login string, id int64) ([]Delivery, error) {
+	if _, err := s.getOwnSubscription(ctx, login, id); err != nil {
+		return nil, err
+	}
+	return s.Storage.GetDeliveries(ctx, id, deliveriesLimit)
+}
+
+func NewWebhookService(storage WebhookStorage) *WebhookService {
+	return &WebhookService{Storage: storage}
+}
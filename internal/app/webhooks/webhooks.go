@@ -0,0 +1,205 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valinurovdenis/gomart/internal/app/outbox"
+	"github.com/valinurovdenis/gomart/internal/app/pgdb"
+)
+
+// Subscription is an endpoint receiving signed events of its owner,
+// empty Events means every event type.
+type Subscription struct {
+	ID       int64              `json:"id"`
+	Login    string             `json:"-"`
+	URL      string             `json:"url"`
+	Secret   string             `json:"secret,omitempty"`
+	Events   []outbox.EventType `json:"events"`
+	Active   bool               `json:"active"`
+	Failures int                `json:"consecutive_failures"`
+	Created  time.Time          `json:"created_at"`
+}
+
+func (s Subscription) Accepts(eventType outbox.EventType) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, accepted := range s.Events {
+		if accepted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type Delivery struct {
+	SubscriptionID int64            `json:"subscription_id"`
+	EventID        int64            `json:"event_id"`
+	EventType      outbox.EventType `json:"event_type"`
+	Attempt        int              `json:"attempt"`
+	StatusCode     int              `json:"status_code,omitempty"`
+	Error          string           `json:"error,omitempty"`
+	DurationMs     int64            `json:"duration_ms"`
+	Delivered      time.Time        `json:"delivered_at"`
+}
+
+func (d Delivery) Succeeded() bool {
+	return d.Error == "" && d.StatusCode >= 200 && d.StatusCode < 300
+}
+
+var ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+
+//go:generate mockery --name WebhookStorage
+type WebhookStorage interface {
+	AddSubscription(ctx context.Context, subscription Subscription) (Subscription, error)
+
+	GetSubscription(ctx context.Context, id int64) (Subscription, error)
+
+	GetSubscriptions(ctx context.Context, login string) ([]Subscription, error)
+
+	// GetActiveSubscriptions returns enabled subscriptions of user accepting event type.
+	GetActiveSubscriptions(ctx context.Context, login string, eventType outbox.EventType) ([]Subscription, error)
+
+	DeleteSubscription(ctx context.Context, login string, id int64) error
+
+	// SetActive enables or disables subscription resetting its failures counter.
+	SetActive(ctx context.Context, id int64, active bool) error
+
+	// RecordDelivery logs delivery attempt and returns consecutive failures of subscription.
+	RecordDelivery(ctx context.Context, delivery Delivery) (int, error)
+
+	GetDeliveries(ctx context.Context, subscriptionID int64, limit int) ([]Delivery, error)
+}
+
+type DatabaseWebhookStorage struct {
+	Pool *pgxpool.Pool
+}
+
+func (s *DatabaseWebhookStorage) Init() error {
+	return pgdb.ExecBatch(context.Background(), s.Pool,
+		`CREATE TABLE IF NOT EXISTS webhooks("id" BIGSERIAL PRIMARY KEY, "login" TEXT, "url" TEXT, "secret" TEXT, "events" TEXT[], "active" BOOLEAN DEFAULT TRUE, "failures" INT DEFAULT 0, "created" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP)`,
+		`CREATE INDEX IF NOT EXISTS user_webhooks_index ON webhooks USING btree(login)`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries("webhook_id" BIGINT, "event_id" BIGINT, "event_type" TEXT, "attempt" INT, "status_code" INT, "error" TEXT, "duration_ms" BIGINT, "delivered" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP)`,
+		`CREATE INDEX IF NOT EXISTS webhook_deliveries_index ON webhook_deliveries USING btree(webhook_id, delivered)`,
+	)
+}
+
+func eventTypes(events []outbox.EventType) []string {
+	res := make([]string, 0, len(events))
+	for _, event := range events {
+		res = append(res, string(event))
+	}
+	return res
+}
+
+const subscriptionColumns = "id, login, url, secret, events, active, failures, created"
+
+func scanSubscription(row pgx.CollectableRow) (Subscription, error) {
+	var subscription Subscription
+	var events []string
+	err := row.Scan(&subscription.ID, &subscription.Login, &subscription.URL, &subscription.Secret,
+		&events, &subscription.Active, &subscription.Failures, &subscription.Created)
+	for _, event := range events {
+		subscription.Events = append(subscription.Events, outbox.EventType(event))
+	}
+	return subscription, err
+}
+
+func (s *DatabaseWebhookStorage) AddSubscription(ctx context.Context, subscription Subscription) (Subscription, error) {
+	err := pgdb.Conn(ctx, s.Pool).QueryRow(ctx,
+		"INSERT INTO webhooks (login, url, secret, events) VALUES ($1, $2, $3, $4) RETURNING id, active, created",
+		subscription.Login, subscription.URL, subscription.Secret, eventTypes(subscription.Events)).
+		Scan(&subscription.ID, &subscription.Active, &subscription.Created)
+	return subscription, err
+}
+
+func (s *DatabaseWebhookStorage) GetSubscription(ctx context.Context, id int64) (Subscription, error) {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx, "SELECT "+subscriptionColumns+" FROM webhooks WHERE id=$1", id)
+	if err != nil {
+		return Subscription{}, err
+	}
+	subscription, err := pgx.CollectExactlyOneRow(rows, scanSubscription)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	return subscription, err
+}
+
+func (s *DatabaseWebhookStorage) GetSubscriptions(ctx context.Context, login string) ([]Subscription, error) {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx, "SELECT "+subscriptionColumns+" FROM webhooks WHERE login=$1 ORDER BY id", login)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanSubscription)
+}
+
+func (s *DatabaseWebhookStorage) GetActiveSubscriptions(ctx context.Context, login string, eventType outbox.EventType) ([]Subscription, error) {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx,
+		"SELECT "+subscriptionColumns+" FROM webhooks WHERE login=$1 AND active AND (cardinality(events)=0 OR $2=ANY(events)) ORDER BY id",
+		login, string(eventType))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanSubscription)
+}
+
+func (s *DatabaseWebhookStorage) DeleteSubscription(ctx context.Context, login string, id int64) error {
+	tag, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, "DELETE FROM webhooks WHERE login=$1 AND id=$2", login, id)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrSubscriptionNotFound
+	}
+	return err
+}
+
+func (s *DatabaseWebhookStorage) SetActive(ctx context.Context, id int64, active bool) error {
+	tag, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, "UPDATE webhooks SET active=$2, failures=0 WHERE id=$1", id, active)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrSubscriptionNotFound
+	}
+	return err
+}
+
+func (s *DatabaseWebhookStorage) RecordDelivery(ctx context.Context, delivery Delivery) (int, error) {
+	const recordQuery = `
+		WITH logged AS (
+			INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, attempt, status_code, error, duration_ms)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		)
+		UPDATE webhooks SET failures=CASE WHEN $8 THEN 0 ELSE failures+1 END
+			WHERE id=$1
+			RETURNING failures
+	`
+	var failures int
+	err := pgdb.Conn(ctx, s.Pool).QueryRow(ctx, recordQuery,
+		delivery.SubscriptionID, delivery.EventID, string(delivery.EventType), delivery.Attempt,
+		delivery.StatusCode, delivery.Error, delivery.DurationMs, delivery.Succeeded()).Scan(&failures)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrSubscriptionNotFound
+	}
+	return failures, err
+}
+
+func (s *DatabaseWebhookStorage) GetDeliveries(ctx context.Context, subscriptionID int64, limit int) ([]Delivery, error) {
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx,
+		`SELECT webhook_id, event_id, event_type, attempt, status_code, error, duration_ms, delivered
+		FROM webhook_deliveries WHERE webhook_id=$1 ORDER BY delivered DESC LIMIT $2`, subscriptionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Delivery, error) {
+		var delivery Delivery
+		err := row.Scan(&delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &delivery.Attempt,
+			&delivery.StatusCode, &delivery.Error, &delivery.DurationMs, &delivery.Delivered)
+		return delivery, err
+	})
+}
+
+func NewDatabaseWebhookStorage(pool *pgxpool.Pool) *DatabaseWebhookStorage {
+	ret := &DatabaseWebhookStorage{Pool: pool}
+	ret.Init()
+	return ret
+}
@@ -2,18 +2,32 @@ package withdrawstorage
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/valinurovdenis/gomart/internal/app/currencybalance"
+	"github.com/valinurovdenis/gomart/internal/app/pgdb"
+)
+
+type WithdrawStatus string
+
+const (
+	Done     WithdrawStatus = "DONE"
+	Reversed WithdrawStatus = "REVERSED"
 )
 
 type UserWithdraw struct {
-	Login     string
-	Number    string                          `json:"order"`
-	Withdraw  currencybalance.CurrencyBalance `json:"sum"`
-	Processed time.Time                       `json:"processed_at"`
+	ID            int64 `json:"id"`
+	Login         string
+	Number        string                          `json:"order"`
+	Program       string                          `json:"program,omitempty"`
+	Withdraw      currencybalance.CurrencyBalance `json:"sum"`
+	Processed     time.Time                       `json:"processed_at"`
+	Status        WithdrawStatus                  `json:"status"`
+	Reversed      *time.Time                      `json:"reversed_at,omitempty"`
+	ReverseReason string                          `json:"reverse_reason,omitempty"`
 }
 
 //go:generate mockery --name WithdrawRepository
@@ -21,74 +35,92 @@ type WithdrawRepository interface {
 	AddUserWithdraw(context context.Context, order UserWithdraw) error
 
 	GetUserWithdrawals(context context.Context, login string) ([]UserWithdraw, error)
+
+	ReverseUserWithdraw(context context.Context, id int64, reason string) (UserWithdraw, error)
 }
 
 type DatabaseWithdrawStorage struct {
-	DB *sql.DB
+	Pool *pgxpool.Pool
 }
 
 func (s *DatabaseWithdrawStorage) Init() error {
-	tx, err := s.DB.BeginTx(context.Background(), nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-	tx.Exec(`CREATE TABLE IF NOT EXISTS withdraw("login" TEXT, "number" BIGINT, "withdraw" BIGINT, "processed" TIMESTAMP DEFAULT CURRENT_TIMESTAMP)`)
-	tx.Exec(`CREATE INDEX user_withdraw_index ON orders USING btree(login)`)
-	return tx.Commit()
+	return pgdb.ExecBatch(context.Background(), s.Pool,
+		`CREATE TABLE IF NOT EXISTS withdraw("login" TEXT, "number" TEXT, "withdraw" BIGINT, "processed" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP)`,
+		pgdb.AlterColumnType("withdraw", "number", "text"),
+		pgdb.AlterColumnType("withdraw", "processed", "timestamp with time zone"),
+		`CREATE INDEX IF NOT EXISTS user_withdraw_index ON withdraw USING btree(login)`,
+		`ALTER TABLE withdraw ADD COLUMN IF NOT EXISTS "program" TEXT`,
+		`ALTER TABLE withdraw ADD COLUMN IF NOT EXISTS "id" BIGSERIAL`,
+		`ALTER TABLE withdraw ADD COLUMN IF NOT EXISTS "reversed" TIMESTAMPTZ`,
+		`ALTER TABLE withdraw ADD COLUMN IF NOT EXISTS "reverse_reason" TEXT`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS withdraw_id_index ON withdraw USING btree(id)`,
+	)
 }
 
 var ErrOrderExists = errors.New("conflicting order exists")
+var ErrWithdrawNotFound = errors.New("withdraw not found")
+var ErrAlreadyReversed = errors.New("withdraw has been already reversed")
 
 func (s *DatabaseWithdrawStorage) AddUserWithdraw(ctx context.Context, order UserWithdraw) error {
-	tx, err := s.DB.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-	const addWithdrawQuery = `
-		WITH new_withdraw AS (
-			INSERT INTO withdraw (login, number, withdraw) 
-			VALUES ($1, $2, $3)
-		)
-		UPDATE users
-			SET balance=balance-$3,
-				withdrawn=withdrawn+$3
-			WHERE login=$1
-	`
-	if _, err = tx.ExecContext(ctx, addWithdrawQuery,
-		order.Login, order.Number, order.Withdraw.Balance); err != nil {
-		return err
-	}
-	return tx.Commit()
+	_, err := pgdb.Conn(ctx, s.Pool).Exec(ctx, "INSERT INTO withdraw (login, number, program, withdraw) VALUES ($1, $2, $3, $4)",
+		order.Login, order.Number, order.Program, order.Withdraw.Balance)
+	return err
 }
 
 func (s *DatabaseWithdrawStorage) GetUserWithdrawals(ctx context.Context, login string) ([]UserWithdraw, error) {
-	var res []UserWithdraw
-	rows, err := s.DB.QueryContext(ctx,
-		"SELECT login, number, withdraw, processed FROM withdraw WHERE login = $1", login)
+	rows, err := pgdb.Conn(ctx, s.Pool).Query(ctx,
+		`SELECT id, login, number, COALESCE(program, ''), withdraw, processed, reversed, COALESCE(reverse_reason, '')
+		FROM withdraw WHERE login = $1 ORDER BY processed DESC`, login)
 	if err != nil {
 		return nil, err
 	}
-	if rows.Err() != nil {
-		return nil, rows.Err()
-	}
-	defer rows.Close()
-	for rows.Next() {
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (UserWithdraw, error) {
 		var order UserWithdraw
-		err = rows.Scan(&order.Login, &order.Number, &order.Withdraw.Balance, &order.Processed)
-		if err != nil {
-			return nil, err
+		err := row.Scan(&order.ID, &order.Login, &order.Number, &order.Program, &order.Withdraw.Balance,
+			&order.Processed, &order.Reversed, &order.ReverseReason)
+		order.Status = Done
+		if order.Reversed != nil {
+			order.Status = Reversed
 		}
+		return order, err
+	})
+}
 
-		res = append(res, order)
-	}
+// ReverseUserWithdraw marks withdraw reversed, crediting the sum back is left to the caller.
+func (s *DatabaseWithdrawStorage) ReverseUserWithdraw(ctx context.Context, id int64, reason string) (UserWithdraw, error) {
+	withdraw := UserWithdraw{ID: id, Status: Reversed, ReverseReason: reason}
+	err := pgdb.WithTx(ctx, s.Pool, func(ctx context.Context) error {
+		tx := pgdb.Conn(ctx, s.Pool)
+		var alreadyReversed bool
+		err := tx.QueryRow(ctx,
+			`SELECT login, number, COALESCE(program, ''), withdraw, processed, reversed IS NOT NULL FROM withdraw WHERE id=$1 FOR UPDATE`, id).
+			Scan(&withdraw.Login, &withdraw.Number, &withdraw.Program, &withdraw.Withdraw.Balance, &withdraw.Processed, &alreadyReversed)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrWithdrawNotFound
+		} else if err != nil {
+			return err
+		}
+		if alreadyReversed {
+			return ErrAlreadyReversed
+		}
 
-	return res, nil
+		var reversed time.Time
+		if err = tx.QueryRow(ctx,
+			"UPDATE withdraw SET reversed=CURRENT_TIMESTAMP, reverse_reason=$2 WHERE id=$1 RETURNING reversed",
+			id, reason).Scan(&reversed); err != nil {
+			return err
+		}
+		withdraw.Reversed = &reversed
+		return nil
+	})
+	if err != nil {
+		return UserWithdraw{}, err
+	}
+	return withdraw, nil
 }
 
-func NewDatabaseWithdrawStorage(db *sql.DB) *DatabaseWithdrawStorage {
-	ret := &DatabaseWithdrawStorage{DB: db}
+func NewDatabaseWithdrawStorage(pool *pgxpool.Pool) *DatabaseWithdrawStorage {
+	ret := &DatabaseWithdrawStorage{Pool: pool}
 	ret.Init()
 	return ret
 }
@@ -15,6 +15,24 @@ type AccrualOrderService struct {
 	mock.Mock
 }
 
+// EnqueueNewOrders provides a mock function with given fields: ctx, login, numbers
+func (_m *AccrualOrderService) EnqueueNewOrders(ctx context.Context, login string, numbers []string) error {
+	ret := _m.Called(ctx, login, numbers)
+
+	if len(ret) == 0 {
+		panic("no return value specified for EnqueueNewOrders")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) error); ok {
+		r0 = rf(ctx, login, numbers)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // EnqueueOrderUpdate provides a mock function with given fields: _a0, login, number
 func (_m *AccrualOrderService) EnqueueOrderUpdate(_a0 context.Context, login string, number string) error {
 	ret := _m.Called(_a0, login, number)
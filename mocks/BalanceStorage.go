@@ -7,7 +7,6 @@ import (
 
 	mock "github.com/stretchr/testify/mock"
 	currencybalance "github.com/valinurovdenis/gomart/internal/app/currencybalance"
-
 	userstorage "github.com/valinurovdenis/gomart/internal/app/userstorage"
 )
 
@@ -16,17 +15,17 @@ type BalanceStorage struct {
 	mock.Mock
 }
 
-// AddBalance provides a mock function with given fields: _a0, login, addBalance
-func (_m *BalanceStorage) AddBalance(_a0 context.Context, login string, addBalance currencybalance.CurrencyBalance) error {
-	ret := _m.Called(_a0, login, addBalance)
+// AddBalance provides a mock function with given fields: _a0, login, program, addBalance
+func (_m *BalanceStorage) AddBalance(_a0 context.Context, login string, program string, addBalance currencybalance.CurrencyBalance) error {
+	ret := _m.Called(_a0, login, program, addBalance)
 
 	if len(ret) == 0 {
 		panic("no return value specified for AddBalance")
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, currencybalance.CurrencyBalance) error); ok {
-		r0 = rf(_a0, login, addBalance)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, currencybalance.CurrencyBalance) error); ok {
+		r0 = rf(_a0, login, program, addBalance)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -34,9 +33,27 @@ func (_m *BalanceStorage) AddBalance(_a0 context.Context, login string, addBalan
 	return r0
 }
 
-// GetBalance provides a mock function with given fields: _a0, login
-func (_m *BalanceStorage) GetBalance(_a0 context.Context, login string) (userstorage.UserBalance, error) {
-	ret := _m.Called(_a0, login)
+// AddWithdrawn provides a mock function with given fields: _a0, login, program, amount
+func (_m *BalanceStorage) AddWithdrawn(_a0 context.Context, login string, program string, amount currencybalance.CurrencyBalance) error {
+	ret := _m.Called(_a0, login, program, amount)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddWithdrawn")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, currencybalance.CurrencyBalance) error); ok {
+		r0 = rf(_a0, login, program, amount)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetBalance provides a mock function with given fields: _a0, login, program
+func (_m *BalanceStorage) GetBalance(_a0 context.Context, login string, program string) (userstorage.UserBalance, error) {
+	ret := _m.Called(_a0, login, program)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetBalance")
@@ -44,13 +61,43 @@ func (_m *BalanceStorage) GetBalance(_a0 context.Context, login string) (usersto
 
 	var r0 userstorage.UserBalance
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) (userstorage.UserBalance, error)); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (userstorage.UserBalance, error)); ok {
+		return rf(_a0, login, program)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) userstorage.UserBalance); ok {
+		r0 = rf(_a0, login, program)
+	} else {
+		r0 = ret.Get(0).(userstorage.UserBalance)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(_a0, login, program)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetBalances provides a mock function with given fields: _a0, login
+func (_m *BalanceStorage) GetBalances(_a0 context.Context, login string) ([]userstorage.UserBalance, error) {
+	ret := _m.Called(_a0, login)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetBalances")
+	}
+
+	var r0 []userstorage.UserBalance
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]userstorage.UserBalance, error)); ok {
 		return rf(_a0, login)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string) userstorage.UserBalance); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, string) []userstorage.UserBalance); ok {
 		r0 = rf(_a0, login)
 	} else {
-		r0 = ret.Get(0).(userstorage.UserBalance)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]userstorage.UserBalance)
+		}
 	}
 
 	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
@@ -62,6 +109,34 @@ func (_m *BalanceStorage) GetBalance(_a0 context.Context, login string) (usersto
 	return r0, r1
 }
 
+// LockBalance provides a mock function with given fields: _a0, login, program
+func (_m *BalanceStorage) LockBalance(_a0 context.Context, login string, program string) (userstorage.UserBalance, error) {
+	ret := _m.Called(_a0, login, program)
+
+	if len(ret) == 0 {
+		panic("no return value specified for LockBalance")
+	}
+
+	var r0 userstorage.UserBalance
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (userstorage.UserBalance, error)); ok {
+		return rf(_a0, login, program)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) userstorage.UserBalance); ok {
+		r0 = rf(_a0, login, program)
+	} else {
+		r0 = ret.Get(0).(userstorage.UserBalance)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(_a0, login, program)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // SetBalance provides a mock function with given fields: _a0, login, newBalance
 func (_m *BalanceStorage) SetBalance(_a0 context.Context, login string, newBalance userstorage.UserBalance) error {
 	ret := _m.Called(_a0, login, newBalance)
@@ -14,6 +14,24 @@ type OrderStorage struct {
 	mock.Mock
 }
 
+// AddAdjustment provides a mock function with given fields: ctx, adjustment
+func (_m *OrderStorage) AddAdjustment(ctx context.Context, adjustment orderstorage.Adjustment) error {
+	ret := _m.Called(ctx, adjustment)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddAdjustment")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, orderstorage.Adjustment) error); ok {
+		r0 = rf(ctx, adjustment)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // AddUserOrder provides a mock function with given fields: _a0, order
 func (_m *OrderStorage) AddUserOrder(_a0 context.Context, order orderstorage.UserOrder) error {
 	ret := _m.Called(_a0, order)
@@ -32,6 +50,122 @@ func (_m *OrderStorage) AddUserOrder(_a0 context.Context, order orderstorage.Use
 	return r0
 }
 
+// AddUserOrders provides a mock function with given fields: ctx, orders
+func (_m *OrderStorage) AddUserOrders(ctx context.Context, orders []orderstorage.UserOrder) ([]error, error) {
+	ret := _m.Called(ctx, orders)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddUserOrders")
+	}
+
+	var r0 []error
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []orderstorage.UserOrder) ([]error, error)); ok {
+		return rf(ctx, orders)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []orderstorage.UserOrder) []error); ok {
+		r0 = rf(ctx, orders)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]error)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []orderstorage.UserOrder) error); ok {
+		r1 = rf(ctx, orders)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetOrder provides a mock function with given fields: ctx, number
+func (_m *OrderStorage) GetOrder(ctx context.Context, number string) (orderstorage.UserOrder, error) {
+	ret := _m.Called(ctx, number)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetOrder")
+	}
+
+	var r0 orderstorage.UserOrder
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (orderstorage.UserOrder, error)); ok {
+		return rf(ctx, number)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) orderstorage.UserOrder); ok {
+		r0 = rf(ctx, number)
+	} else {
+		r0 = ret.Get(0).(orderstorage.UserOrder)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, number)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetOrderForUpdate provides a mock function with given fields: ctx, number
+func (_m *OrderStorage) GetOrderForUpdate(ctx context.Context, number string) (orderstorage.UserOrder, error) {
+	ret := _m.Called(ctx, number)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetOrderForUpdate")
+	}
+
+	var r0 orderstorage.UserOrder
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (orderstorage.UserOrder, error)); ok {
+		return rf(ctx, number)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) orderstorage.UserOrder); ok {
+		r0 = rf(ctx, number)
+	} else {
+		r0 = ret.Get(0).(orderstorage.UserOrder)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, number)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserAdjustments provides a mock function with given fields: ctx, login
+func (_m *OrderStorage) GetUserAdjustments(ctx context.Context, login string) ([]orderstorage.Adjustment, error) {
+	ret := _m.Called(ctx, login)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetUserAdjustments")
+	}
+
+	var r0 []orderstorage.Adjustment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]orderstorage.Adjustment, error)); ok {
+		return rf(ctx, login)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []orderstorage.Adjustment); ok {
+		r0 = rf(ctx, login)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]orderstorage.Adjustment)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, login)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetUserOrders provides a mock function with given fields: _a0, login
 func (_m *OrderStorage) GetUserOrders(_a0 context.Context, login string) ([]orderstorage.UserOrder, error) {
 	ret := _m.Called(_a0, login)
@@ -62,12 +196,12 @@ func (_m *OrderStorage) GetUserOrders(_a0 context.Context, login string) ([]orde
 	return r0, r1
 }
 
-// UpdateProcessedOrder provides a mock function with given fields: ctx, order
-func (_m *OrderStorage) UpdateProcessedOrder(ctx context.Context, order orderstorage.UserOrder) error {
+// UpdateOrder provides a mock function with given fields: ctx, order
+func (_m *OrderStorage) UpdateOrder(ctx context.Context, order orderstorage.UserOrder) error {
 	ret := _m.Called(ctx, order)
 
 	if len(ret) == 0 {
-		panic("no return value specified for UpdateProcessedOrder")
+		panic("no return value specified for UpdateOrder")
 	}
 
 	var r0 error
@@ -4,12 +4,12 @@ package mocks
 
 import (
 	context "context"
+	time "time"
 
 	mock "github.com/stretchr/testify/mock"
+	lotstorage "github.com/valinurovdenis/gomart/internal/app/lotstorage"
 	orderstorage "github.com/valinurovdenis/gomart/internal/app/orderstorage"
-
 	userstorage "github.com/valinurovdenis/gomart/internal/app/userstorage"
-
 	withdrawstorage "github.com/valinurovdenis/gomart/internal/app/withdrawstorage"
 )
 
@@ -36,6 +36,36 @@ func (_m *ServiceStorage) AddUserOrder(_a0 context.Context, order orderstorage.U
 	return r0
 }
 
+// AddUserOrders provides a mock function with given fields: ctx, orders, enqueue
+func (_m *ServiceStorage) AddUserOrders(ctx context.Context, orders []orderstorage.UserOrder, enqueue func(ctx context.Context, numbers []string) error) ([]error, error) {
+	ret := _m.Called(ctx, orders, enqueue)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddUserOrders")
+	}
+
+	var r0 []error
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []orderstorage.UserOrder, func(ctx context.Context, numbers []string) error) ([]error, error)); ok {
+		return rf(ctx, orders, enqueue)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []orderstorage.UserOrder, func(ctx context.Context, numbers []string) error) []error); ok {
+		r0 = rf(ctx, orders, enqueue)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]error)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []orderstorage.UserOrder, func(ctx context.Context, numbers []string) error) error); ok {
+		r1 = rf(ctx, orders, enqueue)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // AddUserWithdraw provides a mock function with given fields: ctx, order
 func (_m *ServiceStorage) AddUserWithdraw(ctx context.Context, order withdrawstorage.UserWithdraw) error {
 	ret := _m.Called(ctx, order)
@@ -54,9 +84,39 @@ func (_m *ServiceStorage) AddUserWithdraw(ctx context.Context, order withdrawsto
 	return r0
 }
 
-// GetBalance provides a mock function with given fields: _a0, login
-func (_m *ServiceStorage) GetBalance(_a0 context.Context, login string) (userstorage.UserBalance, error) {
-	ret := _m.Called(_a0, login)
+// GetActiveLots provides a mock function with given fields: ctx, login, program, accruedBefore
+func (_m *ServiceStorage) GetActiveLots(ctx context.Context, login string, program string, accruedBefore time.Time) ([]lotstorage.AccrualLot, error) {
+	ret := _m.Called(ctx, login, program, accruedBefore)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetActiveLots")
+	}
+
+	var r0 []lotstorage.AccrualLot
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time) ([]lotstorage.AccrualLot, error)); ok {
+		return rf(ctx, login, program, accruedBefore)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time) []lotstorage.AccrualLot); ok {
+		r0 = rf(ctx, login, program, accruedBefore)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]lotstorage.AccrualLot)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, time.Time) error); ok {
+		r1 = rf(ctx, login, program, accruedBefore)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetBalance provides a mock function with given fields: _a0, login, program
+func (_m *ServiceStorage) GetBalance(_a0 context.Context, login string, program string) (userstorage.UserBalance, error) {
+	ret := _m.Called(_a0, login, program)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetBalance")
@@ -64,13 +124,43 @@ func (_m *ServiceStorage) GetBalance(_a0 context.Context, login string) (usersto
 
 	var r0 userstorage.UserBalance
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) (userstorage.UserBalance, error)); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (userstorage.UserBalance, error)); ok {
+		return rf(_a0, login, program)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) userstorage.UserBalance); ok {
+		r0 = rf(_a0, login, program)
+	} else {
+		r0 = ret.Get(0).(userstorage.UserBalance)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(_a0, login, program)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetBalances provides a mock function with given fields: _a0, login
+func (_m *ServiceStorage) GetBalances(_a0 context.Context, login string) ([]userstorage.UserBalance, error) {
+	ret := _m.Called(_a0, login)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetBalances")
+	}
+
+	var r0 []userstorage.UserBalance
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]userstorage.UserBalance, error)); ok {
 		return rf(_a0, login)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string) userstorage.UserBalance); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, string) []userstorage.UserBalance); ok {
 		r0 = rf(_a0, login)
 	} else {
-		r0 = ret.Get(0).(userstorage.UserBalance)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]userstorage.UserBalance)
+		}
 	}
 
 	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
@@ -82,6 +172,64 @@ func (_m *ServiceStorage) GetBalance(_a0 context.Context, login string) (usersto
 	return r0, r1
 }
 
+// GetOrder provides a mock function with given fields: ctx, number
+func (_m *ServiceStorage) GetOrder(ctx context.Context, number string) (orderstorage.UserOrder, error) {
+	ret := _m.Called(ctx, number)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetOrder")
+	}
+
+	var r0 orderstorage.UserOrder
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (orderstorage.UserOrder, error)); ok {
+		return rf(ctx, number)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) orderstorage.UserOrder); ok {
+		r0 = rf(ctx, number)
+	} else {
+		r0 = ret.Get(0).(orderstorage.UserOrder)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, number)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserAdjustments provides a mock function with given fields: ctx, login
+func (_m *ServiceStorage) GetUserAdjustments(ctx context.Context, login string) ([]orderstorage.Adjustment, error) {
+	ret := _m.Called(ctx, login)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetUserAdjustments")
+	}
+
+	var r0 []orderstorage.Adjustment
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]orderstorage.Adjustment, error)); ok {
+		return rf(ctx, login)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []orderstorage.Adjustment); ok {
+		r0 = rf(ctx, login)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]orderstorage.Adjustment)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, login)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetUserOrders provides a mock function with given fields: _a0, login
 func (_m *ServiceStorage) GetUserOrders(_a0 context.Context, login string) ([]orderstorage.UserOrder, error) {
 	ret := _m.Called(_a0, login)
@@ -142,6 +290,52 @@ func (_m *ServiceStorage) GetUserWithdrawals(ctx context.Context, login string)
 	return r0, r1
 }
 
+// ReverseUserWithdraw provides a mock function with given fields: ctx, id, reason, defaultProgram
+func (_m *ServiceStorage) ReverseUserWithdraw(ctx context.Context, id int64, reason string, defaultProgram string) (withdrawstorage.UserWithdraw, error) {
+	ret := _m.Called(ctx, id, reason, defaultProgram)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReverseUserWithdraw")
+	}
+
+	var r0 withdrawstorage.UserWithdraw
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, string, string) (withdrawstorage.UserWithdraw, error)); ok {
+		return rf(ctx, id, reason, defaultProgram)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, string, string) withdrawstorage.UserWithdraw); ok {
+		r0 = rf(ctx, id, reason, defaultProgram)
+	} else {
+		r0 = ret.Get(0).(withdrawstorage.UserWithdraw)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64, string, string) error); ok {
+		r1 = rf(ctx, id, reason, defaultProgram)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateOrderAccrual provides a mock function with given fields: ctx, order
+func (_m *ServiceStorage) UpdateOrderAccrual(ctx context.Context, order orderstorage.UserOrder) error {
+	ret := _m.Called(ctx, order)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateOrderAccrual")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, orderstorage.UserOrder) error); ok {
+		r0 = rf(ctx, order)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewServiceStorage creates a new instance of ServiceStorage. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewServiceStorage(t interface {
@@ -6,6 +6,7 @@ import (
 	context "context"
 
 	mock "github.com/stretchr/testify/mock"
+	rbac "github.com/valinurovdenis/gomart/internal/app/rbac"
 	userstorage "github.com/valinurovdenis/gomart/internal/app/userstorage"
 )
 
@@ -32,6 +33,62 @@ func (_m *UserStorage) AddUser(_a0 context.Context, user userstorage.LoginPasswo
 	return r0
 }
 
+// GetRole provides a mock function with given fields: _a0, login
+func (_m *UserStorage) GetRole(_a0 context.Context, login string) (rbac.Role, error) {
+	ret := _m.Called(_a0, login)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetRole")
+	}
+
+	var r0 rbac.Role
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (rbac.Role, error)); ok {
+		return rf(_a0, login)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) rbac.Role); ok {
+		r0 = rf(_a0, login)
+	} else {
+		r0 = ret.Get(0).(rbac.Role)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(_a0, login)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTokenVersion provides a mock function with given fields: _a0, login
+func (_m *UserStorage) GetTokenVersion(_a0 context.Context, login string) (int, error) {
+	ret := _m.Called(_a0, login)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetTokenVersion")
+	}
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (int, error)); ok {
+		return rf(_a0, login)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) int); ok {
+		r0 = rf(_a0, login)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(_a0, login)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetUserPassword provides a mock function with given fields: _a0, login
 func (_m *UserStorage) GetUserPassword(_a0 context.Context, login string) (string, error) {
 	ret := _m.Called(_a0, login)
@@ -60,6 +117,42 @@ func (_m *UserStorage) GetUserPassword(_a0 context.Context, login string) (strin
 	return r0, r1
 }
 
+// SetPassword provides a mock function with given fields: _a0, login, password
+func (_m *UserStorage) SetPassword(_a0 context.Context, login string, password string) error {
+	ret := _m.Called(_a0, login, password)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetPassword")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(_a0, login, password)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetRole provides a mock function with given fields: _a0, login, role
+func (_m *UserStorage) SetRole(_a0 context.Context, login string, role rbac.Role) error {
+	ret := _m.Called(_a0, login, role)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetRole")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, rbac.Role) error); ok {
+		r0 = rf(_a0, login, role)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewUserStorage creates a new instance of UserStorage. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewUserStorage(t interface {
@@ -62,6 +62,34 @@ func (_m *WithdrawRepository) GetUserWithdrawals(_a0 context.Context, login stri
 	return r0, r1
 }
 
+// ReverseUserWithdraw provides a mock function with given fields: _a0, id, reason
+func (_m *WithdrawRepository) ReverseUserWithdraw(_a0 context.Context, id int64, reason string) (withdrawstorage.UserWithdraw, error) {
+	ret := _m.Called(_a0, id, reason)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReverseUserWithdraw")
+	}
+
+	var r0 withdrawstorage.UserWithdraw
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, string) (withdrawstorage.UserWithdraw, error)); ok {
+		return rf(_a0, id, reason)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, string) withdrawstorage.UserWithdraw); ok {
+		r0 = rf(_a0, id, reason)
+	} else {
+		r0 = ret.Get(0).(withdrawstorage.UserWithdraw)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64, string) error); ok {
+		r1 = rf(_a0, id, reason)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewWithdrawRepository creates a new instance of WithdrawRepository. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewWithdrawRepository(t interface {
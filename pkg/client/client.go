@@ -0,0 +1,362 @@
+// Package client is a Go client of the gophermart loyalty API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrLoginExists          = errors.New("login already exists")
+	ErrInvalidRequest       = errors.New("invalid request")
+	ErrOrderExists          = errors.New("order uploaded by another user")
+	ErrInvalidOrder         = errors.New("invalid order number")
+	ErrNotEnoughBalance     = errors.New("not enough balance")
+	ErrBodyTooLarge         = errors.New("request body too large")
+	ErrRateLimited          = errors.New("too many requests")
+	ErrServer               = errors.New("server error")
+	ErrSecondFactorRequired = errors.New("second factor required")
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is a failed API call, errors.Is matches it against the package sentinel errors.
+type Error struct {
+	StatusCode int
+	Message    string
+	Fields     []FieldError
+	kind       error
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) > 0 {
+		messages := make([]string, 0, len(e.Fields))
+		for _, field := range e.Fields {
+			messages = append(messages, field.Field+": "+field.Message)
+		}
+		return fmt.Sprintf("%s (%d): %s", e.kind, e.StatusCode, strings.Join(messages, "; "))
+	}
+	if e.Message != "" {
+		return fmt.Sprintf("%s (%d): %s", e.kind, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s (%d)", e.kind, e.StatusCode)
+}
+
+func (e *Error) Unwrap() error {
+	return e.kind
+}
+
+// ChallengeError is returned by Login of user with enabled second factor,
+// login is completed by VerifyLogin with Challenge and code of authenticator.
+type ChallengeError struct {
+	Challenge string
+	ExpiresIn time.Duration
+}
+
+func (e *ChallengeError) Error() string {
+	return fmt.Sprintf("%s, challenge expires in %s", ErrSecondFactorRequired, e.ExpiresIn)
+}
+
+func (e *ChallengeError) Unwrap() error {
+	return ErrSecondFactorRequired
+}
+
+// Amounts are decimal numbers of points of Program.
+type Order struct {
+	Number     string    `json:"number"`
+	Program    string    `json:"program,omitempty"`
+	Status     string    `json:"status"`
+	Accrual    float64   `json:"accrual"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+type ProgramBalance struct {
+	Program   string  `json:"program"`
+	Name      string  `json:"name"`
+	Current   float64 `json:"current"`
+	Withdrawn float64 `json:"withdrawn"`
+}
+
+type ExpiringPoints struct {
+	Program   string    `json:"program"`
+	Amount    float64   `json:"amount"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Balance keeps default program balance on top level.
+type Balance struct {
+	Current      float64          `json:"current"`
+	Withdrawn    float64          `json:"withdrawn"`
+	Programs     []ProgramBalance `json:"programs"`
+	ExpiringSoon []ExpiringPoints `json:"expiring_soon"`
+}
+
+type WithdrawRequest struct {
+	Order string  `json:"order"`
+	Sum   float64 `json:"sum"`
+	// Program is the default program if empty.
+	Program string `json:"program,omitempty"`
+}
+
+type Withdrawal struct {
+	ID            int64      `json:"id"`
+	Order         string     `json:"order"`
+	Program       string     `json:"program,omitempty"`
+	Sum           float64    `json:"sum"`
+	ProcessedAt   time.Time  `json:"processed_at"`
+	Status        string     `json:"status"`
+	ReversedAt    *time.Time `json:"reversed_at,omitempty"`
+	ReverseReason string     `json:"reverse_reason,omitempty"`
+}
+
+const tokenCookie = "Authorization"
+
+// Client keeps token of the last registered or logged in user and sends it with every call.
+// Idempotent calls are retried on network errors, 429 and 5xx gateway errors with doubling delay.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Retries    int
+	RetryDelay time.Duration
+
+	mu    sync.RWMutex
+	token string
+}
+
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+// SetToken authenticates client with token got elsewhere.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+type call struct {
+	method      string
+	path        string
+	contentType string
+	body        []byte
+	// errors maps statuses of the call to sentinel errors.
+	errors map[int]error
+}
+
+func (c *Client) send(ctx context.Context, call call) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, call.method, strings.TrimSuffix(c.BaseURL, "/")+call.path, bytes.NewReader(call.body))
+	if err != nil {
+		return nil, err
+	}
+	if call.contentType != "" {
+		req.Header.Set("Content-Type", call.contentType)
+	}
+	if token := c.Token(); token != "" {
+		req.AddCookie(&http.Cookie{Name: tokenCookie, Value: token})
+	}
+	return c.HTTPClient.Do(req)
+}
+
+func retryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusBadGateway ||
+		statusCode == http.StatusServiceUnavailable || statusCode == http.StatusGatewayTimeout
+}
+
+// retryAfter returns delay requested by server or backoff.
+func retryAfter(response *http.Response, backoff time.Duration) time.Duration {
+	if response == nil {
+		return backoff
+	}
+	if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && time.Duration(seconds)*time.Second > backoff {
+		return time.Duration(seconds) * time.Second
+	}
+	return backoff
+}
+
+// do sends call retrying GET requests and returns response with success status.
+func (c *Client) do(ctx context.Context, call call) (*http.Response, error) {
+	attempts := 1
+	if call.method == http.MethodGet {
+		attempts += c.Retries
+	}
+	backoff := c.RetryDelay
+	for attempt := 1; ; attempt++ {
+		response, err := c.send(ctx, call)
+		if err == nil && response.StatusCode < 300 {
+			return response, nil
+		}
+		if attempt >= attempts || (err == nil && !retryable(response.StatusCode)) || ctx.Err() != nil {
+			if err != nil {
+				return nil, err
+			}
+			return nil, responseError(response, call.errors)
+		}
+		delay := retryAfter(response, backoff)
+		if response != nil {
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		backoff *= 2
+	}
+}
+
+func responseError(response *http.Response, errs map[int]error) error {
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	apiErr := &Error{StatusCode: response.StatusCode, kind: errs[response.StatusCode]}
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		var validationErr struct {
+			Errors []FieldError `json:"errors"`
+		}
+		if json.Unmarshal(body, &validationErr) == nil {
+			apiErr.Fields = validationErr.Errors
+		}
+	} else {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	if apiErr.kind != nil {
+		return apiErr
+	}
+	switch {
+	case response.StatusCode == http.StatusUnauthorized:
+		apiErr.kind = ErrUnauthorized
+	case response.StatusCode == http.StatusRequestEntityTooLarge:
+		apiErr.kind = ErrBodyTooLarge
+	case response.StatusCode == http.StatusTooManyRequests:
+		apiErr.kind = ErrRateLimited
+	case response.StatusCode >= 500:
+		apiErr.kind = ErrServer
+	default:
+		apiErr.kind = ErrInvalidRequest
+	}
+	return apiErr
+}
+
+// getJSON decodes response of GET call, no content gives zero value.
+func (c *Client) getJSON(ctx context.Context, path string, v any) error {
+	response, err := c.do(ctx, call{method: http.MethodGet, path: path})
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+func (c *Client) authenticate(ctx context.Context, path string, request any, errs map[int]error) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	response, err := c.do(ctx, call{method: http.MethodPost, path: path, contentType: "application/json", body: body, errors: errs})
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusAccepted {
+		var challenge struct {
+			Token     string `json:"challenge_token"`
+			ExpiresIn int    `json:"expires_in"`
+		}
+		if err = json.NewDecoder(response.Body).Decode(&challenge); err != nil {
+			return fmt.Errorf("%w: %w", ErrServer, err)
+		}
+		return &ChallengeError{Challenge: challenge.Token, ExpiresIn: time.Duration(challenge.ExpiresIn) * time.Second}
+	}
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == tokenCookie {
+			c.SetToken(cookie.Value)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: no token in response", ErrServer)
+}
+
+// Register creates user and authenticates client as that user.
+func (c *Client) Register(ctx context.Context, login string, password string) error {
+	return c.authenticate(ctx, "/api/user/register", map[string]string{"login": login, "password": password},
+		map[int]error{http.StatusConflict: ErrLoginExists})
+}
+
+// Login authenticates client as user, users with enabled second factor get *ChallengeError.
+func (c *Client) Login(ctx context.Context, login string, password string) error {
+	return c.authenticate(ctx, "/api/user/login", map[string]string{"login": login, "password": password}, nil)
+}
+
+// VerifyLogin completes login of user with enabled second factor by code of authenticator or recovery code.
+func (c *Client) VerifyLogin(ctx context.Context, challenge string, code string) error {
+	return c.authenticate(ctx, "/api/user/login/2fa", map[string]string{"challenge_token": challenge, "code": code}, nil)
+}
+
+// UploadOrder sends order number for accrual, false means user has already uploaded it.
+func (c *Client) UploadOrder(ctx context.Context, number string) (bool, error) {
+	response, err := c.do(ctx, call{method: http.MethodPost, path: "/api/user/orders", contentType: "text/plain", body: []byte(number),
+		errors: map[int]error{http.StatusConflict: ErrOrderExists, http.StatusUnprocessableEntity: ErrInvalidOrder}})
+	if err != nil {
+		return false, err
+	}
+	response.Body.Close()
+	return response.StatusCode == http.StatusAccepted, nil
+}
+
+func (c *Client) ListOrders(ctx context.Context) ([]Order, error) {
+	var orders []Order
+	return orders, c.getJSON(ctx, "/api/user/orders", &orders)
+}
+
+func (c *Client) Balance(ctx context.Context) (Balance, error) {
+	var balance Balance
+	return balance, c.getJSON(ctx, "/api/user/balance", &balance)
+}
+
+func (c *Client) Withdraw(ctx context.Context, request WithdrawRequest) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	response, err := c.do(ctx, call{method: http.MethodPost, path: "/api/user/balance/withdraw", contentType: "application/json", body: body,
+		errors: map[int]error{http.StatusPaymentRequired: ErrNotEnoughBalance, http.StatusUnprocessableEntity: ErrInvalidOrder}})
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (c *Client) ListWithdrawals(ctx context.Context) ([]Withdrawal, error) {
+	var withdrawals []Withdrawal
+	return withdrawals, c.getJSON(ctx, "/api/user/withdrawals", &withdrawals)
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL:    baseURL,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		Retries:    3,
+		RetryDelay: 200 * time.Millisecond,
+	}
+}
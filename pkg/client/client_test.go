@@ -0,0 +1,192 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/valinurovdenis/gomart/internal/app/accrualorder"
+	"github.com/valinurovdenis/gomart/internal/app/auth"
+	"github.com/valinurovdenis/gomart/internal/app/clock"
+	"github.com/valinurovdenis/gomart/internal/app/handlers"
+	"github.com/valinurovdenis/gomart/internal/app/memstorage"
+	"github.com/valinurovdenis/gomart/internal/app/orderstorage"
+	"github.com/valinurovdenis/gomart/internal/app/programs"
+	"github.com/valinurovdenis/gomart/internal/app/service"
+	"github.com/valinurovdenis/gomart/internal/app/twofactor"
+	"github.com/valinurovdenis/gomart/internal/app/validators"
+	"github.com/valinurovdenis/gomart/mocks"
+	"github.com/valinurovdenis/gomart/pkg/client"
+)
+
+// newRouter serves api over storage, second factor is enabled if twoFactor is not nil.
+func newRouter(t *testing.T, storage *memstorage.MemoryStorage, twoFactor *twofactor.TwoFactorService) http.Handler {
+	registry, err := programs.ParseRegistry("points:Gophermart points:2")
+	require.NoError(t, err)
+	accrual := mocks.NewAccrualOrderService(t)
+	accrual.On("GetOrder", mock.Anything, "79927398713").
+		Return(accrualorder.AccrualOrder{Status: orderstorage.Processed, Accrual: "500", Program: "points"}, nil).Maybe()
+
+	serviceStorage := service.NewServiceStorage(storage, storage, storage, storage, storage, storage)
+	orderService := service.NewOrderService(serviceStorage, accrual, service.Settings{Programs: registry, Clock: clock.RealClock{}, TwoFactor: twoFactor})
+	handler := handlers.NewApiHandler(*orderService, validators.Limits{MaxBodySize: 1024})
+	authenticator := auth.NewAuthenticator("secret", "", storage)
+	authenticator.TwoFactor = twoFactor
+	return handlers.MartRouter(*handler, *authenticator)
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(newRouter(t, memstorage.NewMemoryStorage(clock.RealClock{}), nil))
+	defer server.Close()
+
+	user := client.NewClient(server.URL)
+	require.ErrorIs(t, user.Login(ctx, "user1", "Passw0rd!"), client.ErrUnauthorized)
+	require.NoError(t, user.Register(ctx, "user1", "Passw0rd!"))
+	require.NotEmpty(t, user.Token())
+	require.ErrorIs(t, user.Register(ctx, "user1", "Passw0rd!"), client.ErrLoginExists)
+	err := user.Register(ctx, "ab", "Passw0rd!")
+	var apiErr *client.Error
+	require.ErrorAs(t, err, &apiErr)
+	require.ErrorIs(t, err, client.ErrInvalidRequest)
+	require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	require.NotEmpty(t, apiErr.Fields)
+	require.Equal(t, "login", apiErr.Fields[0].Field)
+
+	_, err = client.NewClient(server.URL).ListOrders(ctx)
+	require.ErrorIs(t, err, client.ErrUnauthorized)
+
+	orders, err := user.ListOrders(ctx)
+	require.NoError(t, err)
+	require.Empty(t, orders)
+
+	accepted, err := user.UploadOrder(ctx, "79927398713")
+	require.NoError(t, err)
+	require.True(t, accepted)
+	accepted, err = user.UploadOrder(ctx, "79927398713")
+	require.NoError(t, err)
+	require.False(t, accepted)
+	_, err = user.UploadOrder(ctx, "12345")
+	require.ErrorIs(t, err, client.ErrInvalidOrder)
+
+	other := client.NewClient(server.URL)
+	require.NoError(t, other.Register(ctx, "user2", "Passw0rd!"))
+	_, err = other.UploadOrder(ctx, "79927398713")
+	require.ErrorIs(t, err, client.ErrOrderExists)
+
+	relogged := client.NewClient(server.URL)
+	require.NoError(t, relogged.Login(ctx, "user1", "Passw0rd!"))
+	orders, err = relogged.ListOrders(ctx)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	require.Equal(t, client.Order{Number: "79927398713", Program: "points", Status: "PROCESSED", Accrual: 500, UploadedAt: orders[0].UploadedAt}, orders[0])
+
+	require.NoError(t, user.Withdraw(ctx, client.WithdrawRequest{Order: "2377225624", Sum: 1.5}))
+	require.ErrorIs(t, user.Withdraw(ctx, client.WithdrawRequest{Order: "2377225624", Sum: 1000}), client.ErrNotEnoughBalance)
+	require.ErrorIs(t, user.Withdraw(ctx, client.WithdrawRequest{Order: "12345", Sum: 1}), client.ErrInvalidOrder)
+	require.ErrorIs(t, user.Withdraw(ctx, client.WithdrawRequest{Order: "2377225624", Sum: 1.5, Program: "miles"}), client.ErrInvalidRequest)
+
+	balance, err := user.Balance(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 498.5, balance.Current)
+	require.Equal(t, 1.5, balance.Withdrawn)
+	require.Equal(t, []client.ProgramBalance{{Program: "points", Name: "Gophermart points", Current: 498.5, Withdrawn: 1.5}}, balance.Programs)
+
+	withdrawals, err := user.ListWithdrawals(ctx)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	require.Equal(t, "2377225624", withdrawals[0].Order)
+	require.Equal(t, 1.5, withdrawals[0].Sum)
+	require.Equal(t, "points", withdrawals[0].Program)
+	require.Equal(t, "DONE", withdrawals[0].Status)
+}
+
+func TestClientSecondFactor(t *testing.T) {
+	ctx := context.Background()
+	storage := memstorage.NewMemoryStorage(clock.RealClock{})
+	twoFactorClock := &clock.FixedClock{Time: time.Now()}
+	twoFactor := twofactor.NewTwoFactorService(storage, twoFactorClock, "Gophermart", 5*time.Minute)
+	server := httptest.NewServer(newRouter(t, storage, twoFactor))
+	defer server.Close()
+
+	require.NoError(t, client.NewClient(server.URL).Register(ctx, "user1", "Passw0rd!"))
+	enrollment, err := twoFactor.Enroll(ctx, "user1")
+	require.NoError(t, err)
+	code := func() string {
+		twoFactorClock.Advance(30 * time.Second)
+		code, err := twofactor.Code(enrollment.Secret, twoFactorClock.Now().Unix()/30)
+		require.NoError(t, err)
+		return code
+	}
+	_, err = twoFactor.Enable(ctx, "user1", code())
+	require.NoError(t, err)
+
+	user := client.NewClient(server.URL)
+	err = user.Login(ctx, "user1", "Passw0rd!")
+	require.ErrorIs(t, err, client.ErrSecondFactorRequired)
+	var challenge *client.ChallengeError
+	require.ErrorAs(t, err, &challenge)
+	require.NotEmpty(t, challenge.Challenge)
+	require.Empty(t, user.Token())
+
+	require.ErrorIs(t, user.VerifyLogin(ctx, challenge.Challenge, "abcdef"), client.ErrUnauthorized)
+	require.NoError(t, user.VerifyLogin(ctx, challenge.Challenge, code()))
+	require.NotEmpty(t, user.Token())
+	_, err = user.ListOrders(ctx)
+	require.NoError(t, err)
+}
+
+func TestClientRetries(t *testing.T) {
+	ctx := context.Background()
+	router := newRouter(t, memstorage.NewMemoryStorage(clock.RealClock{}), nil)
+	var calls, failures atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failures.Add(-1) >= 0 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		router.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	c := client.NewClient(server.URL)
+	c.RetryDelay = time.Millisecond
+	require.NoError(t, c.Register(ctx, "user1", "Passw0rd!"))
+
+	// idempotent call is retried
+	calls.Store(0)
+	failures.Store(2)
+	_, err := c.Balance(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), calls.Load())
+
+	// retries are limited
+	calls.Store(0)
+	failures.Store(10)
+	_, err = c.ListWithdrawals(ctx)
+	require.ErrorIs(t, err, client.ErrServer)
+	require.Equal(t, int32(c.Retries+1), calls.Load())
+
+	// not idempotent call is sent once
+	calls.Store(0)
+	failures.Store(1)
+	err = c.Withdraw(ctx, client.WithdrawRequest{Order: "2377225624", Sum: 1})
+	require.ErrorIs(t, err, client.ErrServer)
+	require.Equal(t, int32(1), calls.Load())
+
+	// cancelled context stops retries
+	failures.Store(10)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = c.ListOrders(cancelled)
+	require.True(t, errors.Is(err, context.Canceled))
+}